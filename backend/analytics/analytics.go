@@ -0,0 +1,88 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window in which repeated requests of a listener count as one download
+const Window = 24 * time.Hour
+
+// DefaultBitrate in bytes per second is assumed when duration of an episode is unknown
+const DefaultBitrate = 128000 / 8
+
+// HashIP with salt, so raw addresses are never stored
+func HashIP(salt, ip string) string {
+	sum := sha256.Sum256([]byte(salt + "|" + ip))
+	return hex.EncodeToString(sum[:16])
+}
+
+// MinBytes listener has to get to count a download: one minute of audio
+func MinBytes(length, duration int) int64 {
+	if length > 0 && duration > 0 {
+		return int64(length) * 60 / int64(duration)
+	}
+	return DefaultBitrate * 60
+}
+
+// ParseRange returns first range of Range header. End is -1 if range is open.
+// Suffix range like "bytes=-500" is the last bytes of file of size, it's
+// open when size is unknown
+func ParseRange(header string, size int64) (int64, int64) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header {
+		return 0, -1
+	}
+
+	first := strings.TrimSpace(strings.SplitN(spec, ",", 2)[0])
+	bounds := strings.SplitN(first, "-", 2)
+	if len(bounds) != 2 {
+		return 0, -1
+	}
+
+	if bounds[0] == "" {
+		n, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || size <= 0 {
+			return 0, -1
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1
+	}
+
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		start = 0
+	}
+
+	end, err := strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil {
+		end = -1
+	}
+
+	return start, end
+}
+
+var subscribers = regexp.MustCompile(`(?i)(\d+) (subscriber|reader)s?\b`)
+
+// ParseSubscribers reported by aggregators in user agent, e.g.
+// "Feedly/1.0 (+http://www.feedly.com/fetcher.html; 42 subscribers; )".
+// Aggregator is user agent without the count, so it's the same every day
+func ParseSubscribers(ua string) (string, int64, bool) {
+	m := subscribers.FindStringSubmatchIndex(ua)
+	if m == nil {
+		return "", 0, false
+	}
+
+	n, err := strconv.ParseInt(ua[m[2]:m[3]], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return ua[:m[2]] + ua[m[3]:], n, true
+}
@@ -0,0 +1,75 @@
+package analytics
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashIP(t *testing.T) {
+	assert := assert.New(t)
+
+	h := HashIP("salt", "192.0.2.1")
+	assert.Len(h, 32)
+	assert.Equal(h, HashIP("salt", "192.0.2.1"))
+	assert.NotEqual(h, HashIP("pepper", "192.0.2.1"))
+	assert.NotEqual(h, HashIP("salt", "192.0.2.2"))
+}
+
+func TestMinBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(int64(600000), MinBytes(6000000, 600))
+	assert.Equal(int64(DefaultBitrate*60), MinBytes(6000000, 0))
+	assert.Equal(int64(DefaultBitrate*60), MinBytes(0, 600))
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		start  int64
+		end    int64
+	}{
+		{"", 1000, 0, -1},
+		{"bytes=0-1", 1000, 0, 1},
+		{"bytes=100-", 1000, 100, -1},
+		{"bytes=-500", 1000, 500, 999},
+		{"bytes=-5000", 1000, 0, 999},
+		{"bytes=-500", 0, 0, -1},
+		{"bytes=-x", 1000, 0, -1},
+		{"bytes=10-20, 30-40", 1000, 10, 20},
+		{"items=1-2", 1000, 0, -1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.header, tt.size), func(t *testing.T) {
+			start, end := ParseRange(tt.header, tt.size)
+			assert.Equal(t, tt.start, start)
+			assert.Equal(t, tt.end, end)
+		})
+	}
+}
+
+func TestParseSubscribers(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		ua          string
+		aggregator  string
+		subscribers int64
+		ok          bool
+	}{
+		{"Feedly/1.0 (+http://www.feedly.com/fetcher.html; 42 subscribers; )", "Feedly/1.0 (+http://www.feedly.com/fetcher.html;  subscribers; )", 42, true},
+		{"NewsBlur Feed Fetcher - 7 subscribers - http://www.newsblur.com", "NewsBlur Feed Fetcher -  subscribers - http://www.newsblur.com", 7, true},
+		{"Feedbin feed-id:12 - 1 subscriber", "Feedbin feed-id:12 -  subscriber", 1, true},
+		{"Overcast/3.0 (+http://overcast.fm/; iOS podcast app)", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tt := range tests {
+		aggregator, n, ok := ParseSubscribers(tt.ua)
+		assert.Equal(tt.aggregator, aggregator, tt.ua)
+		assert.Equal(tt.subscribers, n, tt.ua)
+		assert.Equal(tt.ok, ok, tt.ua)
+	}
+}
@@ -0,0 +1,401 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/azzzak/fakecast/analytics"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/azzzak/fakecast/useragent"
+	"github.com/go-chi/chi"
+)
+
+const saltKey = "ip_salt"
+
+type stats struct {
+	From      string                 `json:"from"`
+	To        string                 `json:"to"`
+	Daily     []store.DailyDownloads `json:"daily"`
+	Apps      []breakdown            `json:"apps"`
+	Platforms []breakdown            `json:"platforms"`
+}
+
+type breakdown struct {
+	Name      string `json:"name"`
+	Downloads int64  `json:"downloads"`
+}
+
+type report struct {
+	From string      `json:"from"`
+	To   string      `json:"to"`
+	Apps []appReport `json:"apps"`
+}
+
+type appReport struct {
+	App       string `json:"app"`
+	Downloads int64  `json:"downloads"`
+	FeedPolls int64  `json:"feed_polls"`
+}
+
+type subscribers struct {
+	From  string            `json:"from"`
+	To    string            `json:"to"`
+	Daily []dailySubscriber `json:"daily"`
+}
+
+// dailySubscriber estimate is a sum of counts reported by aggregators and
+// unique IP and user agent pairs of other clients
+type dailySubscriber struct {
+	Date        string `json:"date"`
+	Subscribers int64  `json:"subscribers"`
+	Aggregators int64  `json:"aggregators"`
+	Direct      int64  `json:"direct"`
+}
+
+func (cfg *Cfg) agents() *useragent.Classifier {
+	if cfg.Agents != nil {
+		return cfg.Agents
+	}
+	return useragent.Default()
+}
+
+// loadSalt for hashing of IPs. It's generated once and kept in store
+func (cfg *Cfg) loadSalt() (string, error) {
+	salt, err := cfg.Store.Setting(saltKey)
+	if err == nil {
+		return salt, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	salt = hex.EncodeToString(b)
+
+	return salt, cfg.Store.SetSetting(saltKey, salt)
+}
+
+// recordDownloads of episodes served from /files
+func (cfg *Cfg) recordDownloads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		if r.Method != http.MethodGet || (sw.status != http.StatusOK && sw.status != http.StatusPartialContent) {
+			return
+		}
+
+		// covers are in subdirectory, so episode path is alias/filename
+		parts := strings.Split(strings.TrimPrefix(chi.URLParam(r, "*"), "/"), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[1] == fs.CoverDirName {
+			return
+		}
+
+		if err := cfg.recordDownload(r, parts[0], parts[1], sw.bytes); err != nil {
+			logger(r).Warn("download is not recorded", "err", err)
+		}
+	})
+}
+
+func (cfg *Cfg) recordDownload(r *http.Request, alias, filename string, bytes int64) error {
+	cid, err := cfg.Store.SwapAliasForCID(alias)
+	if err != nil {
+		return err
+	}
+
+	p, err := cfg.Store.PodcastByFilename(cid, filename)
+	if err != nil {
+		return err
+	}
+
+	// suffix range is measured from size of file as it's served
+	size := int64(p.Length)
+	if fi, err := os.Stat(filepath.Join(cfg.FS.Root, alias, filename)); err == nil {
+		size = fi.Size()
+	}
+	start, end := analytics.ParseRange(r.Header.Get("Range"), size)
+	ua := r.UserAgent()
+
+	d := &store.Download{
+		Time:       time.Now().Unix(),
+		Channel:    cid,
+		Podcast:    p.ID,
+		IPHash:     analytics.HashIP(cfg.salt, cfg.clientIP(r)),
+		UserAgent:  ua,
+		RangeStart: start,
+		RangeEnd:   end,
+		Bytes:      bytes,
+	}
+
+	bot := cfg.agents().Classify(ua).Bot
+
+	_, err = cfg.Store.RecordDownload(d, analytics.Window, !bot, analytics.MinBytes(p.Length, p.Duration))
+	return err
+}
+
+func (cfg *Cfg) recordPoll(r *http.Request, cid int64) error {
+	p := &store.FeedPoll{
+		Time:      time.Now().Unix(),
+		Channel:   cid,
+		IPHash:    analytics.HashIP(cfg.salt, cfg.clientIP(r)),
+		UserAgent: r.UserAgent(),
+	}
+
+	return cfg.Store.RecordPoll(p)
+}
+
+// maxPeriodDays of stats, so a request can't ask for centuries of days
+const maxPeriodDays = 366
+
+// period from "from" and "to" query params, both dates are included.
+// Last 30 days by default, at most maxPeriodDays
+func period(r *http.Request) (time.Time, time.Time, error) {
+	const layout = "2006-01-02"
+
+	invalid := func(field string) error {
+		return errInvalid("Invalid date", fieldError{Field: field, Message: "must be date like 2006-01-02"})
+	}
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, invalid("to")
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, invalid("from")
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, errInvalid("Invalid period", fieldError{Field: "from", Message: "must not be after to"})
+	}
+	if to.Sub(from) >= maxPeriodDays*24*time.Hour {
+		return time.Time{}, time.Time{}, errInvalid("Invalid period", fieldError{Field: "from", Message: fmt.Sprintf("must be at most %d days before to", maxPeriodDays-1)})
+	}
+
+	return from, to, nil
+}
+
+func (cfg *Cfg) stats(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
+
+	from, to, err := period(r)
+	if err != nil {
+		return err
+	}
+	end := to.AddDate(0, 0, 1)
+
+	daily, err := cfg.Store.DailyDownloadsOf(cid, from.Unix(), end.Unix())
+	if err != nil {
+		return err
+	}
+
+	agents, err := cfg.Store.AgentDownloadsOf(cid, from.Unix(), end.Unix())
+	if err != nil {
+		return err
+	}
+
+	apps := map[string]int64{}
+	platforms := map[string]int64{}
+	for _, a := range agents {
+		client := cfg.agents().Classify(a.UserAgent)
+		apps[client.App] += a.Count
+		platforms[client.OS] += a.Count
+	}
+
+	out := stats{
+		From:      from.Format("2006-01-02"),
+		To:        to.Format("2006-01-02"),
+		Daily:     daily,
+		Apps:      breakdownOf(apps),
+		Platforms: breakdownOf(platforms),
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cfg *Cfg) reports(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
+
+	from, to, err := period(r)
+	if err != nil {
+		return err
+	}
+	end := to.AddDate(0, 0, 1)
+
+	downloads, err := cfg.Store.AgentDownloadsOf(cid, from.Unix(), end.Unix())
+	if err != nil {
+		return err
+	}
+
+	polls, err := cfg.Store.AgentPollsOf(cid, from.Unix(), end.Unix())
+	if err != nil {
+		return err
+	}
+
+	apps := map[string]*appReport{}
+	app := func(ua string) *appReport {
+		client := cfg.agents().Classify(ua)
+		if client.Bot {
+			return nil
+		}
+		a, ok := apps[client.App]
+		if !ok {
+			a = &appReport{App: client.App}
+			apps[client.App] = a
+		}
+		return a
+	}
+
+	for _, d := range downloads {
+		if a := app(d.UserAgent); a != nil {
+			a.Downloads += d.Count
+		}
+	}
+
+	for _, p := range polls {
+		if a := app(p.UserAgent); a != nil {
+			a.FeedPolls += p.Count
+		}
+	}
+
+	out := report{
+		From: from.Format("2006-01-02"),
+		To:   to.Format("2006-01-02"),
+	}
+
+	for _, a := range apps {
+		out.Apps = append(out.Apps, *a)
+	}
+
+	sort.Slice(out.Apps, func(i, j int) bool {
+		a, b := out.Apps[i], out.Apps[j]
+		if a.Downloads != b.Downloads {
+			return a.Downloads > b.Downloads
+		}
+		if a.FeedPolls != b.FeedPolls {
+			return a.FeedPolls > b.FeedPolls
+		}
+		return a.App < b.App
+	})
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cfg *Cfg) subscribers(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
+
+	from, to, err := period(r)
+	if err != nil {
+		return err
+	}
+
+	pollers, err := cfg.Store.DailyPollersOf(cid, from.Unix(), to.AddDate(0, 0, 1).Unix())
+	if err != nil {
+		return err
+	}
+
+	days := map[string]*dailySubscriber{}
+	// the biggest count reported by an aggregator during a day
+	reported := map[string]map[string]int64{}
+
+	for _, p := range pollers {
+		d, ok := days[p.Date]
+		if !ok {
+			d = &dailySubscriber{Date: p.Date}
+			days[p.Date] = d
+			reported[p.Date] = map[string]int64{}
+		}
+
+		if aggregator, n, ok := analytics.ParseSubscribers(p.UserAgent); ok {
+			if n > reported[p.Date][aggregator] {
+				reported[p.Date][aggregator] = n
+			}
+			continue
+		}
+
+		if cfg.agents().Classify(p.UserAgent).Bot {
+			continue
+		}
+		d.Direct += p.IPs
+	}
+
+	out := subscribers{
+		From:  from.Format("2006-01-02"),
+		To:    to.Format("2006-01-02"),
+		Daily: []dailySubscriber{},
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+
+		d, ok := days[date]
+		if !ok {
+			d = &dailySubscriber{Date: date}
+		}
+
+		for _, n := range reported[date] {
+			d.Aggregators += n
+		}
+		d.Subscribers = d.Aggregators + d.Direct
+
+		out.Daily = append(out.Daily, *d)
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// breakdownOf counts sorted from the largest
+func breakdownOf(m map[string]int64) []breakdown {
+	var bs []breakdown
+	for name, n := range m {
+		bs = append(bs, breakdown{Name: name, Downloads: n})
+	}
+
+	sort.Slice(bs, func(i, j int) bool {
+		if bs[i].Downloads != bs[j].Downloads {
+			return bs[i].Downloads > bs[j].Downloads
+		}
+		return bs[i].Name < bs[j].Name
+	})
+
+	return bs
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadStats(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	root := fs.NewRoot(testDir)
+
+	cfg := &Cfg{
+		Store: s,
+		FS:    root,
+		Host:  "http://localhost",
+	}
+
+	cid, err := s.AddChannel()
+	assert.Nil(err)
+
+	c, err := s.ChannelInfo(cid)
+	assert.Nil(err)
+	c.Alias = "news"
+	err = s.UpdateChannel(c)
+	assert.Nil(err)
+
+	err = root.CreateDir(cid)
+	assert.Nil(err)
+	err = root.RenameDir("1", "news")
+	assert.Nil(err)
+
+	// 60 bytes per minute of audio
+	p, err := s.AddPodcastToChannel(cid, "episode.mp3", "Episode", 600)
+	assert.Nil(err)
+	p, err = s.PodcastInfo(p.ID)
+	assert.Nil(err)
+	p.Duration = 600
+	err = s.UpdatePodcast(p)
+	assert.Nil(err)
+
+	err = ioutil.WriteFile(filepath.Join(root.Root, "news", "episode.mp3"), make([]byte, 600), 0644)
+	assert.Nil(err)
+
+	h := InitHandlers(cfg)
+
+	get := func(ua, rng string) {
+		r := httptest.NewRequest("GET", "/files/news/episode.mp3", nil)
+		r.Header.Set("User-Agent", ua)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.True(w.Code == http.StatusOK || w.Code == http.StatusPartialContent)
+	}
+
+	apple := "AppleCoreMedia/1.0.0.17E262 (iPhone; U; CPU OS 13_4_1 like Mac OS X; en_us)"
+	get(apple, "bytes=0-1")
+	get(apple, "bytes=2-")
+	get(apple, "")
+	get("AntennaPod/2.0.1 (Android 10)", "")
+	get("Googlebot/2.1", "")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/channel/1/stats", nil))
+	assert.Equal(http.StatusOK, w.Code)
+
+	var got stats
+	err = json.Unmarshal(w.Body.Bytes(), &got)
+	assert.Nil(err)
+
+	today := time.Now().UTC().Format("2006-01-02")
+	assert.Equal(today, got.To)
+	assert.Equal([]store.DailyDownloads{
+		{Date: today, Podcast: p.ID, Title: "Episode", Downloads: 2},
+	}, got.Daily)
+	assert.Equal([]breakdown{
+		{Name: "AntennaPod", Downloads: 1},
+		{Name: "Apple Podcasts", Downloads: 1},
+	}, got.Apps)
+	assert.Equal([]breakdown{
+		{Name: "android", Downloads: 1},
+		{Name: "ios", Downloads: 1},
+	}, got.Platforms)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/channel/1/stats?from=yesterday", nil))
+	assert.Equal(http.StatusUnprocessableEntity, w.Code)
+
+	poll := func(ua string) {
+		r := httptest.NewRequest("GET", "/feed/news", nil)
+		r.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(http.StatusOK, w.Code)
+	}
+
+	poll("iTunes/12.10 (Macintosh; OS X 10.15.4)")
+	poll("AntennaPod/2.0.1 (Android 10)")
+	poll("AntennaPod/2.0.1 (Android 10)")
+	poll("Googlebot/2.1")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/channel/1/reports", nil))
+	assert.Equal(http.StatusOK, w.Code)
+
+	var rep report
+	err = json.Unmarshal(w.Body.Bytes(), &rep)
+	assert.Nil(err)
+
+	assert.Equal([]appReport{
+		{App: "AntennaPod", Downloads: 1, FeedPolls: 2},
+		{App: "Apple Podcasts", Downloads: 1, FeedPolls: 1},
+	}, rep.Apps)
+
+	poll("Feedly/1.0 (+http://www.feedly.com/fetcher.html; 40 subscribers; )")
+	poll("Feedly/1.0 (+http://www.feedly.com/fetcher.html; 42 subscribers; )")
+	poll("NewsBlur Feed Fetcher - 3 subscribers - http://www.newsblur.com")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/channel/1/subscribers?from="+today+"&to="+today, nil))
+	assert.Equal(http.StatusOK, w.Code)
+
+	var subs subscribers
+	err = json.Unmarshal(w.Body.Bytes(), &subs)
+	assert.Nil(err)
+
+	// iTunes and AntennaPod from the same IP are two subscribers, bot is skipped
+	assert.Equal([]dailySubscriber{
+		{Date: today, Subscribers: 47, Aggregators: 45, Direct: 2},
+	}, subs.Daily)
+
+	// period is limited
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"from=2023-01-01&to=2023-12-31", http.StatusOK},
+		{"from=2024-01-01&to=2024-12-31", http.StatusOK},
+		{"from=2023-01-01&to=2024-01-02", http.StatusUnprocessableEntity},
+		{"from=0001-01-01&to=9999-12-31", http.StatusUnprocessableEntity},
+		{"from=2024-01-02&to=2024-01-01", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/api/channel/1/subscribers?"+tt.query, nil))
+		assert.Equal(tt.status, w.Code, tt.query)
+	}
+	assert.Contains(w.Body.String(), `"code":"validation_failed"`)
+	assert.Contains(w.Body.String(), `"field":"from"`)
+}
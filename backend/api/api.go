@@ -1,15 +1,21 @@
 package api
 
 import (
-	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/config"
 	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/metrics"
+	"github.com/azzzak/fakecast/oidc"
 	"github.com/azzzak/fakecast/store"
+	"github.com/azzzak/fakecast/useragent"
 	"github.com/go-chi/chi"
 )
 
@@ -20,6 +26,18 @@ const (
 	CID ctxKey = iota + 1
 	// PID id of a podcast
 	PID
+	// RID id of a request
+	RID
+	// Account of user making a request
+	Account
+	// ChannelRole of account in channel of a request
+	ChannelRole
+	// APIToken of request made with token instead of password
+	APIToken
+	// Session of request made from web UI
+	Session
+
+	logKey
 )
 
 // Cfg configuration
@@ -28,22 +46,31 @@ type Cfg struct {
 	FS         fs.Dir
 	Host       string
 	Credential string
+	Users      []config.User
+	Auth       config.Auth
+	Feed       config.Feed
+	Server     config.Server
+	TLS        config.TLS
+	Metrics    config.Metrics
+	Audit      config.Audit
+	Trash      config.Trash
+
+	Log            *slog.Logger
+	TrustedProxies []*net.IPNet
+	Agents         *useragent.Classifier
+
+	salt     string
+	feeds    *feedCache
+	baseURL  string
+	oidc     *oidc.Provider
+	attempts *auth.Limiter
 }
 
 type hndlr func(http.ResponseWriter, *http.Request) error
 
 func (fn hndlr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err := fn(w, r); err != nil {
-		http.Error(w, "Error", http.StatusInternalServerError)
-
-		switch err.(type) {
-		case *store.Error:
-			fmt.Fprintf(os.Stderr, "Database error: %v\n", err)
-		case *fs.Error:
-			fmt.Fprintf(os.Stderr, "Filesystem error: %v\n", err)
-		default:
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		}
+		writeProblem(w, r, err)
 	}
 }
 
@@ -61,32 +88,71 @@ func credential(cred string) map[string]string {
 	return m
 }
 
+// RedirectHandler sends plain HTTP requests to HTTPS version of the host
+func RedirectHandler(host string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := url.URL{
+			Scheme:   "https",
+			Host:     r.Host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+
+		if base, err := url.Parse(host); err == nil && base.Host != "" {
+			target.Host = base.Host
+		}
+
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
+}
+
 // InitHandlers for API
 func InitHandlers(cfg *Cfg) *chi.Mux {
 	var baseURL string
 
 	base, err := url.Parse(cfg.Host)
 	if err != nil {
-		fmt.Println("HOST env variable is not valid URL")
+		cfg.logger().Error("HOST env variable is not valid URL", "err", err)
 		os.Exit(1)
 	}
 
 	if base.Path != "" {
 		baseURL = base.Path
 	}
+	cfg.baseURL = baseURL
+
+	if cfg.salt, err = cfg.loadSalt(); err != nil {
+		cfg.logger().Error("Can't load salt for analytics", "err", err)
+		os.Exit(1)
+	}
+
+	a := cfg.Auth.Attempts
+	cfg.attempts = auth.NewLimiter(a.Free, a.Backoff, a.Lockout)
+
+	if o := cfg.Auth.OIDC; o.Enabled() {
+		cfg.oidc = oidc.NewProvider(o.Issuer, o.ClientID, o.ClientSecret, strings.TrimSuffix(cfg.Host, "/")+"/api/oidc/callback", o.Scopes)
+	}
+
+	cfg.feeds = newFeedCache()
+	cfg.Store.OnChange(cfg.feeds.invalidate)
 
-	auth := void
-	if cfg.Credential != "" {
-		auth = basicAuth("auth", credential(cfg.Credential))
+	if err := cfg.syncUsers(); err != nil {
+		cfg.logger().Error("Can't create users", "err", err)
+		os.Exit(1)
 	}
 
 	r := chi.NewRouter()
 
-	r.Use(corsMiddleware().Handler)
+	r.Use(cfg.requestID)
+	r.Use(cfg.accessLog)
+	r.Use(cfg.measure)
+	r.Use(corsMiddleware(cfg.Server.AllowedOrigins).Handler)
+	r.Use(cfg.deadline)
+	r.Use(cfg.hsts)
 
 	workDir, err := os.Getwd()
 	if err != nil {
-		fmt.Println("Cant't get working directory")
+		cfg.logger().Error("Can't get working directory", "err", err)
 		os.Exit(1)
 	}
 
@@ -98,11 +164,18 @@ func InitHandlers(cfg *Cfg) *chi.Mux {
 		fs: http.Dir(cfg.FS.Root),
 	}
 
-	fileServer(r, "/"+strings.TrimPrefix(baseURL, "/"), guiDir)
+	fileServer(r.With(compress, precompressed(guiDir)), "/"+strings.TrimPrefix(baseURL, "/"), guiDir)
 
-	fileServer(r, baseURL+"/files", podcastsDir)
+	fileServer(r.With(cfg.stream, cfg.countFiles, cfg.recordDownloads), baseURL+"/files", podcastsDir)
 
-	r.Get(baseURL+"/feed/{channel}", hndlr(cfg.genFeed).ServeHTTP)
+	r.With(compress).Route(baseURL+"/feed", func(r chi.Router) {
+		r.Get("/{channel}", hndlr(cfg.genFeed).ServeHTTP)
+		r.Get("/{channel}.atom", cfg.feedAs(atomFormat, false).ServeHTTP)
+		r.Get("/{channel}.json", cfg.feedAs(jsonFormat, false).ServeHTTP)
+		r.Get("/{channel}/archive", hndlr(cfg.genArchive).ServeHTTP)
+		r.Get("/{channel}/archive.atom", cfg.feedAs(atomFormat, true).ServeHTTP)
+		r.Get("/{channel}/archive.json", cfg.feedAs(jsonFormat, true).ServeHTTP)
+	})
 
 	r.Get("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
 		robots := `User-agent: *
@@ -111,26 +184,86 @@ Disallow: /`
 		w.Write([]byte(robots))
 	})
 
-	r.With(auth).Route(baseURL+"/api", func(r chi.Router) {
-		r.Get("/list", hndlr(cfg.list).ServeHTTP)
+	if cfg.Metrics.Enabled {
+		cfg.registerGauges()
+
+		metricsAuth := cfg.authenticate
+		if cfg.Metrics.Credential != "" {
+			metricsAuth = cfg.basicAuth("metrics", credential(cfg.Metrics.Credential))
+		}
+
+		r.With(metricsAuth).Get(baseURL+"/metrics", metrics.Default.Handler().ServeHTTP)
+	}
+
+	viewer, uploader, editor, owner := require(auth.Viewer), require(auth.Uploader), require(auth.Editor), require(auth.Owner)
+
+	r.With(cfg.clientCert, compress).Route(baseURL+"/api", func(r chi.Router) {
+		r.Get("/login", hndlr(cfg.loginOptions).ServeHTTP)
+		r.Post("/login", hndlr(cfg.login).ServeHTTP)
+		r.Get("/oidc/login", hndlr(cfg.oidcLogin).ServeHTTP)
+		r.Get("/oidc/callback", hndlr(cfg.oidcCallback).ServeHTTP)
+
+		r.With(cfg.authenticate).Group(func(r chi.Router) {
+			r.With(viewer(auth.ChannelRead)).Get("/list", hndlr(cfg.list).ServeHTTP)
+
+			r.With(viewer()).Get("/me", hndlr(cfg.me).ServeHTTP)
+			r.With(viewer()).Put("/me", hndlr(cfg.updateMe).ServeHTTP)
+			r.With(viewer()).Post("/logout", hndlr(cfg.logout).ServeHTTP)
+
+			r.With(viewer()).Route("/sessions", func(r chi.Router) {
+				r.Get("/", hndlr(cfg.listSessions).ServeHTTP)
+				r.Delete("/{session}", hndlr(cfg.deleteSession).ServeHTTP)
+			})
+
+			r.With(viewer()).Route("/tokens", func(r chi.Router) {
+				r.Get("/", hndlr(cfg.listTokens).ServeHTTP)
+				r.Post("/", hndlr(cfg.createToken).ServeHTTP)
+				r.Delete("/{token}", hndlr(cfg.deleteToken).ServeHTTP)
+			})
+
+			r.With(owner()).Get("/audit", hndlr(cfg.listAudit).ServeHTTP)
+
+			r.With(owner()).Route("/trash", func(r chi.Router) {
+				r.Get("/", hndlr(cfg.listTrash).ServeHTTP)
+				r.Post("/{item}/restore", hndlr(cfg.restoreTrash).ServeHTTP)
+				r.Delete("/{item}", hndlr(cfg.purgeTrash).ServeHTTP)
+			})
+
+			r.With(owner()).Route("/users", func(r chi.Router) {
+				r.Get("/", hndlr(cfg.listUsers).ServeHTTP)
+				r.Post("/", hndlr(cfg.createUser).ServeHTTP)
+				r.Put("/{user}", hndlr(cfg.updateUser).ServeHTTP)
+				r.Delete("/{user}", hndlr(cfg.deleteUser).ServeHTTP)
+			})
+
+			r.Route("/channel", func(r chi.Router) {
+				r.With(editor(auth.ChannelWrite)).Post("/", hndlr(cfg.createChannel).ServeHTTP)
+
+				r.With(cfg.channelID).Route("/{channel}", func(r chi.Router) {
+					r.With(viewer(auth.ChannelRead)).Get("/", hndlr(cfg.overview).ServeHTTP)
+					r.With(editor(auth.ChannelWrite)).Put("/", hndlr(cfg.updateChannel).ServeHTTP)
+					r.With(editor(auth.ChannelWrite)).Delete("/", hndlr(cfg.deleteChannel).ServeHTTP)
+					r.With(viewer(auth.ChannelRead)).Get("/stats", hndlr(cfg.stats).ServeHTTP)
+					r.With(viewer(auth.ChannelRead)).Get("/reports", hndlr(cfg.reports).ServeHTTP)
+					r.With(viewer(auth.ChannelRead)).Get("/subscribers", hndlr(cfg.subscribers).ServeHTTP)
+					r.With(uploader(auth.EpisodeWrite), cfg.stream).Post("/upload", hndlr(cfg.uploadPodcast).ServeHTTP)
 
-		r.Route("/channel", func(r chi.Router) {
-			r.Post("/", hndlr(cfg.createChannel).ServeHTTP)
+					r.With(uploader(auth.ChannelWrite), cfg.stream).Post("/cover/upload", hndlr(cfg.uploadCover).ServeHTTP)
+					r.With(editor(auth.ChannelWrite)).Delete("/cover/{cover}", hndlr(cfg.deleteCover).ServeHTTP)
 
-			r.With(cfg.channelID).Route("/{channel}", func(r chi.Router) {
-				r.Get("/", hndlr(cfg.overview).ServeHTTP)
-				r.Put("/", hndlr(cfg.updateChannel).ServeHTTP)
-				r.Delete("/", hndlr(cfg.deleteChannel).ServeHTTP)
-				r.Post("/upload", hndlr(cfg.uploadPodcast).ServeHTTP)
+					r.With(viewer(auth.ChannelRead)).Get("/members", hndlr(cfg.listMembers).ServeHTTP)
+					r.With(owner()).Put("/members/{user}", hndlr(cfg.setMember).ServeHTTP)
+					r.With(owner()).Delete("/members/{user}", hndlr(cfg.deleteMember).ServeHTTP)
 
-				r.Post("/cover/upload", hndlr(cfg.uploadCover).ServeHTTP)
-				r.Delete("/cover/{cover}", hndlr(cfg.deleteCover).ServeHTTP)
+					r.Route("/podcast", func(r chi.Router) {
+						r.With(cfg.podcastID).Route("/{podcast}", func(r chi.Router) {
+							r.With(viewer(auth.EpisodeRead)).Get("/", hndlr(cfg.podcastInfo).ServeHTTP)
+							r.With(editor(auth.EpisodeWrite)).Put("/", hndlr(cfg.updatePodcast).ServeHTTP)
+							r.With(editor(auth.EpisodeWrite)).Delete("/", hndlr(cfg.deletePodcast).ServeHTTP)
 
-				r.Route("/podcast", func(r chi.Router) {
-					r.With(cfg.podcastID).Route("/{podcast}", func(r chi.Router) {
-						r.Get("/", hndlr(cfg.podcastInfo).ServeHTTP)
-						r.Put("/", hndlr(cfg.updatePodcast).ServeHTTP)
-						r.Delete("/", hndlr(cfg.deletePodcast).ServeHTTP)
+							r.With(uploader(auth.EpisodeWrite), cfg.stream).Post("/artwork", hndlr(cfg.uploadArtwork).ServeHTTP)
+							r.With(editor(auth.EpisodeWrite)).Delete("/artwork", hndlr(cfg.deleteArtwork).ServeHTTP)
+						})
 					})
 				})
 			})
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,3 +35,32 @@ func TestCredential(t *testing.T) {
 		})
 	}
 }
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		target string
+		want   string
+	}{
+		{
+			name:   "host",
+			host:   "https://example.com",
+			target: "http://example.com/feed/news?x=1",
+			want:   "https://example.com/feed/news?x=1",
+		}, {
+			name:   "host with port",
+			host:   "https://example.com:8443/base",
+			target: "http://localhost/base/api/list",
+			want:   "https://example.com:8443/base/api/list",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			RedirectHandler(tt.host).ServeHTTP(w, httptest.NewRequest("GET", tt.target, nil))
+			assert.Equal(t, http.StatusMovedPermanently, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+)
+
+type artwork struct {
+	Artwork string `json:"artwork"`
+}
+
+// artworkPrefix of episode image in channel's cover directory. Episode id
+// keeps it apart from channel cover and images of other episodes
+func artworkPrefix(pid int64) string {
+	return fmt.Sprintf("%d-", pid)
+}
+
+func setArtworkURL(cfg *Cfg, alias string, p *store.Podcast) {
+	if p.Artwork != "" {
+		p.Artwork = strings.Join([]string{cfg.Host, "files", alias, fs.CoverDirName, p.Artwork}, "/")
+	}
+}
+
+func (cfg *Cfg) uploadArtwork(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
+	pid := r.Context().Value(PID).(int64)
+
+	short, err := cfg.Store.SwapCIDForAlias(cid)
+	if err != nil {
+		return err
+	}
+
+	p, err := cfg.Store.PodcastInfo(pid)
+	if err != nil {
+		return err
+	}
+
+	name, err := cfg.saveCover(w, r, "artwork", short, artworkPrefix(pid))
+	if err != nil || name == "" {
+		return err
+	}
+
+	old := p.Artwork
+	p.Artwork = name
+	if err = cfg.Store.UpdatePodcast(p); err != nil {
+		return err
+	}
+
+	cfg.record(r, "artwork.upload", podcastTarget(pid), cid, artwork{Artwork: old}, artwork{Artwork: name})
+
+	if old != "" && old != name {
+		if err := cfg.removeCover(short, old); err != nil {
+			logger(r).Warn("previous artwork is not removed", "err", err)
+		}
+	}
+
+	setArtworkURL(cfg, short, p)
+
+	output := artwork{
+		Artwork: p.Artwork,
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(output); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cfg *Cfg) deleteArtwork(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
+	pid := r.Context().Value(PID).(int64)
+
+	short, err := cfg.Store.SwapCIDForAlias(cid)
+	if err != nil {
+		return err
+	}
+
+	p, err := cfg.Store.PodcastInfo(pid)
+	if err != nil {
+		return err
+	}
+
+	if p.Artwork == "" {
+		return nil
+	}
+
+	name := p.Artwork
+	p.Artwork = ""
+	if err = cfg.Store.UpdatePodcast(p); err != nil {
+		return err
+	}
+
+	cfg.record(r, "artwork.delete", podcastTarget(pid), cid, artwork{Artwork: name}, nil)
+
+	err = cfg.removeCover(short, name)
+	if errors.Is(err, fs.ErrCoverName) {
+		logger(r).Warn("artwork is not removed", "err", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/coverart"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtwork(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	root := fs.NewRoot(testDir)
+
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    root,
+		Host:  "http://localhost",
+	})
+
+	cid, err := s.AddChannel()
+	assert.Nil(err)
+
+	c, err := s.ChannelInfo(cid)
+	assert.Nil(err)
+	c.Alias = "news"
+	c.Cover = "cover.jpg"
+	err = s.UpdateChannel(c)
+	assert.Nil(err)
+
+	err = os.MkdirAll(filepath.Join(root.Root, "news", fs.CoverDirName), os.ModePerm)
+	assert.Nil(err)
+
+	var pids []int64
+	for i := 1; i <= 2; i++ {
+		filename := fmt.Sprintf("episode%d.mp3", i)
+		p, err := s.AddPodcastToChannel(cid, filename, filename, 10)
+		assert.Nil(err)
+		pids = append(pids, p.ID)
+		err = ioutil.WriteFile(filepath.Join(root.Root, "news", filename), []byte("audio"), 0644)
+		assert.Nil(err)
+	}
+
+	upload := func(pid int64, image []byte) *httptest.ResponseRecorder {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", "art.png")
+		assert.Nil(err)
+		part.Write(image)
+		err = writer.Close()
+		assert.Nil(err)
+
+		r := httptest.NewRequest("POST", fmt.Sprintf("/api/channel/%d/podcast/%d/artwork", cid, pid), body)
+		r.Header.Add("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	artworkPath := func(name string) string {
+		return filepath.Join(root.Root, "news", fs.CoverDirName, name)
+	}
+
+	artworkOf := func(pid int64) string {
+		p, err := s.PodcastInfo(pid)
+		assert.Nil(err)
+		return p.Artwork
+	}
+
+	w := upload(pids[0], testCover(t, 1600, 1600))
+	assert.Equal(http.StatusOK, w.Code)
+	old := artworkOf(pids[0])
+	assert.Regexp(fmt.Sprintf(`^%d-[0-9a-f]{16}\.jpg$`, pids[0]), old)
+	assert.FileExists(artworkPath(old))
+
+	// new upload replaces previous image
+	w = upload(pids[0], testCover(t, 1400, 1400))
+	assert.Equal(http.StatusOK, w.Code)
+	name := artworkOf(pids[0])
+	assert.NotEqual(old, name)
+	assert.NoFileExists(artworkPath(old))
+	assert.FileExists(artworkPath(name))
+	for _, v := range coverart.Variants(old) {
+		assert.NoFileExists(artworkPath(v))
+	}
+
+	var out artwork
+	err = json.NewDecoder(w.Body).Decode(&out)
+	assert.Nil(err)
+	artworkURL := "http://localhost/files/news/cover/" + name
+	assert.Equal(artworkURL, out.Artwork)
+
+	w = upload(pids[0], []byte("not an image"))
+	assert.Equal(http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(name, artworkOf(pids[0]))
+
+	// other episode falls back to channel cover
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/feed/news", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `<itunes:image href="`+artworkURL+`"></itunes:image>`)
+	assert.Contains(w.Body.String(), `<itunes:image href="http://localhost/files/news/cover/cover.jpg"></itunes:image><itunes:duration>`)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", fmt.Sprintf("/api/channel/%d/podcast/%d/artwork", cid, pids[0]), nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NoFileExists(artworkPath(name))
+	assert.Empty(artworkOf(pids[0]))
+
+	// artwork is removed with its episode
+	w = upload(pids[1], testCover(t, 1400, 1400))
+	assert.Equal(http.StatusOK, w.Code)
+	name = artworkOf(pids[1])
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", fmt.Sprintf("/api/channel/%d/podcast/%d", cid, pids[1]), nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NoFileExists(artworkPath(name))
+	for _, v := range coverart.Variants(name) {
+		assert.NoFileExists(artworkPath(v))
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// attemptKeys of login from request as user. Address is limited for
+// guessing many users, user name for guessing from many addresses
+func (cfg *Cfg) attemptKeys(r *http.Request, name string) []string {
+	keys := []string{"ip:" + cfg.clientIP(r)}
+	if name != "" {
+		keys = append(keys, "user:"+name)
+	}
+	return keys
+}
+
+// blocked attempt of login is answered with 429, so its password is not
+// even checked
+func (cfg *Cfg) blocked(w http.ResponseWriter, r *http.Request, method, name string) bool {
+	var wait time.Duration
+	for _, key := range cfg.attemptKeys(r, name) {
+		if d := cfg.attempts.Wait(key); d > wait {
+			wait = d
+		}
+	}
+	if wait == 0 {
+		return false
+	}
+
+	cfg.audit(r, slog.LevelWarn, "login.blocked", "method", method, "user", name, "retry_after", wait.String())
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeProblem(w, r, newProblem(http.StatusTooManyRequests, "too_many_attempts", "Too many failed attempts"))
+	return true
+}
+
+// failed attempt of login
+func (cfg *Cfg) failed(r *http.Request, method, name, reason string) {
+	for _, key := range cfg.attemptKeys(r, name) {
+		cfg.attempts.Fail(key)
+	}
+	cfg.audit(r, slog.LevelWarn, "login.failed", "method", method, "user", name, "reason", reason)
+}
+
+// succeeded attempt of login clears failures of user, though not of address
+func (cfg *Cfg) succeeded(r *http.Request, name string) {
+	cfg.attempts.Reset("user:" + name)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttempts(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	assert.Nil(err)
+
+	var buf bytes.Buffer
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "http://localhost",
+		Users: []config.User{
+			{Name: "ed", Password: "pass", Role: "editor"},
+			{Name: "vi", Password: "pass", Role: "viewer"},
+		},
+		Auth: config.Auth{
+			Attempts: config.Attempts{Free: 2, Backoff: time.Minute, Lockout: time.Hour},
+		},
+		Metrics: config.Metrics{Enabled: true, Credential: "prometheus:secret"},
+
+		Log:            slog.New(slog.NewJSONHandler(&buf, nil)),
+		TrustedProxies: []*net.IPNet{proxies},
+	})
+
+	do := func(ip, user, pass string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/me", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", ip)
+		r.SetBasicAuth(user, pass)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(http.StatusUnauthorized, do("203.0.113.1", "ed", "wrong").Code)
+	}
+
+	// blocked even with right password
+	w := do("203.0.113.1", "ed", "pass")
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("60", w.Header().Get("Retry-After"))
+
+	// user is blocked from any address, address for any user
+	assert.Equal(http.StatusTooManyRequests, do("203.0.113.2", "ed", "pass").Code)
+	assert.Equal(http.StatusTooManyRequests, do("203.0.113.1", "vi", "pass").Code)
+	assert.Equal(http.StatusOK, do("203.0.113.2", "vi", "pass").Code)
+
+	// unknown users are limited too
+	for i := 0; i < 3; i++ {
+		assert.Equal(http.StatusUnauthorized, do("203.0.113.3", fmt.Sprintf("user%d", i), "pass").Code)
+	}
+	assert.Equal(http.StatusTooManyRequests, do("203.0.113.3", "vi", "pass").Code)
+
+	// metrics credential as well
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.RemoteAddr = "203.0.113.4:1234"
+		r.SetBasicAuth("prometheus", "wrong")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(http.StatusUnauthorized, w.Code)
+	}
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.RemoteAddr = "203.0.113.4:1234"
+	r.SetBasicAuth("prometheus", "secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+
+	log := buf.String()
+	assert.Equal(9, strings.Count(log, `"action":"login.failed"`))
+	assert.Contains(log, `"ip":"203.0.113.1","method":"basic","user":"ed","reason":"wrong password"`)
+	assert.Contains(log, `"reason":"unknown user"`)
+	assert.Contains(log, `"action":"login.blocked"`)
+}
+
+func TestEqual(t *testing.T) {
+	assert.Equal(t, 1, equal("secret", "secret"))
+	assert.Equal(t, 0, equal("secret", "Secret"))
+	assert.Equal(t, 0, equal("secret", "secret2"))
+	assert.Equal(t, 1, equal("", ""))
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/azzzak/fakecast/store"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// derivedFields change on their own, so they are left out of audit
+var derivedFields = map[string]bool{
+	"last_modified": true,
+	"thumbnail":     true,
+	"last_used":     true,
+}
+
+type change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// audit event of request, like failed login. It's written to log along
+// with address of client
+func (cfg *Cfg) audit(r *http.Request, level slog.Level, action string, args ...interface{}) {
+	attrs := append([]interface{}{"action", action, "ip", cfg.clientIP(r)}, args...)
+	logger(r).Log(r.Context(), level, "audit", attrs...)
+}
+
+// record change of target made by request. It's kept in store and written
+// to log. Request doesn't fail if record is not saved
+func (cfg *Cfg) record(r *http.Request, action, target string, cid int64, before, after interface{}) {
+	u := account(r)
+
+	rec := &store.AuditRecord{
+		Actor:     u.ID,
+		ActorName: u.Name,
+		Action:    action,
+		Target:    target,
+		Channel:   cid,
+		Changes:   changes(before, after),
+		IP:        cfg.clientIP(r),
+	}
+	if err := cfg.Store.AddAuditRecord(rec); err != nil {
+		logger(r).Error("audit record is not saved", "action", action, "target", target, "err", err)
+	}
+
+	cfg.audit(r, slog.LevelInfo, action, "target", target, "user", u.Name)
+}
+
+func channelTarget(cid int64) string {
+	return "channel:" + strconv.FormatInt(cid, 10)
+}
+
+func podcastTarget(pid int64) string {
+	return "podcast:" + strconv.FormatInt(pid, 10)
+}
+
+func userTarget(uid int64) string {
+	return "user:" + strconv.FormatInt(uid, 10)
+}
+
+func tokenTarget(id int64) string {
+	return "token:" + strconv.FormatInt(id, 10)
+}
+
+// changes of fields between states of entity as they look in JSON. Nil
+// state is one of created or deleted entity
+func changes(before, after interface{}) json.RawMessage {
+	b, a := fields(before), fields(after)
+
+	keys := []string{}
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diff := map[string]change{}
+	for _, k := range keys {
+		if derivedFields[k] || reflect.DeepEqual(b[k], a[k]) {
+			continue
+		}
+		diff[k] = change{Before: b[k], After: a[k]}
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+
+	out, err := json.Marshal(diff)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func fields(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return m
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(data, &m)
+	return m
+}
+
+// auditTime of query is RFC 3339 time or date
+func auditTime(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", v); err != nil {
+			return 0, err
+		}
+	}
+	return t.Unix(), nil
+}
+
+func auditFilter(r *http.Request) (store.AuditFilter, error) {
+	q := r.URL.Query()
+
+	f := store.AuditFilter{
+		Actor:  q.Get("user"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+		Limit:  defaultAuditLimit,
+	}
+
+	invalid := func(field, msg string) error {
+		return errInvalid("Invalid filter", fieldError{Field: field, Message: msg})
+	}
+
+	var err error
+	if f.Since, err = auditTime(q.Get("since")); err != nil {
+		return f, invalid("since", "must be RFC 3339 time or date")
+	}
+	if f.Until, err = auditTime(q.Get("until")); err != nil {
+		return f, invalid("until", "must be RFC 3339 time or date")
+	}
+
+	nums := map[string]*int64{
+		"channel": &f.Channel,
+		"before":  &f.Before,
+	}
+	for key, field := range nums {
+		if v := q.Get(key); v != "" {
+			if *field, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return f, invalid(key, "must be number")
+			}
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return f, invalid("limit", "must be number")
+		}
+		if f.Limit <= 0 || f.Limit > maxAuditLimit {
+			f.Limit = maxAuditLimit
+		}
+	}
+
+	return f, nil
+}
+
+func (cfg *Cfg) listAudit(w http.ResponseWriter, r *http.Request) error {
+	f, err := auditFilter(r)
+	if err != nil {
+		return err
+	}
+
+	recs, err := cfg.Store.AuditRecords(f)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(recs); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   string
+	}{
+		{
+			name:   "same",
+			before: &store.Channel{ID: 1, Title: "Show"},
+			after:  &store.Channel{ID: 1, Title: "Show", LastModified: 100},
+			want:   "",
+		}, {
+			name:   "update",
+			before: &store.Channel{ID: 1, Title: "Show", Alias: "show"},
+			after:  &store.Channel{ID: 1, Title: "News", Alias: "show"},
+			want:   `{"title":{"before":"Show","after":"News"}}`,
+		}, {
+			name:   "create",
+			before: nil,
+			after:  cover{Cover: "a.jpg"},
+			want:   `{"cover":{"before":null,"after":"a.jpg"}}`,
+		}, {
+			name:   "delete",
+			before: &store.Podcast{ID: 2, Title: "Episode"},
+			after:  (*store.Podcast)(nil),
+			want:   `{"artwork":{"before":"","after":null},"explicit":{"before":0,"after":null},"filename":{"before":"","after":null},"id":{"before":2,"after":null},"length":{"before":0,"after":null},"published":{"before":0,"after":null},"title":{"before":"Episode","after":null}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(changes(tt.before, tt.after)))
+		})
+	}
+}
+
+func TestAudit(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cfg := &Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "http://localhost",
+		Users: []config.User{
+			{Name: "admin", Password: "pass", Role: "owner"},
+			{Name: "ann", Password: "pass", Role: "editor"},
+		},
+		Audit: config.Audit{Retention: time.Hour},
+	}
+	h := InitHandlers(cfg)
+
+	do := func(user, method, path string, body interface{}) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		r := httptest.NewRequest(method, path, &b)
+		r.SetBasicAuth(user, "pass")
+		r.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	audit := func(query string) []store.AuditRecord {
+		w := do("admin", "GET", "/api/audit"+query, nil)
+		assert.Equal(http.StatusOK, w.Code)
+		var recs []store.AuditRecord
+		err := json.NewDecoder(w.Body).Decode(&recs)
+		assert.Nil(err)
+		return recs
+	}
+
+	var c store.Channel
+	w := do("ann", "POST", "/api/channel", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&c)
+
+	path := fmt.Sprintf("/api/channel/%d", c.ID)
+	assert.Equal(http.StatusOK, do("ann", "PUT", path, updateChannel{Channel: &store.Channel{Title: "Show", Alias: "show"}}).Code)
+	assert.Equal(http.StatusOK, do("admin", "DELETE", path, nil).Code)
+
+	recs := audit("")
+	assert.Len(recs, 3)
+	assert.Equal("channel.delete", recs[0].Action)
+	assert.Equal("admin", recs[0].ActorName)
+	assert.Equal("channel.create", recs[2].Action)
+
+	update := recs[1]
+	assert.Equal("channel.update", update.Action)
+	assert.Equal("ann", update.ActorName)
+	assert.Equal(fmt.Sprintf("channel:%d", c.ID), update.Target)
+	assert.Equal(c.ID, update.Channel)
+	assert.Equal("10.0.0.1", update.IP)
+	assert.JSONEq(fmt.Sprintf(`{"alias":{"before":"%d","after":"show"},"title":{"before":"New channel %d","after":"Show"}}`, c.ID, c.ID), string(update.Changes))
+
+	assert.Len(audit("?user=ann"), 2)
+	assert.Len(audit("?action=channel.delete"), 1)
+	assert.Len(audit(fmt.Sprintf("?channel=%d&limit=1", c.ID)), 1)
+	assert.Len(audit(fmt.Sprintf("?before=%d", update.ID)), 1)
+	assert.Len(audit("?since="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)), 0)
+
+	assert.Equal(http.StatusUnprocessableEntity, do("admin", "GET", "/api/audit?since=yesterday", nil).Code)
+	assert.Equal(http.StatusForbidden, do("ann", "GET", "/api/audit", nil).Code)
+
+	// records within retention are kept
+	cfg.housekeep()
+	assert.Len(audit(""), 3)
+}
+
+func TestAuditAccounts(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "http://localhost",
+		Users: []config.User{{Name: "admin", Password: "pass", Role: "owner"}},
+	})
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		r := httptest.NewRequest(method, path, &b)
+		r.SetBasicAuth("admin", "pass")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	audit := func(query string) []store.AuditRecord {
+		w := do("GET", "/api/audit"+query, nil)
+		assert.Equal(http.StatusOK, w.Code)
+		var recs []store.AuditRecord
+		err := json.NewDecoder(w.Body).Decode(&recs)
+		assert.Nil(err)
+		return recs
+	}
+
+	var bob store.User
+	w := do("POST", "/api/users", userRequest{Name: "bob", Password: "secret", Role: "editor"})
+	assert.Equal(http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&bob)
+	user := fmt.Sprintf("/api/users/%d", bob.ID)
+	assert.Equal(http.StatusOK, do("PUT", user, userRequest{Role: "viewer", Password: "other"}).Code)
+
+	var c store.Channel
+	w = do("POST", "/api/channel", nil)
+	json.NewDecoder(w.Body).Decode(&c)
+	member := fmt.Sprintf("/api/channel/%d/members/%d", c.ID, bob.ID)
+	assert.Equal(http.StatusOK, do("PUT", member, memberRequest{Role: "uploader"}).Code)
+	assert.Equal(http.StatusOK, do("PUT", member, memberRequest{Role: "editor"}).Code)
+	assert.Equal(http.StatusOK, do("DELETE", member, nil).Code)
+	assert.Equal(http.StatusOK, do("DELETE", user, nil).Code)
+
+	recs := audit(fmt.Sprintf("?target=user:%d", bob.ID))
+	if assert.Len(recs, 6) {
+		assert.Equal("user.delete", recs[0].Action)
+		assert.Equal("member.delete", recs[1].Action)
+		assert.Equal(c.ID, recs[1].Channel)
+		assert.JSONEq(`{"role":{"before":"uploader","after":"editor"}}`, string(recs[2].Changes))
+		assert.Equal("member.set", recs[3].Action)
+		assert.Contains(string(recs[3].Changes), `"role":{"before":null,"after":"uploader"}`)
+		assert.JSONEq(`{"password":{"before":null,"after":"changed"},"role":{"before":"editor","after":"viewer"}}`, string(recs[4].Changes))
+		assert.Equal("user.create", recs[5].Action)
+		assert.Equal("admin", recs[5].ActorName)
+		assert.Contains(string(recs[5].Changes), `"name":{"before":null,"after":"bob"}`)
+	}
+	for _, rec := range recs {
+		assert.NotContains(string(rec.Changes), "secret")
+		assert.NotContains(string(rec.Changes), "other")
+	}
+
+	var tr tokenResponse
+	w = do("POST", "/api/tokens", tokenRequest{Name: "ci", Scopes: []string{"channel:read"}})
+	assert.Equal(http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&tr)
+	assert.Equal(http.StatusOK, do("DELETE", fmt.Sprintf("/api/tokens/%d", tr.ID), nil).Code)
+
+	recs = audit(fmt.Sprintf("?target=token:%d", tr.ID))
+	if assert.Len(recs, 2) {
+		assert.Equal("token.delete", recs[0].Action)
+		assert.Equal("token.create", recs[1].Action)
+		assert.Contains(string(recs[1].Changes), `"name":{"before":null,"after":"ci"}`)
+		assert.NotContains(string(recs[1].Changes), tr.Value)
+	}
+}
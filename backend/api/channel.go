@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/azzzak/fakecast/auth"
 	"github.com/azzzak/fakecast/store"
 )
 
@@ -19,8 +21,9 @@ type updateChannel struct {
 }
 
 type updateResponse struct {
-	Cover string `json:"cover"`
-	Error bool   `json:"error,omitempty"`
+	Cover     string `json:"cover"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Error     bool   `json:"error,omitempty"`
 }
 
 func checkChannels(cfg *Cfg, cs []store.Channel) []store.Channel {
@@ -60,28 +63,47 @@ func checkPodcasts(cfg *Cfg, alias string, ps []store.Podcast) []store.Podcast {
 }
 
 func (cfg *Cfg) createChannel(w http.ResponseWriter, r *http.Request) error {
-	cid, err := cfg.Store.AddChannel()
-	if err != nil {
-		return err
+	// token of one channel can't make another
+	if t := apiToken(r); t != nil && t.Channel != 0 {
+		return errForbidden("Token is restricted to one channel")
 	}
 
-	if err = cfg.FS.CreateDir(cid); err != nil {
-		return err
-	}
+	var c *store.Channel
 
-	c, err := cfg.Store.ChannelInfo(cid)
-	if err != nil {
-		return err
-	}
+	// channel is never left without its owner
+	err := cfg.Store.WithTx(func(tx *store.Store) error {
+		cid, err := tx.AddChannel()
+		if err != nil {
+			return err
+		}
 
-	c.ID = cid
-	c.Title = fmt.Sprintf("New channel %d", cid)
-	c.Alias = fmt.Sprintf("%d", cid)
+		if c, err = tx.ChannelInfo(cid); err != nil {
+			return err
+		}
+
+		c.ID = cid
+		c.Title = fmt.Sprintf("New channel %d", cid)
+		c.Alias = fmt.Sprintf("%d", cid)
+
+		if err = tx.UpdateChannel(c); err != nil {
+			return err
+		}
 
-	if err = cfg.Store.UpdateChannel(c); err != nil {
+		// creator owns the channel, so keeps access to it
+		if u := account(r); u.ID != 0 && u.Role != string(auth.Owner) {
+			if err = tx.SetMember(cid, u.ID, string(auth.Owner)); err != nil {
+				return err
+			}
+		}
+
+		return cfg.FS.CreateDir(cid)
+	})
+	if err != nil {
 		return err
 	}
 
+	cfg.record(r, "channel.create", channelTarget(c.ID), c.ID, nil, c)
+
 	encoder := json.NewEncoder(w)
 	if err := encoder.Encode(c); err != nil {
 		return err
@@ -90,6 +112,27 @@ func (cfg *Cfg) createChannel(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// membersOnly channels of account if it's not an owner of admin area
+func (cfg *Cfg) membersOnly(u *store.User, cs []store.Channel) ([]store.Channel, error) {
+	if u.Role == string(auth.Owner) {
+		return cs, nil
+	}
+
+	roles, err := cfg.Store.RolesOf(u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []store.Channel{}
+	for _, c := range cs {
+		if _, ok := roles[c.ID]; ok {
+			visible = append(visible, c)
+		}
+	}
+
+	return visible, nil
+}
+
 func (cfg *Cfg) list(w http.ResponseWriter, r *http.Request) error {
 	cs, err := cfg.Store.ListChannels()
 	if err != nil {
@@ -98,6 +141,12 @@ func (cfg *Cfg) list(w http.ResponseWriter, r *http.Request) error {
 
 	cs = checkChannels(cfg, cs)
 
+	cs, err = cfg.membersOnly(account(r), cs)
+	if err != nil {
+		return err
+	}
+	cs = tokenChannelOnly(apiToken(r), cs)
+
 	encoder := json.NewEncoder(w)
 	if err := encoder.Encode(cs); err != nil {
 		return err
@@ -142,13 +191,32 @@ func (cfg *Cfg) updateChannel(w http.ResponseWriter, r *http.Request) error {
 
 	var out interface{}
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&u); err != nil {
+	if err := decodeJSON(r, &u); err != nil {
 		return err
 	}
+	if u == nil || u.Channel == nil {
+		return errInvalid("Invalid channel", fieldError{Field: "channel", Message: "is required"})
+	}
+
+	// channel of URL is checked against membership, not the one of body
+	c, err := cfg.Store.ChannelInfo(r.Context().Value(CID).(int64))
+	if err != nil {
+		return err
+	}
+	u.Channel.ID = c.ID
+	u.OldAlias = c.Alias
+
+	// cover is set by its upload only
+	u.Channel.Cover = c.Cover
 
 	var aliasError bool
 
+	// dot names are kept for trash and never served
+	if strings.HasPrefix(u.Channel.Alias, ".") {
+		u.Channel.Alias = u.OldAlias
+		aliasError = true
+	}
+
 	if u.Channel.Alias != u.OldAlias {
 		err := cfg.FS.RenameDir(u.OldAlias, u.Channel.Alias)
 		if err != nil {
@@ -157,18 +225,25 @@ func (cfg *Cfg) updateChannel(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	err := cfg.Store.UpdateChannel(u.Channel)
+	err = cfg.Store.UpdateChannel(u.Channel)
 	if err != nil {
 		return err
 	}
 
+	after, err := cfg.Store.ChannelInfo(c.ID)
+	if err != nil {
+		return err
+	}
+	cfg.record(r, "channel.update", channelTarget(c.ID), c.ID, c, after)
+
 	if u.Channel.Cover != "" {
 		setCoverURL(cfg, u.Channel)
 	}
 
 	out = updateResponse{
-		Cover: u.Channel.Cover,
-		Error: aliasError,
+		Cover:     u.Channel.Cover,
+		Thumbnail: u.Channel.Thumbnail,
+		Error:     aliasError,
 	}
 
 	encoder := json.NewEncoder(w)
@@ -182,18 +257,36 @@ func (cfg *Cfg) updateChannel(w http.ResponseWriter, r *http.Request) error {
 func (cfg *Cfg) deleteChannel(w http.ResponseWriter, r *http.Request) error {
 	cid := r.Context().Value(CID).(int64)
 
-	alias, err := cfg.Store.SwapCIDForAlias(cid)
+	c, err := cfg.Store.ChannelInfo(cid)
 	if err != nil {
 		return err
 	}
 
-	if err = cfg.Store.DeleteChannel(cid); err != nil {
-		return err
-	}
-
-	if err = cfg.FS.RemoveDir(alias); err != nil {
+	// files are moved within transaction, so channel is never in trash
+	// while its dir is live, or the other way round
+	var (
+		t     *store.TrashItem
+		moved bool
+	)
+	err = cfg.Store.WithTx(func(tx *store.Store) error {
+		if t, err = tx.TrashChannel(cid, account(r).Name); err != nil {
+			return err
+		}
+		if err = cfg.FS.TrashDir(t.Path(), c.Alias); err != nil {
+			return err
+		}
+		moved = true
+		return nil
+	})
+	if err != nil {
+		if moved {
+			if _, err := cfg.FS.Restore(t.Path(), c.Alias); err != nil {
+				logger(r).Error("channel dir is not moved back", "err", err)
+			}
+		}
 		return err
 	}
 
+	cfg.record(r, "channel.delete", channelTarget(cid), cid, c, nil)
 	return nil
 }
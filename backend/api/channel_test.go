@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -200,7 +201,7 @@ func TestCheckPodcasts(t *testing.T) {
 			defer os.RemoveAll(filepath.Join(root.Root, c.Alias))
 
 			for i := 1; i < 4; i++ {
-				_, err := s.AddPodcastToChannel(c.ID, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), fmt.Sprintf("1000%d", i))
+				_, err := s.AddPodcastToChannel(c.ID, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), int64(10000+i))
 				assert.Nil(err)
 
 				_, err = os.Create(filepath.Join(testDir, fs.PodcastsDirName, c.Alias, fmt.Sprintf("podcast%d.mp3", i)))
@@ -289,6 +290,9 @@ func TestCreateChannel(t *testing.T) {
 					Title: fmt.Sprintf("New channel %d", i),
 				}
 
+				assert.NotZero(c.LastModified)
+				c.LastModified = 0
+
 				assert.Equal(tc, c)
 			}
 		})
@@ -485,7 +489,7 @@ func TestOverview(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			for i := 1; i <= tt.n; i++ {
-				_, err := s.AddPodcastToChannel(c.ID, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), fmt.Sprintf("1000%d", i))
+				_, err := s.AddPodcastToChannel(c.ID, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), int64(10000+i))
 				assert.Nil(err)
 
 				_, err = os.Create(filepath.Join(testDir, fs.PodcastsDirName, c.Alias, fmt.Sprintf("podcast%d.mp3", i)))
@@ -526,6 +530,9 @@ func TestOverview(t *testing.T) {
 			err = decoder.Decode(&o)
 			assert.Nil(err)
 
+			assert.NotZero(o.Channel.LastModified)
+			o.Channel.LastModified = 0
+
 			assert.Equal(tt.want, o)
 		})
 	}
@@ -575,6 +582,11 @@ func TestUpdateChannel(t *testing.T) {
 			assert.Nil(err)
 			assert.Equal(int64(1), c.ID)
 
+			// the way createChannel names it
+			c.Alias = "1"
+			err = s.UpdateChannel(c)
+			assert.Nil(err)
+
 			c.Alias = "update alias"
 			c.Title = "update channel"
 			c.Description = "new desc"
@@ -592,6 +604,15 @@ func TestUpdateChannel(t *testing.T) {
 			jsonStr, err := json.Marshal(u)
 			assert.Nil(err)
 
+			// body without channel is rejected, not dereferenced
+			for _, body := range []string{"null", "{}"} {
+				r := httptest.NewRequest("PUT", "/api/channel/1", strings.NewReader(body))
+				w := httptest.NewRecorder()
+				InitHandlers(cfg).ServeHTTP(w, r)
+				assert.Equal(http.StatusUnprocessableEntity, w.Code, body)
+				assert.Contains(w.Body.String(), `"field":"channel"`, body)
+			}
+
 			if tt.wantErr {
 				err := s.DropChannels()
 				assert.Nil(err)
@@ -626,12 +647,13 @@ func TestUpdateChannel(t *testing.T) {
 				Alias:       "update alias",
 				Title:       "update channel",
 				Description: "new desc",
-				Cover:       "cover.png",
 				Author:      "user",
 			}
 
 			info, err := s.ChannelInfo(1)
 			assert.Nil(err)
+			assert.NotZero(info.LastModified)
+			info.LastModified = 0
 			assert.Equal(want, info)
 		})
 	}
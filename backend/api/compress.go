@@ -0,0 +1,273 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-chi/chi"
+)
+
+// compressMinSize is a size of response too small to benefit from compression
+const compressMinSize = 512
+
+// encodings supported in order of preference
+var encodings = []string{"br", "gzip"}
+
+// precompressedExt of static assets built with compressed copies
+var precompressedExt = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/feed+json",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/javascript",
+	"application/manifest+json",
+	"image/svg+xml",
+}
+
+var (
+	gzipPool = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}}
+	brotliPool = sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, 5)
+	}}
+)
+
+// qvalues of values listed in Accept-like header
+func qvalues(header string) map[string]float64 {
+	q := map[string]float64{}
+
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+
+		weight := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					weight = v
+				}
+			}
+		}
+
+		q[name] = weight
+	}
+
+	return q
+}
+
+// acceptEncodings from Accept-Encoding header, the most preferred first
+func acceptEncodings(header string) []string {
+	q := qvalues(header)
+
+	if wildcard, ok := q["*"]; ok {
+		for _, enc := range encodings {
+			if _, ok := q[enc]; !ok {
+				q[enc] = wildcard
+			}
+		}
+	}
+
+	var accepted []string
+	for _, enc := range encodings {
+		if q[enc] > 0 {
+			accepted = append(accepted, enc)
+		}
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return q[accepted[i]] > q[accepted[j]]
+	})
+
+	return accepted
+}
+
+func compressible(contentType string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// compress responses with the encoding client prefers. Audio from /files
+// is never passed through it, so Range requests keep working there
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		accepted := acceptEncodings(r.Header.Get("Accept-Encoding"))
+		if len(accepted) == 0 || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: accepted[0]}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	decided  bool
+	w        io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if !cw.decided {
+		cw.decide(code)
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		// content type has to be known before body is compressed
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.decide(http.StatusOK)
+	}
+
+	if cw.w != nil {
+		return cw.w.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide whether response is worth compressing once its headers are known
+func (cw *compressWriter) decide(code int) {
+	cw.decided = true
+	h := cw.Header()
+
+	switch {
+	case code < http.StatusOK, code == http.StatusNoContent, code == http.StatusPartialContent, code == http.StatusNotModified:
+		return
+	case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		return
+	case !compressible(h.Get("Content-Type")):
+		return
+	}
+
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < compressMinSize {
+		return
+	}
+
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+
+	// compressed body is not byte-for-byte the same representation
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+
+	switch cw.encoding {
+	case "br":
+		bw := brotliPool.Get().(*brotli.Writer)
+		bw.Reset(cw.ResponseWriter)
+		cw.w = &pooledWriter{WriteCloser: bw, put: func() { brotliPool.Put(bw) }}
+	case "gzip":
+		gw := gzipPool.Get().(*gzip.Writer)
+		gw.Reset(cw.ResponseWriter)
+		cw.w = &pooledWriter{WriteCloser: gw, put: func() { gzipPool.Put(gw) }}
+	}
+}
+
+// Flush compressed data written so far
+func (cw *compressWriter) Flush() {
+	if f, ok := cw.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Close compressor, so the rest of body is written
+func (cw *compressWriter) Close() error {
+	if cw.w == nil {
+		return nil
+	}
+	return cw.w.Close()
+}
+
+// Unwrap for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+type pooledWriter struct {
+	io.WriteCloser
+	put func()
+}
+
+func (pw *pooledWriter) Flush() error {
+	if f, ok := pw.WriteCloser.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (pw *pooledWriter) Close() error {
+	err := pw.WriteCloser.Close()
+	pw.put()
+	return err
+}
+
+// precompressed serves file.br or file.gz built next to requested static
+// file when client accepts it
+func precompressed(root http.FileSystem) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := "/" + strings.TrimPrefix(chi.URLParam(r, "*"), "/")
+			if strings.HasSuffix(name, "/") {
+				name += "index.html"
+			}
+
+			for _, enc := range acceptEncodings(r.Header.Get("Accept-Encoding")) {
+				f, err := root.Open(name + precompressedExt[enc])
+				if err != nil {
+					continue
+				}
+
+				s, err := f.Stat()
+				if err != nil || s.IsDir() {
+					f.Close()
+					continue
+				}
+				defer f.Close()
+
+				w.Header().Set("Content-Encoding", enc)
+				if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+					w.Header().Set("Content-Type", ct)
+				}
+
+				http.ServeContent(w, r, name, s.ModTime(), f)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
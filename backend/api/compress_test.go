@@ -0,0 +1,190 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptEncodings(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", nil},
+		{"identity", nil},
+		{"gzip", []string{"gzip"}},
+		{"gzip, deflate, br", []string{"br", "gzip"}},
+		{"br;q=0.5, gzip", []string{"gzip", "br"}},
+		{"br;q=0, gzip;q=0.1", []string{"gzip"}},
+		{"*", []string{"br", "gzip"}},
+		{"gzip;q=0, *;q=0.5", []string{"br"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, acceptEncodings(tt.header))
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("<item>episode</item>", 100)
+
+	r := chi.NewRouter()
+	r.Use(compress)
+	r.Get("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(body))
+	})
+	r.Get("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2")
+		w.Write([]byte("ok"))
+	})
+	r.Get("/audio", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte(body))
+	})
+	r.Get("/partial", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(body))
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		accept   string
+		encoding string
+	}{
+		{"brotli", "GET", "/feed", "gzip, br", "br"},
+		{"gzip", "GET", "/feed", "gzip", "gzip"},
+		{"identity", "GET", "/feed", "", ""},
+		{"head", "HEAD", "/feed", "gzip", ""},
+		{"small", "GET", "/small", "gzip", ""},
+		{"audio", "GET", "/audio", "gzip", ""},
+		{"partial", "GET", "/partial", "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(tt.encoding, w.Header().Get("Content-Encoding"))
+			assert.Equal("Accept-Encoding", w.Header().Get("Vary"))
+
+			var got []byte
+			var err error
+			switch tt.encoding {
+			case "br":
+				got, err = ioutil.ReadAll(brotli.NewReader(w.Body))
+			case "gzip":
+				var gr *gzip.Reader
+				gr, err = gzip.NewReader(w.Body)
+				assert.Nil(err)
+				got, err = ioutil.ReadAll(gr)
+			default:
+				got = w.Body.Bytes()
+			}
+			assert.Nil(err)
+
+			switch {
+			case tt.method == "HEAD":
+				assert.Empty(got)
+			case tt.path == "/small":
+				assert.Equal("ok", string(got))
+			default:
+				assert.Equal(body, string(got))
+			}
+
+			if tt.path == "/feed" && tt.encoding != "" {
+				assert.Equal(`W/"abc"`, w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestCompressRoutes(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	root := fs.NewRoot(testDir)
+
+	err := os.MkdirAll(filepath.Join(root.Root, "news"), os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	workDir, err := os.Getwd()
+	assert.Nil(err)
+
+	front := filepath.Join(workDir, fs.FrontDirName)
+	err = os.MkdirAll(front, os.ModePerm)
+	assert.Nil(err)
+	defer os.RemoveAll(front)
+
+	script := strings.Repeat("console.log(1);", 100)
+	err = ioutil.WriteFile(filepath.Join(front, "main.js"), []byte(script), 0644)
+	assert.Nil(err)
+	err = ioutil.WriteFile(filepath.Join(front, "main.js.br"), []byte("precompressed"), 0644)
+	assert.Nil(err)
+
+	audio := strings.Repeat("<audio>", 200)
+	err = ioutil.WriteFile(filepath.Join(root.Root, "news", "episode.txt"), []byte(audio), 0644)
+	assert.Nil(err)
+
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    root,
+		Host:  "http://localhost",
+	})
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// precompressed copy
+	w := get("/main.js", "gzip, br")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("br", w.Header().Get("Content-Encoding"))
+	assert.Contains(w.Header().Get("Content-Type"), "javascript")
+	assert.Equal("precompressed", w.Body.String())
+
+	// compressed on the fly
+	w = get("/main.js", "gzip")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("gzip", w.Header().Get("Content-Encoding"))
+
+	// files keep Range semantics
+	w = get("/files/news/episode.txt", "gzip, br")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Empty(w.Header().Get("Content-Encoding"))
+	assert.Equal(audio, w.Body.String())
+}
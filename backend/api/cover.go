@@ -2,63 +2,128 @@ package api
 
 import (
 	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/azzzak/fakecast/coverart"
 	"github.com/azzzak/fakecast/fs"
 	"github.com/azzzak/fakecast/store"
-	"github.com/go-chi/chi"
 )
 
+// thumbnailSize of cover shown in web interface
+const thumbnailSize = 600
+
 type cover struct {
-	Cover string `json:"cover"`
+	Cover     string `json:"cover"`
+	Thumbnail string `json:"thumbnail,omitempty"`
 }
 
 func setCoverURL(cfg *Cfg, c *store.Channel) {
 	if c.Cover != "" {
 		c.Cover = strings.Join([]string{cfg.Host, "files", c.Alias, fs.CoverDirName, c.Cover}, "/")
+		c.Thumbnail = coverart.Variant(c.Cover, thumbnailSize)
 	}
 }
 
-func (cfg *Cfg) uploadCover(w http.ResponseWriter, r *http.Request) error {
-	file, header, err := r.FormFile("file")
+// saveCover of kind processed from upload with its variants. Name of the
+// cover is returned
+func (cfg *Cfg) saveCover(w http.ResponseWriter, r *http.Request, kind, alias, prefix string) (string, error) {
+	file, header, err := formFile(r, "file")
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer file.Close()
 
-	cid := r.Context().Value(CID).(int64)
+	files, err := coverart.Process(file, prefix)
+	switch {
+	case errors.Is(err, coverart.ErrFormat), errors.Is(err, coverart.ErrTooSmall), errors.Is(err, coverart.ErrTooLarge):
+		return "", errInvalid("Invalid image", fieldError{Field: "file", Message: err.Error()})
+	case err != nil:
+		return "", err
+	}
 
-	short, err := cfg.Store.SwapCIDForAlias(cid)
-	if err != nil {
-		return err
+	for _, f := range files {
+		holder, err := cfg.FS.SaveCover(alias, f.Name)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = holder.Write(f.Data)
+		holder.Close()
+		if err != nil {
+			return "", err
+		}
 	}
 
-	holder, err := cfg.FS.SaveCover(short, header.Filename)
-	if err != nil {
-		return err
+	uploads.Inc(kind)
+	uploadBytes.Add(float64(header.Size), kind)
+
+	return files[0].Name, nil
+}
+
+// coverFiles of cover with its variants, relative to channel dir
+func coverFiles(name string) []string {
+	if filepath.Base(name) != name {
+		return nil
 	}
-	defer holder.Close()
+
+	files := []string{filepath.Join(fs.CoverDirName, name)}
+	for _, v := range coverart.Variants(name) {
+		files = append(files, filepath.Join(fs.CoverDirName, v))
+	}
+	return files
+}
+
+// removeCover with its variants. Covers uploaded before variants were
+// generated have none, and they are not removed at all, as their names
+// are not checked
+func (cfg *Cfg) removeCover(alias, name string) error {
+	for _, v := range coverart.Variants(name) {
+		if err := cfg.FS.RemoveCover(alias, v); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return cfg.FS.RemoveCover(alias, name)
+}
+
+func (cfg *Cfg) uploadCover(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
 
 	c, err := cfg.Store.ChannelInfo(cid)
 	if err != nil {
 		return err
 	}
 
-	c.Cover = header.Filename
+	name, err := cfg.saveCover(w, r, "cover", c.Alias, "")
+	if err != nil || name == "" {
+		return err
+	}
+
+	old := c.Cover
+	c.Cover = name
 	if err = cfg.Store.UpdateChannel(c); err != nil {
 		return err
 	}
 
+	cfg.record(r, "cover.upload", channelTarget(cid), cid, cover{Cover: old}, cover{Cover: name})
+
+	if old != "" && old != name {
+		if err := cfg.removeCover(c.Alias, old); err != nil {
+			logger(r).Warn("previous cover is not removed", "err", err)
+		}
+	}
+
 	setCoverURL(cfg, c)
 
 	output := cover{
-		Cover: c.Cover,
+		Cover:     c.Cover,
+		Thumbnail: c.Thumbnail,
 	}
 
-	io.Copy(holder, file)
-
 	encoder := json.NewEncoder(w)
 	if err := encoder.Encode(output); err != nil {
 		return err
@@ -67,9 +132,9 @@ func (cfg *Cfg) uploadCover(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// deleteCover of channel. It's the stored cover which is removed, name in
+// URL is not trusted
 func (cfg *Cfg) deleteCover(w http.ResponseWriter, r *http.Request) error {
-	cover := chi.URLParam(r, "cover")
-
 	cid := r.Context().Value(CID).(int64)
 
 	channel, err := cfg.Store.ChannelInfo(cid)
@@ -77,6 +142,7 @@ func (cfg *Cfg) deleteCover(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	old := channel.Cover
 	setCoverURL(cfg, channel)
 
 	channel.Cover = ""
@@ -85,10 +151,16 @@ func (cfg *Cfg) deleteCover(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	err = cfg.FS.RemoveCover(channel.Alias, cover)
-	if err != nil {
-		return err
+	cfg.record(r, "cover.delete", channelTarget(cid), cid, map[string]string{"cover": old}, nil)
+
+	if old == "" {
+		return nil
 	}
 
-	return nil
+	err = cfg.removeCover(channel.Alias, old)
+	if errors.Is(err, fs.ErrCoverName) {
+		logger(r).Warn("cover is not removed", "err", err)
+		return nil
+	}
+	return err
 }
@@ -2,7 +2,12 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
@@ -12,11 +17,24 @@ import (
 	"testing"
 	"time"
 
+	"github.com/azzzak/fakecast/coverart"
 	"github.com/azzzak/fakecast/fs"
 	"github.com/azzzak/fakecast/store"
 	"github.com/stretchr/testify/assert"
 )
 
+// testCover encoded as PNG
+func testCover(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 0xff, A: 0xff}), image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	assert.Nil(t, err)
+
+	return buf.Bytes()
+}
+
 func TestSetCoverURL(t *testing.T) {
 	cfg := &Cfg{
 		Host: "http://host.com",
@@ -48,8 +66,23 @@ func TestSetCoverURL(t *testing.T) {
 				},
 			},
 			want: &store.Channel{
-				Alias: "nope",
-				Cover: fmt.Sprintf("%s/files/nope/%s/image.png", cfg.Host, fs.CoverDirName),
+				Alias:     "nope",
+				Cover:     fmt.Sprintf("%s/files/nope/%s/image.png", cfg.Host, fs.CoverDirName),
+				Thumbnail: fmt.Sprintf("%s/files/nope/%s/image.png", cfg.Host, fs.CoverDirName),
+			},
+		}, {
+			name: "with variants",
+			args: args{
+				cfg: cfg,
+				c: &store.Channel{
+					Alias: "nope",
+					Cover: "0123456789abcdef.jpg",
+				},
+			},
+			want: &store.Channel{
+				Alias:     "nope",
+				Cover:     fmt.Sprintf("%s/files/nope/%s/0123456789abcdef.jpg", cfg.Host, fs.CoverDirName),
+				Thumbnail: fmt.Sprintf("%s/files/nope/%s/0123456789abcdef-600.jpg", cfg.Host, fs.CoverDirName),
 			},
 		},
 	}
@@ -62,15 +95,27 @@ func TestSetCoverURL(t *testing.T) {
 }
 
 func TestUploadCover(t *testing.T) {
+	tiny, err := ioutil.ReadFile(filepath.Join("..", "_testdata", "tiny.jpg"))
+	assert.Nil(t, err)
+
 	tests := []struct {
 		name    string
+		data    []byte
+		status  int
 		wantErr bool
 	}{
 		{
-			name:    "ok",
-			wantErr: false,
+			name:   "ok",
+			data:   testCover(t, 1500, 1400),
+			status: http.StatusOK,
+		}, {
+			name:   "too small",
+			data:   tiny,
+			status: http.StatusUnprocessableEntity,
 		}, {
 			name:    "error",
+			data:    testCover(t, 1400, 1400),
+			status:  http.StatusInternalServerError,
 			wantErr: true,
 		},
 	}
@@ -106,6 +151,7 @@ func TestUploadCover(t *testing.T) {
 			assert.Equal(int64(1), c.ID)
 
 			c.Alias = "1"
+			c.Cover = "0011223344556677.jpg"
 
 			err = s.UpdateChannel(c)
 			assert.Nil(err)
@@ -113,24 +159,16 @@ func TestUploadCover(t *testing.T) {
 			err = root.CreateDir(c.ID)
 			assert.Nil(err)
 
-			path := filepath.Join("..", "_testdata", "tiny.jpg")
-			file, err := os.Open(path)
-			assert.Nil(err)
-
-			fileContents, err := ioutil.ReadAll(file)
-			assert.Nil(err)
-
-			fi, err := file.Stat()
+			coverDir := filepath.Join(testDir, fs.PodcastsDirName, c.Alias, fs.CoverDirName)
+			err = ioutil.WriteFile(filepath.Join(coverDir, "0011223344556677.jpg"), tiny, 0644)
 			assert.Nil(err)
 
-			file.Close()
-
 			body := new(bytes.Buffer)
 			writer := multipart.NewWriter(body)
-			part, err := writer.CreateFormFile("file", fi.Name())
+			part, err := writer.CreateFormFile("file", "cover.png")
 			assert.Nil(err)
 
-			part.Write(fileContents)
+			part.Write(tt.data)
 
 			err = writer.Close()
 			assert.Nil(err)
@@ -147,30 +185,41 @@ func TestUploadCover(t *testing.T) {
 			handler := http.Handler(InitHandlers(cfg))
 			handler.ServeHTTP(w, r)
 
-			resp := w.Result()
-			defer resp.Body.Close()
-
-			if tt.wantErr {
-				assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+			if !assert.Equal(tt.status, w.Code) || tt.status != http.StatusOK {
 				return
 			}
 
-			if !assert.Equal(http.StatusOK, resp.StatusCode) {
-				t.Fatalf("Got status code: %d\n", resp.StatusCode)
-			}
+			c, err = s.ChannelInfo(id)
+			assert.Nil(err)
+			assert.Regexp(`^[0-9a-f]{16}\.jpg$`, c.Cover)
 
-			path = filepath.Join(testDir, fs.PodcastsDirName, c.Alias, fs.CoverDirName, "tiny.jpg")
-			file, err = os.Open(path)
+			var out cover
+			err = json.NewDecoder(w.Body).Decode(&out)
 			assert.Nil(err)
+			assert.Equal(fmt.Sprintf("/files/1/%s/%s", fs.CoverDirName, c.Cover), out.Cover)
+			assert.Equal(coverart.Variant(out.Cover, thumbnailSize), out.Thumbnail)
 
-			fi, err = file.Stat()
+			img, _, err := image.DecodeConfig(bytes.NewReader(readFile(t, filepath.Join(coverDir, c.Cover))))
 			assert.Nil(err)
+			assert.Equal(1400, img.Width)
+			assert.Equal(1400, img.Height)
 
-			file.Close()
+			for _, v := range coverart.Variants(c.Cover) {
+				assert.FileExists(filepath.Join(coverDir, v))
+			}
+
+			// previous cover is replaced
+			assert.NoFileExists(filepath.Join(coverDir, "0011223344556677.jpg"))
 		})
 	}
 }
 
+func readFile(t *testing.T, path string) []byte {
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	return b
+}
+
 func TestDeleteCover(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -215,7 +264,7 @@ func TestDeleteCover(t *testing.T) {
 			assert.Nil(err)
 			assert.Equal(int64(1), c.ID)
 
-			coverName := "image.jpg"
+			coverName := "0123456789abcdef.jpg"
 
 			c.Alias = "1"
 			c.Title = "channel 1"
@@ -236,7 +285,8 @@ func TestDeleteCover(t *testing.T) {
 				assert.Nil(err)
 			}
 
-			r := httptest.NewRequest("DELETE", fmt.Sprintf("/api/channel/1/cover/%s", coverName), nil)
+			// stored cover is removed, whatever name is in URL
+			r := httptest.NewRequest("DELETE", "/api/channel/1/cover/..", nil)
 
 			w := httptest.NewRecorder()
 			handler := http.Handler(InitHandlers(cfg))
@@ -1,14 +1,165 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/azzzak/fakecast/feed"
+	"github.com/azzzak/fakecast/store"
 	"github.com/go-chi/chi"
 )
 
+// feedMaxAge is how long clients may reuse a feed without revalidation
+const feedMaxAge = 5 * time.Minute
+
+// renderedFeed kept until channel or its episodes are changed
+type renderedFeed struct {
+	body     []byte
+	etag     string
+	modified time.Time
+}
+
+// archivePage is the page with all episodes of a channel
+const archivePage = 0
+
+var errNoPage = errors.New("no such page")
+
+// feedFormat of a feed, ext is the suffix of its URL
+type feedFormat struct {
+	name        string
+	ext         string
+	contentType string
+}
+
+var (
+	rssFormat  = feedFormat{name: "rss", contentType: "application/rss+xml"}
+	atomFormat = feedFormat{name: "atom", ext: ".atom", contentType: "application/atom+xml"}
+	jsonFormat = feedFormat{name: "json", ext: ".json", contentType: "application/feed+json"}
+
+	feedFormats = []feedFormat{rssFormat, atomFormat, jsonFormat}
+)
+
+type feedKey struct {
+	page   int
+	format string
+}
+
+// feedCache of rendered pages of channels' feeds. Generation of channel is
+// bumped on change, so page rendered before it is never put
+type feedCache struct {
+	sync.RWMutex
+	feeds map[int64]map[feedKey]*renderedFeed
+	gens  map[int64]uint64
+}
+
+func newFeedCache() *feedCache {
+	return &feedCache{
+		feeds: map[int64]map[feedKey]*renderedFeed{},
+		gens:  map[int64]uint64{},
+	}
+}
+
+// get page of cache along with generation of channel to put it later
+func (c *feedCache) get(cid int64, key feedKey) (*renderedFeed, uint64) {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.feeds[cid][key], c.gens[cid]
+}
+
+// put page unless channel is changed since generation
+func (c *feedCache) put(cid int64, key feedKey, gen uint64, f *renderedFeed) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.gens[cid] != gen {
+		return
+	}
+	if c.feeds[cid] == nil {
+		c.feeds[cid] = map[feedKey]*renderedFeed{}
+	}
+	c.feeds[cid][key] = f
+}
+
+func (c *feedCache) invalidate(cid int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.gens[cid]++
+	delete(c.feeds, cid)
+}
+
+// negotiateFeed format by Accept header. RSS wins unless client prefers another one
+func negotiateFeed(w http.ResponseWriter, r *http.Request) feedFormat {
+	w.Header().Add("Vary", "Accept")
+
+	q := qvalues(r.Header.Get("Accept"))
+	quality := func(f feedFormat) float64 {
+		types := []string{f.contentType, "*/*", "application/*"}
+		if f == jsonFormat {
+			types = append(types, "application/json")
+		}
+
+		var best float64
+		for _, t := range types {
+			if v, ok := q[t]; ok && v > best {
+				best = v
+			}
+		}
+		return best
+	}
+
+	format := rssFormat
+	for _, f := range feedFormats {
+		if quality(f) > quality(format) {
+			format = f
+		}
+	}
+
+	return format
+}
+
+// genFeed with the latest episodes. When channel has limit of items, older
+// ones are on next pages
 func (cfg *Cfg) genFeed(w http.ResponseWriter, r *http.Request) error {
+	return cfg.serveFeed(w, r, false, negotiateFeed(w, r))
+}
+
+// genArchive feed with all episodes regardless of limit
+func (cfg *Cfg) genArchive(w http.ResponseWriter, r *http.Request) error {
+	return cfg.serveFeed(w, r, true, negotiateFeed(w, r))
+}
+
+// feedAs format given by extension of URL
+func (cfg *Cfg) feedAs(format feedFormat, archive bool) hndlr {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		return cfg.serveFeed(w, r, archive, format)
+	}
+}
+
+func (cfg *Cfg) serveFeed(w http.ResponseWriter, r *http.Request, archive bool, format feedFormat) error {
+	page := archivePage
+	if !archive {
+		page = 1
+		if v := r.URL.Query().Get("page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return errInvalid("Invalid page", fieldError{Field: "page", Message: "must be positive number"})
+			}
+			page = n
+		}
+	}
+
 	c := chi.URLParam(r, "channel")
 
 	cid, err := cfg.Store.SwapAliasForCID(c)
@@ -16,27 +167,175 @@ func (cfg *Cfg) genFeed(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	key := feedKey{page: page, format: format.name}
+
+	f, gen := cfg.feeds.get(cid, key)
+	if f == nil {
+		f, err = cfg.renderFeed(cid, page, format)
+		if errors.Is(err, errNoPage) {
+			http.NotFound(w, r)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cfg.feeds.put(cid, key, gen, f)
+	}
+
+	w.Header().Set("Content-Type", format.contentType+"; charset=utf-8")
+	w.Header().Set("ETag", f.etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(feedMaxAge.Seconds())))
+
+	// handles If-None-Match and If-Modified-Since
+	http.ServeContent(w, r, "", f.modified, bytes.NewReader(f.body))
+
+	if err := cfg.recordPoll(r, cid); err != nil {
+		logger(r).Warn("feed poll is not recorded", "err", err)
+	}
+
+	return nil
+}
+
+func (cfg *Cfg) renderFeed(cid int64, page int, format feedFormat) (*renderedFeed, error) {
+	start := time.Now()
+
 	channel, err := cfg.Store.ChannelInfo(cid)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	setCoverURL(cfg, channel)
 
-	podcasts, err := cfg.Store.ListFullPodcastsFrom(cid)
+	defaults := cfg.Feed.For(channel.Alias)
+
+	limit := defaults.Limit
+	if page == archivePage {
+		limit = 0
+	}
+	if limit == 0 && page > 1 {
+		return nil, errNoPage
+	}
+
+	var podcasts []store.Podcast
+	if limit > 0 {
+		// one more to know whether there is next page
+		podcasts, err = cfg.Store.ListFullPodcastsPage(cid, limit+1, (page-1)*limit)
+	} else {
+		podcasts, err = cfg.Store.ListFullPodcastsFrom(cid)
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if page > 1 && len(podcasts) == 0 {
+		return nil, errNoPage
+	}
+
+	more := limit > 0 && len(podcasts) > limit
+	if more {
+		podcasts = podcasts[:limit]
 	}
 
 	podcasts = checkPodcasts(cfg, channel.Alias, podcasts)
-	rss := feed.GenerateFeed(channel, podcasts, cfg.Host)
+	for i := range podcasts {
+		setArtworkURL(cfg, channel.Alias, &podcasts[i])
+	}
 
-	w.Write([]byte(xml.Header))
+	url := feedURL(strings.Join([]string{cfg.Host, "feed", channel.Alias}, "/"))
+	links := feedLinks(url, format, page, limit > 0, more)
 
-	encoder := xml.NewEncoder(w)
-	if err := encoder.Encode(rss); err != nil {
-		return err
+	// pages of paged feed after the first one are archives of it (RFC 5005)
+	complete, archive := page == archivePage, page > 1
+
+	var buf bytes.Buffer
+
+	switch format {
+	case atomFormat:
+		buf.WriteString(xml.Header)
+		atom := feed.GenerateAtom(channel, podcasts, cfg.Host, defaults, links)
+		atom.SetHistory(complete, archive)
+		err = xml.NewEncoder(&buf).Encode(atom)
+	case jsonFormat:
+		var next string
+		if more {
+			next = url(format, page+1)
+		}
+		jf := feed.GenerateJSON(channel, podcasts, cfg.Host, defaults, url(format, page), next)
+		err = json.NewEncoder(&buf).Encode(jf)
+	default:
+		buf.WriteString(xml.Header)
+		rss := feed.GenerateFeed(channel, podcasts, cfg.Host, defaults)
+		rss.SetLinks(links)
+		rss.SetHistory(complete, archive)
+		err = xml.NewEncoder(&buf).Encode(rss)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	feedRender.Observe(time.Since(start).Seconds(), channel.Alias)
+
+	sum := sha256.Sum256(buf.Bytes())
+
+	// channels created before tracking of changes
+	modified := time.Unix(channel.LastModified, 0)
+	if channel.LastModified == 0 {
+		modified = start
+	}
+
+	return &renderedFeed{
+		body:     buf.Bytes(),
+		etag:     `"` + hex.EncodeToString(sum[:8]) + `"`,
+		modified: modified,
+	}, nil
+}
+
+// feedURL builds URLs of pages of the feed in any format
+func feedURL(base string) func(feedFormat, int) string {
+	return func(f feedFormat, page int) string {
+		switch page {
+		case archivePage:
+			return base + "/archive" + f.ext
+		case 1:
+			return base + f.ext
+		}
+		return fmt.Sprintf("%s%s?page=%d", base, f.ext, page)
+	}
+}
+
+// feedLinks to the page itself, the same page in other formats and, when
+// feed is paged (RFC 5005), to other pages and the full archive. Pages are
+// both paged and archived feed, older pages are prev-archive ones, and
+// the full archive is linked as "archives" of IANA registry
+func feedLinks(url func(feedFormat, int) string, format feedFormat, page int, paged, more bool) []feed.Link {
+	link := func(rel string, page int) feed.Link {
+		return feed.Link{Rel: rel, Href: url(format, page), Type: format.contentType}
+	}
+
+	links := []feed.Link{link("self", page)}
+
+	if paged && page != archivePage {
+		links = append(links, link("first", 1))
+		if page > 1 {
+			links = append(links, link("prev", page-1))
+		}
+		if more {
+			links = append(links, link("next", page+1))
+		}
+		if page > 1 {
+			links = append(links, link("current", 1), link("next-archive", page-1))
+		}
+		if more {
+			links = append(links, link("prev-archive", page+1))
+		}
+		links = append(links, link("archives", archivePage))
+	}
+
+	for _, f := range feedFormats {
+		if f != format {
+			links = append(links, feed.Link{Rel: "alternate", Href: url(f, page), Type: f.contentType})
+		}
+	}
+
+	return links
 }
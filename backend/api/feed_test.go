@@ -0,0 +1,531 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/feed"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenFeed(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cfg := &Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "http://localhost",
+	}
+
+	cid, err := s.AddChannel()
+	assert.Nil(err)
+
+	c, err := s.ChannelInfo(cid)
+	assert.Nil(err)
+	c.Alias = "news"
+	c.Title = "News"
+	err = s.UpdateChannel(c)
+	assert.Nil(err)
+
+	h := InitHandlers(cfg)
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/feed/news", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("", "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "<title>News</title>")
+	assert.Equal("application/rss+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal("public, max-age=300", w.Header().Get("Cache-Control"))
+
+	etag := w.Header().Get("ETag")
+	modified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(etag)
+	assert.Equal(time.Unix(c.LastModified, 0).UTC().Format(http.TimeFormat), modified)
+
+	w = get("If-None-Match", etag)
+	assert.Equal(http.StatusNotModified, w.Code)
+	assert.Empty(w.Body.String())
+
+	w = get("If-Modified-Since", modified)
+	assert.Equal(http.StatusNotModified, w.Code)
+
+	w = get("If-None-Match", `"stale"`)
+	assert.Equal(http.StatusOK, w.Code)
+
+	// change of channel invalidates cached feed
+	c.Title = "Breaking news"
+	err = s.UpdateChannel(c)
+	assert.Nil(err)
+
+	w = get("If-None-Match", etag)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "<title>Breaking news</title>")
+	assert.NotEqual(etag, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/feed/nope", nil))
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestFeedCache(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newFeedCache()
+	key := feedKey{page: 1, format: rssFormat.name}
+
+	f, gen := c.get(1, key)
+	assert.Nil(f)
+	c.put(1, key, gen, &renderedFeed{etag: "a"})
+	f, _ = c.get(1, key)
+	assert.Equal("a", f.etag)
+
+	// page rendered before change is stale, so it's dropped
+	_, gen = c.get(2, key)
+	c.invalidate(2)
+	c.put(2, key, gen, &renderedFeed{etag: "stale"})
+	f, _ = c.get(2, key)
+	assert.Nil(f)
+
+	// other channels keep their pages
+	f, _ = c.get(1, key)
+	assert.Equal("a", f.etag)
+
+	c.invalidate(1)
+	f, gen = c.get(1, key)
+	assert.Nil(f)
+	c.put(1, key, gen, &renderedFeed{etag: "b"})
+	f, _ = c.get(1, key)
+	assert.Equal("b", f.etag)
+}
+
+func TestFeedPages(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	root := fs.NewRoot(testDir)
+
+	cfg := &Cfg{
+		Store: s,
+		FS:    root,
+		Host:  "http://localhost",
+		Feed: config.Feed{
+			Channels: map[string]config.FeedDefaults{
+				"news": {Limit: 2},
+			},
+		},
+	}
+
+	cid, err := s.AddChannel()
+	assert.Nil(err)
+
+	c, err := s.ChannelInfo(cid)
+	assert.Nil(err)
+	c.Alias = "news"
+	err = s.UpdateChannel(c)
+	assert.Nil(err)
+
+	err = os.MkdirAll(filepath.Join(root.Root, "news"), os.ModePerm)
+	assert.Nil(err)
+
+	for i := 1; i <= 5; i++ {
+		filename := fmt.Sprintf("episode%d.mp3", i)
+		_, err := s.AddPodcastToChannel(cid, filename, fmt.Sprintf("Episode %d", i), 10)
+		assert.Nil(err)
+		err = ioutil.WriteFile(filepath.Join(root.Root, "news", filename), []byte("audio"), 0644)
+		assert.Nil(err)
+	}
+
+	h := InitHandlers(cfg)
+
+	// prefixed names of feed.RSS are resolved to namespaces when decoding
+	type page struct {
+		Channel struct {
+			Links []feed.Link `xml:"http://www.w3.org/2005/Atom link"`
+			Items []feed.Item `xml:"item"`
+		} `xml:"channel"`
+	}
+
+	get := func(path string) (int, page) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+		var rss page
+		if w.Code == http.StatusOK {
+			err := xml.Unmarshal(w.Body.Bytes(), &rss)
+			assert.Nil(err)
+		}
+		return w.Code, rss
+	}
+
+	titles := func(rss page) []string {
+		var ts []string
+		for _, i := range rss.Channel.Items {
+			ts = append(ts, i.Title)
+		}
+		return ts
+	}
+
+	// links between pages, alternate formats are checked in TestFeedFormats
+	links := func(rss page) map[string]string {
+		ls := map[string]string{}
+		for _, l := range rss.Channel.Links {
+			if l.Rel != "alternate" {
+				ls[l.Rel] = l.Href
+			}
+		}
+		return ls
+	}
+
+	base := "http://localhost/feed/news"
+
+	code, rss := get("/feed/news")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal([]string{"Episode 5", "Episode 4"}, titles(rss))
+	assert.Equal(map[string]string{
+		"self":         base,
+		"first":        base,
+		"next":         base + "?page=2",
+		"prev-archive": base + "?page=2",
+		"archives":     base + "/archive",
+	}, links(rss))
+
+	code, rss = get("/feed/news?page=3")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal([]string{"Episode 1"}, titles(rss))
+	assert.Equal(map[string]string{
+		"self":         base + "?page=3",
+		"first":        base,
+		"prev":         base + "?page=2",
+		"current":      base,
+		"next-archive": base + "?page=2",
+		"archives":     base + "/archive",
+	}, links(rss))
+
+	// history markup (RFC 5005) as it is written
+	raw := func(path string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	rssHead := `<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:atom="http://www.w3.org/2005/Atom"`
+	history := ` xmlns:fh="http://purl.org/syndication/history/1.0"`
+
+	body := raw("/feed/news")
+	assert.Contains(body, rssHead+`><channel>`)
+	assert.NotContains(body, "fh:")
+
+	body = raw("/feed/news?page=2")
+	assert.Contains(body, rssHead+history+`><channel><title></title><itunes:image></itunes:image><fh:archive></fh:archive><atom:link rel="self"`)
+	assert.Contains(body, `<atom:link rel="current" href="http://localhost/feed/news" type="application/rss+xml"></atom:link>`+
+		`<atom:link rel="next-archive" href="http://localhost/feed/news" type="application/rss+xml"></atom:link>`+
+		`<atom:link rel="prev-archive" href="http://localhost/feed/news?page=3" type="application/rss+xml"></atom:link>`+
+		`<atom:link rel="archives" href="http://localhost/feed/news/archive" type="application/rss+xml"></atom:link>`)
+
+	body = raw("/feed/news/archive")
+	assert.Contains(body, rssHead+history+`><channel><title></title><itunes:image></itunes:image><fh:complete></fh:complete><atom:link rel="self"`)
+
+	body = raw("/feed/news.atom?page=2")
+	assert.Contains(body, `<feed xmlns="http://www.w3.org/2005/Atom"`+history+`><id>`)
+	assert.Contains(body, `</updated><fh:archive></fh:archive><link rel="self"`)
+	assert.Contains(body, `<link rel="prev-archive" href="http://localhost/feed/news.atom?page=3" type="application/atom+xml"></link>`)
+
+	code, _ = get("/feed/news?page=4")
+	assert.Equal(http.StatusNotFound, code)
+
+	code, _ = get("/feed/news?page=zero")
+	assert.Equal(http.StatusUnprocessableEntity, code)
+
+	code, rss = get("/feed/news/archive")
+	assert.Equal(http.StatusOK, code)
+	assert.Len(rss.Channel.Items, 5)
+	assert.Equal(map[string]string{
+		"self": base + "/archive",
+	}, links(rss))
+}
+
+func TestFeedFormats(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	root := fs.NewRoot(testDir)
+
+	cfg := &Cfg{
+		Store: s,
+		FS:    root,
+		Host:  "http://localhost",
+		Feed: config.Feed{
+			Defaults: config.FeedDefaults{Author: "Team", Language: "en", Limit: 1},
+		},
+	}
+
+	cid, err := s.AddChannel()
+	assert.Nil(err)
+
+	c, err := s.ChannelInfo(cid)
+	assert.Nil(err)
+	c.Alias = "news"
+	c.Title = "News"
+	err = s.UpdateChannel(c)
+	assert.Nil(err)
+
+	err = os.MkdirAll(filepath.Join(root.Root, "news"), os.ModePerm)
+	assert.Nil(err)
+
+	for i := 1; i <= 2; i++ {
+		filename := fmt.Sprintf("episode%d.m4a", i)
+		p, err := s.AddPodcastToChannel(cid, filename, fmt.Sprintf("Episode %d", i), 10)
+		assert.Nil(err)
+		p, err = s.PodcastInfo(p.ID)
+		assert.Nil(err)
+		p.PubDate = fmt.Sprintf("Thu, %d Jul 2020 10:00:00 UTC", i)
+		p.Duration = 60
+		err = s.UpdatePodcast(p)
+		assert.Nil(err)
+		err = ioutil.WriteFile(filepath.Join(root.Root, "news", filename), []byte("audio"), 0644)
+		assert.Nil(err)
+	}
+
+	h := InitHandlers(cfg)
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	negotiation := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "application/rss+xml"},
+		{"*/*", "application/rss+xml"},
+		{"application/atom+xml", "application/atom+xml"},
+		{"application/rss+xml;q=0.5, application/atom+xml", "application/atom+xml"},
+		{"application/feed+json", "application/feed+json"},
+		{"application/json, */*;q=0.1", "application/feed+json"},
+		{"text/html", "application/rss+xml"},
+	}
+	for _, tt := range negotiation {
+		w := get("/feed/news", tt.accept)
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal(tt.contentType+"; charset=utf-8", w.Header().Get("Content-Type"), tt.accept)
+		assert.Contains(w.Header().Values("Vary"), "Accept")
+	}
+
+	// RSS links to other formats
+	w := get("/feed/news", "")
+	assert.Contains(w.Body.String(), `<atom:link rel="alternate" href="http://localhost/feed/news.atom" type="application/atom+xml"></atom:link>`)
+	assert.Contains(w.Body.String(), `<atom:link rel="alternate" href="http://localhost/feed/news.json" type="application/feed+json"></atom:link>`)
+
+	w = get("/feed/news.atom?page=2", "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/atom+xml; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var atom feed.Atom
+	err = xml.Unmarshal(w.Body.Bytes(), &atom)
+	assert.Nil(err)
+	assert.Equal("News", atom.Title)
+	assert.Equal("en", atom.Lang)
+	assert.Equal("Team", atom.Author.Name)
+	assert.Len(atom.Entries, 1)
+	assert.Equal("Episode 1", atom.Entries[0].Title)
+	assert.Equal("2020-07-01T10:00:00Z", atom.Entries[0].Published)
+	assert.Equal([]feed.Link{{
+		Rel:    "enclosure",
+		Href:   "http://localhost/files/news/episode1.m4a",
+		Type:   "audio/x-m4a",
+		Length: 10,
+	}}, atom.Entries[0].Links)
+	assert.Contains(atom.Links, feed.Link{Rel: "prev", Href: "http://localhost/feed/news.atom", Type: "application/atom+xml"})
+	assert.Contains(atom.Links, feed.Link{Rel: "alternate", Href: "http://localhost/feed/news?page=2", Type: "application/rss+xml"})
+
+	w = get("/feed/news.json", "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/feed+json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var jf feed.JSONFeed
+	err = json.Unmarshal(w.Body.Bytes(), &jf)
+	assert.Nil(err)
+	assert.Equal(feed.JSONFeed{
+		Version:  feed.JSONFeedVersion,
+		Title:    "News",
+		FeedURL:  "http://localhost/feed/news.json",
+		NextURL:  "http://localhost/feed/news.json?page=2",
+		Authors:  []feed.JSONAuthor{{Name: "Team"}},
+		Language: "en",
+		Items: []feed.JSONItem{{
+			ID:            "http://localhost/files/news/episode2.m4a",
+			Title:         "Episode 2",
+			DatePublished: "2020-07-02T10:00:00Z",
+			Attachments: []feed.JSONAttachment{{
+				URL:               "http://localhost/files/news/episode2.m4a",
+				MimeType:          "audio/x-m4a",
+				SizeInBytes:       10,
+				DurationInSeconds: 60,
+			}},
+		}},
+	}, jf)
+
+	w = get("/feed/news/archive.json", "")
+	assert.Equal(http.StatusOK, w.Code)
+	jf = feed.JSONFeed{}
+	err = json.Unmarshal(w.Body.Bytes(), &jf)
+	assert.Nil(err)
+	assert.Len(jf.Items, 2)
+	assert.Empty(jf.NextURL)
+}
+
+func TestFeedShowNotes(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	root := fs.NewRoot(testDir)
+
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    root,
+		Host:  "http://localhost",
+	})
+
+	cid, err := s.AddChannel()
+	assert.Nil(err)
+
+	c, err := s.ChannelInfo(cid)
+	assert.Nil(err)
+	c.Alias = "news"
+	c.Description = "**Daily** news"
+	err = s.UpdateChannel(c)
+	assert.Nil(err)
+
+	p, err := s.AddPodcastToChannel(cid, "ep.mp3", "Episode", 10)
+	assert.Nil(err)
+	p, err = s.PodcastInfo(p.ID)
+	assert.Nil(err)
+	p.Description = "Hello <b>world</b>\n\n- 01:30 [Topic](https://example.com)"
+	err = s.UpdatePodcast(p)
+	assert.Nil(err)
+
+	err = os.MkdirAll(filepath.Join(root.Root, "news"), os.ModePerm)
+	assert.Nil(err)
+	err = ioutil.WriteFile(filepath.Join(root.Root, "news", "ep.mp3"), []byte("audio"), 0644)
+	assert.Nil(err)
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	html := `<p>Hello &lt;b&gt;world&lt;/b&gt;</p>` + "\n" +
+		`<ul>` + "\n" +
+		`<li><a href="http://localhost/files/news/ep.mp3#t=90">01:30</a> <a href="https://example.com">Topic</a></li>` + "\n" +
+		`</ul>`
+	text := "Hello <b>world</b>\n\n- 01:30 Topic (https://example.com)"
+
+	var rss struct {
+		Channel struct {
+			Description string `xml:"description"`
+			Summary     string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+			Items       []struct {
+				Description string `xml:"description"`
+				Summary     string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+				Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	body := get("/feed/news")
+	assert.Contains(body, "<content:encoded><![CDATA["+html+"]]></content:encoded>")
+	err = xml.Unmarshal([]byte(body), &rss)
+	assert.Nil(err)
+	assert.Equal("Daily news", rss.Channel.Description)
+	assert.Equal("Daily news", rss.Channel.Summary)
+	assert.Len(rss.Channel.Items, 1)
+	assert.Equal(text, rss.Channel.Items[0].Description)
+	assert.Equal(text, rss.Channel.Items[0].Summary)
+	assert.Equal(html, rss.Channel.Items[0].Content)
+
+	var atom feed.Atom
+	err = xml.Unmarshal([]byte(get("/feed/news.atom")), &atom)
+	assert.Nil(err)
+	assert.Equal("Daily news", atom.Subtitle)
+	assert.Equal(text, atom.Entries[0].Summary)
+	assert.Equal(&feed.AtomContent{Type: "html", Value: html}, atom.Entries[0].Content)
+
+	var jf feed.JSONFeed
+	err = json.Unmarshal([]byte(get("/feed/news.json")), &jf)
+	assert.Nil(err)
+	assert.Equal("Daily news", jf.Description)
+	assert.Equal(text, jf.Items[0].ContentText)
+	assert.Equal(html, jf.Items[0].ContentHTML)
+}
@@ -0,0 +1,71 @@
+package api
+
+import "time"
+
+// Housekeep purges outdated audit records and items of trash every
+// interval until stop is closed
+func (cfg *Cfg) Housekeep(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cfg.housekeep()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *Cfg) housekeep() {
+	cfg.expireAudit()
+	cfg.expireTrash()
+}
+
+func (cfg *Cfg) expireAudit() {
+	if cfg.Audit.Retention <= 0 {
+		return
+	}
+
+	n, err := cfg.Store.PurgeAudit(time.Now().Add(-cfg.Audit.Retention))
+	if err != nil {
+		cfg.logger().Error("audit records are not purged", "err", err)
+		return
+	}
+	if n > 0 {
+		cfg.logger().Info("audit records are purged", "count", n)
+	}
+}
+
+func (cfg *Cfg) expireTrash() {
+	if cfg.Trash.Retention <= 0 {
+		return
+	}
+
+	ts, err := cfg.Store.ListTrash()
+	if err != nil {
+		cfg.logger().Error("trash is not purged", "err", err)
+		return
+	}
+
+	before := time.Now().Add(-cfg.Trash.Retention).Unix()
+	purged := map[int64]bool{}
+	for _, t := range ts {
+		if t.Deleted >= before || purged[t.ID] {
+			continue
+		}
+
+		// podcasts of channel are purged along with it
+		gone, err := cfg.purge(t.ID)
+		if err != nil {
+			cfg.logger().Error("item of trash is not purged", "kind", t.Kind, "item", t.Item, "err", err)
+			continue
+		}
+		for _, g := range gone {
+			purged[g.ID] = true
+			cfg.logger().Info("item of trash is purged", "kind", g.Kind, "item", g.Item, "name", g.Name)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{
+			name:   "passed",
+			header: "abc-123",
+			keep:   true,
+		}, {
+			name:   "empty",
+			header: "",
+		}, {
+			name:   "invalid",
+			header: "bad id\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			cfg := &Cfg{}
+
+			var got string
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Context().Value(RID).(string)
+			})
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-Request-ID", tt.header)
+			w := httptest.NewRecorder()
+
+			cfg.requestID(nextHandler).ServeHTTP(w, r)
+
+			assert.Equal(got, w.Header().Get("X-Request-ID"))
+			if tt.keep {
+				assert.Equal(tt.header, got)
+				return
+			}
+			assert.Len(got, 16)
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	cfg := &Cfg{
+		Log: slog.New(slog.NewJSONHandler(&buf, nil)),
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+
+	r := httptest.NewRequest("POST", "/api/channel/", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	r.Header.Set("X-Request-ID", "req-1")
+
+	cfg.requestID(cfg.accessLog(nextHandler)).ServeHTTP(httptest.NewRecorder(), r)
+
+	var line map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &line)
+	assert.Nil(err)
+
+	assert.Equal("request", line["msg"])
+	assert.Equal("req-1", line["request_id"])
+	assert.Equal("POST", line["method"])
+	assert.Equal("/api/channel/", line["path"])
+	assert.Equal(float64(http.StatusCreated), line["status"])
+	assert.Equal(float64(5), line["bytes"])
+	assert.Equal("test-agent", line["user_agent"])
+	assert.Equal("192.0.2.1", line["remote_ip"])
+}
+
+func TestClientIP(t *testing.T) {
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	cfg := &Cfg{
+		TrustedProxies: []*net.IPNet{private},
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{
+			name:   "direct",
+			remote: "203.0.113.5:1234",
+			want:   "203.0.113.5",
+		}, {
+			name:   "untrusted proxy",
+			remote: "203.0.113.5:1234",
+			xff:    []string{"198.51.100.1"},
+			want:   "203.0.113.5",
+		}, {
+			name:   "trusted proxy",
+			remote: "10.0.0.2:1234",
+			xff:    []string{"198.51.100.1"},
+			want:   "198.51.100.1",
+		}, {
+			name:   "spoofed chain",
+			remote: "10.0.0.2:1234",
+			xff:    []string{"1.1.1.1, 198.51.100.1", "10.0.0.3"},
+			want:   "198.51.100.1",
+		}, {
+			name:   "only proxies",
+			remote: "10.0.0.2:1234",
+			xff:    []string{"10.0.0.4"},
+			want:   "10.0.0.4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			assert.Equal(t, tt.want, cfg.clientIP(r))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/store"
+)
+
+type memberRequest struct {
+	Role string `json:"role"`
+}
+
+// roleIn channel of account, empty if it's not a member. Owners of admin
+// area own every channel
+func (cfg *Cfg) roleIn(u *store.User, cid int64) (string, error) {
+	if u.Role == string(auth.Owner) {
+		return u.Role, nil
+	}
+
+	role, err := cfg.Store.RoleIn(cid, u.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+func (cfg *Cfg) listMembers(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
+
+	ms, err := cfg.Store.MembersOf(cid)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(ms); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// setMember adds user to channel or changes role of member
+func (cfg *Cfg) setMember(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
+
+	u, err := cfg.userOf(r)
+	if err != nil {
+		return err
+	}
+
+	var req memberRequest
+
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+
+	if !auth.Role(req.Role).Valid() {
+		return errInvalid("Invalid role", roleError)
+	}
+
+	before, err := cfg.memberOf(cid, u)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Store.SetMember(cid, u.ID, req.Role); err != nil {
+		return err
+	}
+
+	after := &store.Member{User: u.ID, Name: u.Name, Channel: cid, Role: req.Role}
+	cfg.record(r, "member.set", userTarget(u.ID), cid, before, after)
+	return nil
+}
+
+func (cfg *Cfg) deleteMember(w http.ResponseWriter, r *http.Request) error {
+	cid := r.Context().Value(CID).(int64)
+
+	u, err := cfg.userOf(r)
+	if err != nil {
+		return err
+	}
+
+	before, err := cfg.memberOf(cid, u)
+	if err != nil || before == nil {
+		return err
+	}
+
+	if err := cfg.Store.DeleteMember(cid, u.ID); err != nil {
+		return err
+	}
+
+	cfg.record(r, "member.delete", userTarget(u.ID), cid, before, nil)
+	return nil
+}
+
+// memberOf channel, nil if user is not a member
+func (cfg *Cfg) memberOf(cid int64, u *store.User) (*store.Member, error) {
+	role, err := cfg.Store.RoleIn(cid, u.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &store.Member{User: u.ID, Name: u.Name, Channel: cid, Role: role}, nil
+}
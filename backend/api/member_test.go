@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembers(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "http://localhost",
+		Users: []config.User{
+			{Name: "admin", Password: "pass", Role: "owner"},
+			{Name: "ann", Password: "pass", Role: "editor"},
+			{Name: "bob", Password: "pass", Role: "editor"},
+		},
+	})
+
+	do := func(user, method, path string, body interface{}) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		r := httptest.NewRequest(method, path, &b)
+		r.SetBasicAuth(user, "pass")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	list := func(user string) []store.Channel {
+		w := do(user, "GET", "/api/list", nil)
+		assert.Equal(http.StatusOK, w.Code)
+		var cs []store.Channel
+		err := json.NewDecoder(w.Body).Decode(&cs)
+		assert.Nil(err)
+		return cs
+	}
+
+	// every creator owns its channel
+	var ann, bob store.Channel
+	w := do("ann", "POST", "/api/channel", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&ann)
+	assert.Equal(http.StatusOK, do("ann", "PUT", fmt.Sprintf("/api/channel/%d", ann.ID), updateChannel{Channel: &store.Channel{Title: "Ann", Alias: "ann"}}).Code)
+
+	w = do("bob", "POST", "/api/channel", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&bob)
+
+	assert.Len(list("admin"), 2)
+	assert.Len(list("ann"), 1)
+	assert.Equal(ann.ID, list("ann")[0].ID)
+
+	p, err := s.AddPodcastToChannel(bob.ID, "episode.mp3", "Episode", 10)
+	assert.Nil(err)
+
+	annPath := fmt.Sprintf("/api/channel/%d", ann.ID)
+	bobPath := fmt.Sprintf("/api/channel/%d", bob.ID)
+
+	tests := []struct {
+		user   string
+		method string
+		path   string
+		status int
+	}{
+		{"ann", "GET", annPath, http.StatusOK},
+		{"ann", "GET", bobPath, http.StatusForbidden},
+		{"ann", "DELETE", bobPath, http.StatusForbidden},
+		{"ann", "GET", fmt.Sprintf("%s/podcast/%d", bobPath, p.ID), http.StatusForbidden},
+		{"ann", "GET", fmt.Sprintf("%s/podcast/%d", annPath, p.ID), http.StatusNotFound},
+		{"admin", "GET", bobPath, http.StatusOK},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.status, do(tt.user, tt.method, tt.path, nil).Code, tt.user+" "+tt.method+" "+tt.path)
+	}
+
+	annUser, err := s.UserByName("ann")
+	assert.Nil(err)
+	member := fmt.Sprintf("%s/members/%d", bobPath, annUser.ID)
+
+	assert.Equal(http.StatusUnprocessableEntity, do("bob", "PUT", member, memberRequest{Role: "admin"}).Code)
+	assert.Equal(http.StatusNotFound, do("bob", "PUT", bobPath+"/members/100", memberRequest{Role: "viewer"}).Code)
+
+	// viewer in channel of bob, though editor in own one
+	assert.Equal(http.StatusOK, do("bob", "PUT", member, memberRequest{Role: "viewer"}).Code)
+	assert.Len(list("ann"), 2)
+	assert.Equal(http.StatusOK, do("ann", "GET", bobPath, nil).Code)
+	assert.Equal(http.StatusForbidden, do("ann", "DELETE", bobPath, nil).Code)
+	assert.Equal(http.StatusForbidden, do("ann", "PUT", member, memberRequest{Role: "owner"}).Code)
+
+	w = do("ann", "GET", bobPath+"/members", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	var ms []store.Member
+	err = json.NewDecoder(w.Body).Decode(&ms)
+	assert.Nil(err)
+	assert.Len(ms, 2)
+
+	assert.Equal(http.StatusOK, do("bob", "DELETE", member, nil).Code)
+	assert.Equal(http.StatusForbidden, do("ann", "GET", bobPath, nil).Code)
+	assert.Len(list("ann"), 1)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/azzzak/fakecast/metrics"
+	"github.com/go-chi/chi"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("fakecast_http_requests_total",
+		"Count of HTTP requests", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("fakecast_http_request_duration_seconds",
+		"Latency of HTTP requests", nil, "method", "route")
+	filesBytes = metrics.NewCounterVec("fakecast_files_bytes_total",
+		"Bytes served from /files", "channel")
+	uploads = metrics.NewCounterVec("fakecast_uploads_total",
+		"Count of uploaded files", "kind")
+	uploadBytes = metrics.NewCounterVec("fakecast_upload_bytes_total",
+		"Bytes of uploaded files", "kind")
+	feedRender = metrics.NewHistogramVec("fakecast_feed_render_seconds",
+		"Time to render a feed", nil, "channel")
+)
+
+// measure requests by route pattern, so ids in path don't blow up labels
+func (cfg *Cfg) measure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		httpRequests.Inc(r.Method, route, strconv.Itoa(sw.status))
+		httpDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// countFiles counts bytes served from /files per channel. Only channels of
+// store make labels, so probing of random paths doesn't blow them up
+func (cfg *Cfg) countFiles(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		if sw.status != 0 && sw.status != http.StatusOK && sw.status != http.StatusPartialContent {
+			return
+		}
+
+		label := "unknown"
+		alias := strings.SplitN(strings.TrimPrefix(chi.URLParam(r, "*"), "/"), "/", 2)[0]
+		if _, err := cfg.Store.SwapAliasForCID(alias); err == nil {
+			label = alias
+		}
+		filesBytes.Add(float64(sw.bytes), label)
+	})
+}
+
+// registerGauges reads counts from store and usage from disk on scrape
+func (cfg *Cfg) registerGauges() {
+	metrics.NewGaugeFunc("fakecast_channels", "Count of channels", func() float64 {
+		n, _ := cfg.Store.CountChannels()
+		return float64(n)
+	})
+
+	metrics.NewGaugeFunc("fakecast_episodes", "Count of episodes", func() float64 {
+		n, _ := cfg.Store.CountPodcasts()
+		return float64(n)
+	})
+
+	metrics.NewGaugeFunc("fakecast_disk_usage_bytes", "Disk usage of content", func() float64 {
+		n, _ := cfg.FS.Usage()
+		return float64(n)
+	})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	root := fs.NewRoot(testDir)
+
+	cfg := &Cfg{
+		Store:      s,
+		FS:         root,
+		Host:       "http://localhost",
+		Credential: "admin:admin",
+		Metrics: config.Metrics{
+			Enabled:    true,
+			Credential: "prom:secret",
+		},
+	}
+
+	id, err := s.AddChannel()
+	assert.Nil(err)
+
+	c, err := s.ChannelInfo(id)
+	assert.Nil(err)
+	c.Alias = "1"
+	err = s.UpdateChannel(c)
+	assert.Nil(err)
+
+	err = root.CreateDir(id)
+	assert.Nil(err)
+
+	err = ioutil.WriteFile(filepath.Join(root.Root, "1", "episode.mp3"), []byte("0123456789"), 0644)
+	assert.Nil(err)
+
+	h := InitHandlers(cfg)
+
+	before := filesBytes.Value("1")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/files/1/episode.mp3", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(before+10, filesBytes.Value("1"))
+
+	// misses and paths of no channel don't make labels
+	unknown := filesBytes.Value("unknown")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/files/1/missing.mp3", nil))
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.Equal(before+10, filesBytes.Value("1"))
+
+	err = os.MkdirAll(filepath.Join(root.Root, "stray"), os.ModePerm)
+	assert.Nil(err)
+	err = ioutil.WriteFile(filepath.Join(root.Root, "stray", "episode.mp3"), []byte("0123"), 0644)
+	assert.Nil(err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/files/stray/episode.mp3", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(unknown+4, filesBytes.Value("unknown"))
+	assert.Equal(float64(0), filesBytes.Value("stray"))
+	err = os.RemoveAll(filepath.Join(root.Root, "stray"))
+	assert.Nil(err)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.SetBasicAuth("admin", "admin")
+	h.ServeHTTP(w, r)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/metrics", nil)
+	r.SetBasicAuth("prom", "secret")
+	h.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	assert.True(strings.Contains(body, "fakecast_channels 1\n"))
+	assert.True(strings.Contains(body, "fakecast_episodes 0\n"))
+	assert.True(strings.Contains(body, "fakecast_disk_usage_bytes 10\n"))
+	assert.True(strings.Contains(body, `fakecast_http_requests_total{method="GET",route="/files/*",status="200"}`))
+	assert.True(strings.Contains(body, `fakecast_store_query_duration_seconds_count{method="CountChannels"}`))
+}
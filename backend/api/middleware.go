@@ -2,64 +2,322 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/store"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/cors"
 )
 
-func corsMiddleware() *cors.Cors {
+// corsMiddleware allows credentials from origins of admin UI only. Without
+// origins, cross-origin requests are not allowed at all
+func corsMiddleware(origins []string) *cors.Cors {
 	return cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			for _, o := range origins {
+				if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+					return true
+				}
+			}
+			return false
+		},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Authorization"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Requested-With"},
+		ExposedHeaders:   []string{"X-CSRF-Token"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
 }
 
+// channelID of request along with role of account in the channel. Accounts
+// which are not members of the channel and tokens of other channels are
+// forbidden
 func (cfg *Cfg) channelID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c := chi.URLParam(r, "channel")
-		id, err := strconv.ParseInt(c, 10, 64)
+		id, err := strconv.ParseInt(chi.URLParam(r, "channel"), 10, 64)
+		if err != nil || id <= 0 {
+			writeProblem(w, r, errNotFound("No such channel"))
+			return
+		}
+
+		role, err := cfg.roleIn(account(r), id)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			id = 0
+			writeProblem(w, r, err)
+			return
+		}
+		if role == "" {
+			writeProblem(w, r, errForbidden("Not a member of the channel"))
+			return
+		}
+		if t := apiToken(r); t != nil && t.Channel != 0 && t.Channel != id {
+			writeProblem(w, r, errForbidden("Token is restricted to another channel"))
+			return
+		}
+
+		if _, err := cfg.Store.SwapCIDForAlias(id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = errNotFound("No such channel")
+			}
+			writeProblem(w, r, err)
+			return
 		}
+
 		ctx := context.WithValue(r.Context(), CID, id)
+		ctx = context.WithValue(ctx, ChannelRole, role)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// podcastID of request. Podcast has to belong to the channel of request,
+// so membership in one channel doesn't open episodes of another
 func (cfg *Cfg) podcastID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c := chi.URLParam(r, "podcast")
-		id, err := strconv.ParseInt(c, 10, 64)
+		id, err := strconv.ParseInt(chi.URLParam(r, "podcast"), 10, 64)
+		if err != nil || id <= 0 {
+			writeProblem(w, r, errNotFound("No such podcast"))
+			return
+		}
+
+		cid, err := cfg.Store.ChannelOf(id)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			id = 0
+			writeProblem(w, r, err)
+			return
+		}
+		if cid != r.Context().Value(CID).(int64) {
+			writeProblem(w, r, errNotFound("No such podcast"))
+			return
 		}
+
 		ctx := context.WithValue(r.Context(), PID, id)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func basicAuth(realm string, creds map[string]string) func(next http.Handler) http.Handler {
+// deadline limits time to read a request and write a response
+func (cfg *Cfg) deadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(after(cfg.Server.ReadTimeout))
+		rc.SetWriteDeadline(after(cfg.Server.WriteTimeout))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stream lifts deadlines of long transfers like files and uploads. Deadlines
+// are extended while data is moving, so only a stalled client is cut off
+func (cfg *Cfg) stream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		idle := cfg.Server.StreamTimeout
+
+		rc.SetReadDeadline(after(idle))
+		rc.SetWriteDeadline(after(idle))
+
+		r.Body = &streamReader{ReadCloser: r.Body, rc: rc, idle: idle}
+		next.ServeHTTP(&streamWriter{ResponseWriter: w, rc: rc, idle: idle}, r)
+	})
+}
+
+// after returns deadline for timeout. Zero timeout means no deadline
+func after(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+type streamReader struct {
+	io.ReadCloser
+	rc   *http.ResponseController
+	idle time.Duration
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	n, err := sr.ReadCloser.Read(p)
+	if n > 0 {
+		sr.rc.SetReadDeadline(after(sr.idle))
+	}
+	return n, err
+}
+
+type streamWriter struct {
+	http.ResponseWriter
+	rc   *http.ResponseController
+	idle time.Duration
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	n, err := sw.ResponseWriter.Write(p)
+	if n > 0 {
+		sw.rc.SetWriteDeadline(after(sw.idle))
+	}
+	return n, err
+}
+
+func (sw *streamWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// hsts tells browsers to use HTTPS only
+func (cfg *Cfg) hsts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && cfg.TLS.HSTS > 0 {
+			w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int(cfg.TLS.HSTS.Seconds())))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientCert requires verified client certificate when client CA is set
+func (cfg *Cfg) clientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.TLS.ClientCA != "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			writeProblem(w, r, newProblem(http.StatusForbidden, "client_certificate_required", "Client certificate required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate user of admin area. While there are no accounts and no
+// identity provider it's open to anyone as owner, the way it was without
+// credentials. Scripts use tokens as Bearer instead of password, web UI
+// uses session cookie along with CSRF token for changes
+func (cfg *Cfg) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := cfg.Store.CountUsers("")
+		if err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+
+		u := &store.User{Role: string(auth.Owner)}
+		ctx := r.Context()
+
+		if n > 0 || cfg.oidc != nil {
+			if bearer, ok := bearerToken(r); ok {
+				if cfg.blocked(w, r, "token", "") {
+					return
+				}
+
+				t, err := cfg.Store.TokenByHash(auth.HashToken(bearer))
+				if err != nil || t.Expired(time.Now()) {
+					cfg.failed(r, "token", "", "invalid token")
+					bearerFailed(w, r)
+					return
+				}
+
+				if u, err = cfg.Store.UserInfo(t.User); err != nil {
+					bearerFailed(w, r)
+					return
+				}
+
+				if err := cfg.Store.TouchToken(t.ID, time.Now()); err != nil {
+					logger(r).Error("database error", "err", err)
+				}
+
+				ctx = context.WithValue(ctx, APIToken, t)
+			} else if ss := cfg.sessionOf(r); ss != nil {
+				if !safeMethod(r.Method) && !validCSRF(r, ss) {
+					writeProblem(w, r, newProblem(http.StatusForbidden, "invalid_csrf", "Invalid CSRF token"))
+					return
+				}
+
+				if u, err = cfg.Store.UserInfo(ss.User); err != nil {
+					loginFailed(w, r)
+					return
+				}
+
+				if err := cfg.Store.TouchSession(ss.ID, time.Now()); err != nil {
+					logger(r).Error("database error", "err", err)
+				}
+
+				w.Header().Set(csrfHeader, ss.CSRF)
+				ctx = context.WithValue(ctx, Session, ss)
+			} else {
+				name, pass, ok := r.BasicAuth()
+				if !ok {
+					loginFailed(w, r)
+					return
+				}
+
+				if cfg.blocked(w, r, "basic", name) {
+					return
+				}
+
+				if u, err = cfg.checkPassword(name, pass); err != nil {
+					cfg.failed(r, "basic", name, err.Error())
+					loginFailed(w, r)
+					return
+				}
+				cfg.succeeded(r, name)
+			}
+		}
+
+		ctx = context.WithValue(ctx, Account, u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// require role to pass. Within a channel it's the role in that channel,
+// otherwise role of account. Requests with token also need one of scopes,
+// so routes without scopes are for people only
+func require(role auth.Role) func(scopes ...auth.Scope) func(next http.Handler) http.Handler {
+	return func(scopes ...auth.Scope) func(next http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				current := auth.Role(account(r).Role)
+				if channelRole, ok := r.Context().Value(ChannelRole).(string); ok {
+					current = auth.Role(channelRole)
+				}
+
+				if !current.Allows(role) {
+					writeProblem(w, r, errForbidden("Role "+string(role)+" is required"))
+					return
+				}
+
+				if t := apiToken(r); t != nil && !hasScope(t, scopes) {
+					writeProblem(w, r, errForbidden("Token has no scope for this"))
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+}
+
+// basicAuth with credentials of config, compared in constant time
+func (cfg *Cfg) basicAuth(realm string, creds map[string]string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, pass, ok := r.BasicAuth()
 			if !ok {
-				basicAuthFailed(w, realm)
+				basicAuthFailed(w, r, realm)
+				return
+			}
+
+			if cfg.blocked(w, r, realm, "") {
 				return
 			}
 
-			credPass, credUserOk := creds[user]
-			if !credUserOk || pass != credPass {
-				basicAuthFailed(w, realm)
+			valid := 0
+			for credUser, credPass := range creds {
+				valid |= equal(user, credUser) & equal(pass, credPass)
+			}
+			if valid != 1 {
+				cfg.failed(r, realm, "", "password")
+				basicAuthFailed(w, r, realm)
 				return
 			}
 
@@ -68,13 +326,28 @@ func basicAuth(realm string, creds map[string]string) func(next http.Handler) ht
 	}
 }
 
-func basicAuthFailed(w http.ResponseWriter, realm string) {
+// equal strings in constant time, hashes hide length of secret too
+func equal(a, b string) int {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:])
+}
+
+func basicAuthFailed(w http.ResponseWriter, r *http.Request, realm string) {
 	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, realm))
-	w.WriteHeader(http.StatusUnauthorized)
+	writeProblem(w, r, newProblem(http.StatusUnauthorized, "unauthorized", "Login required"))
 }
 
-func void(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-	})
+// loginFailed asks browser for password, unless request is made by web UI
+// which shows its own login form
+func loginFailed(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		writeProblem(w, r, newProblem(http.StatusUnauthorized, "unauthorized", "Login required"))
+		return
+	}
+	basicAuthFailed(w, r, "auth")
+}
+
+func bearerFailed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="auth", error="invalid_token"`)
+	writeProblem(w, r, newProblem(http.StatusUnauthorized, "invalid_token", "Invalid token"))
 }
@@ -2,56 +2,263 @@ package api
 
 import (
 	"context"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/store"
 	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestChannelID(t *testing.T) {
 	assert := assert.New(t)
-	cfg := &Cfg{}
-
-	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cid := r.Context().Value(CID)
-		assert.NotNil(cid)
-		cidInt, ok := cid.(int64)
-		assert.Equal(true, ok)
-		assert.Equal(int64(123), cidInt)
-	})
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cfg := &Cfg{Store: s}
+
+	member := &store.User{Name: "member", Role: "viewer"}
+	err = s.AddUser(member)
+	assert.Nil(err)
 
-	r := httptest.NewRequest("GET", "/", nil)
+	cid, err := s.AddChannel()
+	assert.Nil(err)
+	err = s.SetMember(cid, member.ID, "uploader")
+	assert.Nil(err)
 
-	rctx := chi.NewRouteContext()
-	rctx.URLParams.Add("channel", "123")
+	owner := &store.User{Role: "owner"}
+	tests := []struct {
+		name    string
+		user    *store.User
+		channel string
+		status  int
+		role    string
+	}{
+		{"owner", owner, fmt.Sprint(cid), http.StatusOK, "owner"},
+		{"member", member, fmt.Sprint(cid), http.StatusOK, "uploader"},
+		{"stranger", &store.User{ID: 100, Role: "editor"}, fmt.Sprint(cid), http.StatusForbidden, ""},
+		{"unknown", owner, "123", http.StatusNotFound, ""},
+		{"invalid", owner, "abc", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				cid := r.Context().Value(CID)
+				assert.NotNil(cid)
+				cidInt, ok := cid.(int64)
+				assert.Equal(true, ok)
+				assert.Equal(cid, cidInt)
+				assert.Equal(tt.role, r.Context().Value(ChannelRole))
+			})
 
-	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			r := httptest.NewRequest("GET", "/", nil)
 
-	handlerToTest := cfg.channelID(nextHandler)
-	handlerToTest.ServeHTTP(httptest.NewRecorder(), r)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("channel", tt.channel)
+
+			ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+			r = r.WithContext(context.WithValue(ctx, Account, tt.user))
+
+			w := httptest.NewRecorder()
+			handlerToTest := cfg.channelID(nextHandler)
+			handlerToTest.ServeHTTP(w, r)
+
+			assert.Equal(tt.status, w.Code)
+			assert.Equal(tt.status == http.StatusOK, called)
+		})
+	}
 }
 
 func TestPodcastID(t *testing.T) {
 	assert := assert.New(t)
-	cfg := &Cfg{}
-
-	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		pid := r.Context().Value(PID)
-		assert.NotNil(pid)
-		pidInt, ok := pid.(int64)
-		assert.Equal(true, ok)
-		assert.Equal(int64(321), pidInt)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cfg := &Cfg{Store: s}
+
+	cid, err := s.AddChannel()
+	assert.Nil(err)
+
+	p, err := s.AddPodcastToChannel(cid, "episode.mp3", "Episode", 10)
+	assert.Nil(err)
+
+	tests := []struct {
+		name    string
+		channel int64
+		podcast string
+		status  int
+	}{
+		{"same channel", cid, fmt.Sprint(p.ID), http.StatusOK},
+		{"other channel", cid + 1, fmt.Sprint(p.ID), http.StatusNotFound},
+		{"unknown", cid, "321", http.StatusNotFound},
+		{"invalid", cid, "abc", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				pid := r.Context().Value(PID)
+				assert.NotNil(pid)
+				pidInt, ok := pid.(int64)
+				assert.Equal(true, ok)
+				assert.Equal(p.ID, pidInt)
+			})
+
+			r := httptest.NewRequest("GET", "/", nil)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("podcast", tt.podcast)
+
+			ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+			r = r.WithContext(context.WithValue(ctx, CID, tt.channel))
+
+			w := httptest.NewRecorder()
+			handlerToTest := cfg.podcastID(nextHandler)
+			handlerToTest.ServeHTTP(w, r)
+
+			assert.Equal(tt.status, w.Code)
+			assert.Equal(tt.status == http.StatusOK, called)
+		})
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &Cfg{
+		Server: config.Server{
+			WriteTimeout: 50 * time.Millisecond,
+		},
+	}
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("late"))
+	})
+
+	srv := httptest.NewServer(cfg.deadline(slow))
+	defer srv.Close()
+
+	_, err := http.Get(srv.URL)
+	assert.NotNil(err)
+}
+
+func TestStream(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &Cfg{
+		Server: config.Server{
+			WriteTimeout:  50 * time.Millisecond,
+			StreamTimeout: 100 * time.Millisecond,
+		},
+	}
+
+	chunks := 6
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < chunks; i++ {
+			w.Write([]byte("chunk"))
+			http.NewResponseController(w).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
 	})
 
-	r := httptest.NewRequest("GET", "/", nil)
+	srv := httptest.NewServer(cfg.deadline(cfg.stream(slow)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	assert.Nil(err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(err)
+	assert.Equal(strings.Repeat("chunk", chunks), string(body))
+}
+
+func TestHSTS(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &Cfg{
+		TLS: config.TLS{
+			HSTS: 24 * time.Hour,
+		},
+	}
+
+	handlerToTest := cfg.hsts(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handlerToTest.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil))
+	assert.Equal("", w.Header().Get("Strict-Transport-Security"))
+
+	w = httptest.NewRecorder()
+	handlerToTest.ServeHTTP(w, httptest.NewRequest("GET", "https://example.com/", nil))
+	assert.Equal("max-age=86400; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+}
 
-	rctx := chi.NewRouteContext()
-	rctx.URLParams.Add("podcast", "321")
+func TestClientCert(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientCA string
+		verified bool
+		want     int
+	}{
+		{
+			name: "mtls disabled",
+			want: http.StatusOK,
+		}, {
+			name:     "no certificate",
+			clientCA: "ca.pem",
+			want:     http.StatusForbidden,
+		}, {
+			name:     "verified",
+			clientCA: "ca.pem",
+			verified: true,
+			want:     http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Cfg{
+				TLS: config.TLS{
+					ClientCA: tt.clientCA,
+				},
+			}
 
-	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			r := httptest.NewRequest("GET", "https://example.com/api/list", nil)
+			if tt.verified {
+				r.TLS.VerifiedChains = [][]*x509.Certificate{{{}}}
+			}
 
-	handlerToTest := cfg.podcastID(nextHandler)
-	handlerToTest.ServeHTTP(httptest.NewRecorder(), r)
+			w := httptest.NewRecorder()
+			cfg.clientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
 }
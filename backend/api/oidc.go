@@ -0,0 +1,184 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/oidc"
+	"github.com/azzzak/fakecast/store"
+)
+
+const oidcCookie = "fakecast_oidc"
+
+type loginOptions struct {
+	Password bool `json:"password"`
+	OIDC     bool `json:"oidc"`
+}
+
+// loginOptions of web UI
+func (cfg *Cfg) loginOptions(w http.ResponseWriter, r *http.Request) error {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(loginOptions{Password: true, OIDC: cfg.oidc != nil}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// oidcRole of claims, the highest role of groups or default one
+func oidcRole(o config.OIDC, claims oidc.Claims) string {
+	role := auth.Role(o.DefaultRole)
+	for _, g := range claims.Strings(o.GroupsClaim) {
+		if r := auth.Role(o.Roles[g]); r.Valid() && !role.Allows(r) {
+			role = r
+		}
+	}
+
+	if !role.Valid() {
+		return ""
+	}
+	return string(role)
+}
+
+// oidcLogin sends user to identity provider. State, nonce and PKCE verifier
+// are kept in short lived cookie until callback
+func (cfg *Cfg) oidcLogin(w http.ResponseWriter, r *http.Request) error {
+	if cfg.oidc == nil {
+		return errNotFound("Single sign-on is not configured")
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		s, err := auth.NewSecret()
+		if err != nil {
+			return err
+		}
+		secrets[i] = s
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	to, err := cfg.oidc.AuthURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		return err
+	}
+
+	cfg.setOIDCCookie(w, r, strings.Join(secrets[:], "."), 600)
+	http.Redirect(w, r, to, http.StatusFound)
+	return nil
+}
+
+// oidcCallback of identity provider. User is created or gets role of
+// claims, then session is started as with password
+func (cfg *Cfg) oidcCallback(w http.ResponseWriter, r *http.Request) error {
+	if cfg.oidc == nil {
+		return errNotFound("Single sign-on is not configured")
+	}
+
+	c, err := r.Cookie(oidcCookie)
+	cfg.setOIDCCookie(w, r, "", -1)
+	if err != nil {
+		return errBadRequest("login_expired", "Login expired")
+	}
+
+	secrets := strings.Split(c.Value, ".")
+	state := r.URL.Query().Get("state")
+	if len(secrets) != 3 || subtle.ConstantTimeCompare([]byte(state), []byte(secrets[0])) != 1 {
+		return errBadRequest("invalid_state", "Invalid state")
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		logger(r).Warn("oidc login failed", "error", e, "description", r.URL.Query().Get("error_description"))
+		return newProblem(http.StatusUnauthorized, "login_failed", "Login failed")
+	}
+
+	claims, err := cfg.oidc.Exchange(r.Context(), r.URL.Query().Get("code"), secrets[2], secrets[1])
+	if err != nil {
+		logger(r).Warn("oidc login failed", "err", err)
+		return newProblem(http.StatusUnauthorized, "login_failed", "Login failed")
+	}
+
+	name := claims.String(cfg.Auth.OIDC.UsernameClaim)
+	role := oidcRole(cfg.Auth.OIDC, claims)
+	if name == "" || role == "" {
+		logger(r).Warn("oidc user has no access", "user", name, "sub", claims.String("sub"))
+		return errForbidden("User has no access")
+	}
+
+	u, err := cfg.oidcUser(r, claims.String("iss"), claims.String("sub"), name, role)
+	if err != nil {
+		return err
+	}
+
+	if _, err := cfg.startSession(w, r, u); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, cfg.baseURL+"/", http.StatusFound)
+	return nil
+}
+
+// oidcUser of identity, which is bound by issuer and subject, never by
+// name alone. Account of the same name is taken over only if it has no
+// password and no other identity, like accounts created before binding.
+// Role follows provider, except the last owner is never demoted
+func (cfg *Cfg) oidcUser(r *http.Request, issuer, subject, name, role string) (*store.User, error) {
+	if subject == "" {
+		return nil, errForbidden("User has no subject")
+	}
+
+	u, err := cfg.Store.UserBySubject(issuer, subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		u, err = cfg.Store.UserByName(name)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			u = &store.User{Name: name, Role: role, Issuer: issuer, Subject: subject}
+			return u, cfg.Store.AddUser(u)
+		case err != nil:
+			return nil, err
+		case u.PasswordHash != "" || u.Subject != "":
+			logger(r).Warn("oidc user clashes with account", "user", name, "sub", subject)
+			return nil, errConflict("user_exists", "Account of the same name exists")
+		}
+
+		u.Issuer, u.Subject = issuer, subject
+		if err := cfg.Store.UpdateUser(u); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if u.Role == role {
+		return u, nil
+	}
+
+	last, err := cfg.lastOwner(u)
+	if err != nil {
+		return nil, err
+	}
+	if last {
+		logger(r).Warn("last owner keeps role", "user", u.Name, "role", role)
+		return u, nil
+	}
+
+	u.Role = role
+	return u, cfg.Store.UpdateUser(u)
+}
+
+func (cfg *Cfg) setOIDCCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     cfg.baseURL + "/api/oidc",
+		MaxAge:   maxAge,
+		Secure:   r.TLS != nil || strings.HasPrefix(cfg.Host, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/oidc/oidctest"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOIDCRole(t *testing.T) {
+	o := config.OIDC{
+		GroupsClaim: "groups",
+		Roles:       map[string]string{"admins": "owner", "staff": "editor", "interns": "viewer"},
+	}
+
+	tests := []struct {
+		name        string
+		groups      interface{}
+		defaultRole string
+		want        string
+	}{
+		{"highest", []interface{}{"interns", "staff"}, "", "editor"},
+		{"owner", []interface{}{"admins", "staff"}, "", "owner"},
+		{"single", "staff", "", "editor"},
+		{"unknown", []interface{}{"guests"}, "", ""},
+		{"default", []interface{}{"guests"}, "viewer", "viewer"},
+		{"above default", []interface{}{"staff"}, "uploader", "editor"},
+		{"no groups", nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.DefaultRole = tt.defaultRole
+			assert.Equal(t, tt.want, oidcRole(o, map[string]interface{}{"groups": tt.groups}))
+		})
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	idp := oidctest.NewServer("fakecast", "secret")
+	defer idp.Close()
+
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "http://localhost/admin",
+		Auth: config.Auth{
+			OIDC: config.OIDC{
+				Issuer:        idp.URL,
+				ClientID:      "fakecast",
+				ClientSecret:  "secret",
+				UsernameClaim: "preferred_username",
+				GroupsClaim:   "groups",
+				Roles:         map[string]string{"podcasters": "editor", "admins": "owner"},
+			},
+		},
+	})
+
+	do := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("X-Requested-With", "XMLHttpRequest")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	cookieOf := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+
+	// login with provider up to callback, which is returned with cookie of login
+	start := func() (string, *http.Cookie) {
+		w := do("/admin/api/oidc/login")
+		assert.Equal(http.StatusFound, w.Code)
+		c := cookieOf(w, oidcCookie)
+		assert.NotNil(c)
+		assert.Equal("/admin/api/oidc", c.Path)
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := client.Get(w.Header().Get("Location"))
+		assert.Nil(err)
+		resp.Body.Close()
+
+		back, err := url.Parse(resp.Header.Get("Location"))
+		assert.Nil(err)
+		assert.Equal("/admin/api/oidc/callback", back.Path)
+		return back.RequestURI(), c
+	}
+
+	// provider makes no open access
+	assert.Equal(http.StatusUnauthorized, do("/admin/api/list").Code)
+
+	w := do("/admin/api/login")
+	assert.Equal(http.StatusOK, w.Code)
+	var opts loginOptions
+	err = json.NewDecoder(w.Body).Decode(&opts)
+	assert.Nil(err)
+	assert.True(opts.OIDC)
+
+	idp.Claims["sub"] = "alice-1"
+	idp.Claims["preferred_username"] = "alice"
+	idp.Claims["groups"] = []string{"podcasters"}
+
+	callback, c := start()
+	assert.Equal(http.StatusBadRequest, do(callback).Code)
+	assert.Equal(http.StatusBadRequest, do(callback, &http.Cookie{Name: oidcCookie, Value: "a.b.c"}).Code)
+
+	callback, c = start()
+	w = do(callback, c)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("/admin/", w.Header().Get("Location"))
+	assert.Equal(-1, cookieOf(w, oidcCookie).MaxAge)
+
+	session := cookieOf(w, sessionCookie)
+	assert.NotNil(session)
+
+	w = do("/admin/api/me", session)
+	assert.Equal(http.StatusOK, w.Code)
+	var me store.User
+	err = json.NewDecoder(w.Body).Decode(&me)
+	assert.Nil(err)
+	assert.Equal("alice", me.Name)
+	assert.Equal("editor", me.Role)
+
+	// code can't be used again
+	assert.Equal(http.StatusUnauthorized, do(callback, c).Code)
+
+	// role follows provider
+	idp.Claims["groups"] = []string{"guests"}
+	callback, c = start()
+	assert.Equal(http.StatusForbidden, do(callback, c).Code)
+
+	alice, err := s.UserByName("alice")
+	assert.Nil(err)
+	assert.Equal("editor", alice.Role)
+	assert.Empty(alice.PasswordHash)
+	assert.Equal(idp.URL, alice.Issuer)
+	assert.Equal("alice-1", alice.Subject)
+
+	// another subject with the same name is not let in as alice
+	idp.Claims["sub"] = "mallory"
+	idp.Claims["groups"] = []string{"podcasters"}
+	callback, c = start()
+	assert.Equal(http.StatusConflict, do(callback, c).Code)
+
+	// nor as account with password
+	err = s.AddUser(&store.User{Name: "bob", Role: "owner", PasswordHash: "hash"})
+	assert.Nil(err)
+	idp.Claims["preferred_username"] = "bob"
+	idp.Claims["groups"] = []string{"admins"}
+	callback, c = start()
+	assert.Equal(http.StatusConflict, do(callback, c).Code)
+
+	// subject keeps its account, whatever the name
+	idp.Claims["sub"] = "alice-1"
+	callback, c = start()
+	w = do(callback, c)
+	assert.Equal(http.StatusFound, w.Code)
+	w = do("/admin/api/me", cookieOf(w, sessionCookie))
+	err = json.NewDecoder(w.Body).Decode(&me)
+	assert.Nil(err)
+	assert.Equal("alice", me.Name)
+	assert.Equal("owner", me.Role)
+
+	// last owner is not demoted by provider
+	bob, err := s.UserByName("bob")
+	assert.Nil(err)
+	err = s.DeleteUser(bob.ID)
+	assert.Nil(err)
+	idp.Claims["groups"] = []string{"podcasters"}
+	callback, c = start()
+	assert.Equal(http.StatusFound, do(callback, c).Code)
+	alice, err = s.UserByName("alice")
+	assert.Nil(err)
+	assert.Equal("owner", alice.Role)
+}
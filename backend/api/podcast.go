@@ -2,10 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/azzzak/fakecast/fs"
@@ -13,7 +16,7 @@ import (
 )
 
 func (cfg *Cfg) uploadPodcast(w http.ResponseWriter, r *http.Request) error {
-	file, header, err := r.FormFile("file")
+	file, header, err := formFile(r, "file")
 	if err != nil {
 		return err
 	}
@@ -35,20 +38,27 @@ func (cfg *Cfg) uploadPodcast(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	holder, err := cfg.FS.SavePodcastToDir(short, filename)
+	// file is saved before its row, so failed upload leaves neither
+	n, err := cfg.savePodcast(short, filename, file)
 	if err != nil {
 		return err
 	}
-	defer holder.Close()
 
 	title, _ := fs.NameAndExtFrom(filename)
 
-	podcast, err := cfg.Store.AddPodcastToChannel(cid, filename, title, r.FormValue("length"))
+	// length is what is saved, not what client claims
+	podcast, err := cfg.Store.AddPodcastToChannel(cid, filename, title, n)
 	if err != nil {
+		if err := cfg.FS.RemovePodcast(short, filename); err != nil {
+			logger(r).Warn("uploaded file is not removed", "err", err)
+		}
 		return err
 	}
 
-	io.Copy(holder, file)
+	uploads.Inc("podcast")
+	uploadBytes.Add(float64(n), "podcast")
+
+	cfg.record(r, "podcast.upload", podcastTarget(podcast.ID), cid, nil, podcast)
 
 	encoder := json.NewEncoder(w)
 	if err := encoder.Encode(podcast); err != nil {
@@ -58,6 +68,34 @@ func (cfg *Cfg) uploadPodcast(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// savePodcast of upload to channel dir. Partial file is removed. Failed
+// write keeps its error, so full disk is reported as such, failed read
+// of upload is bad request
+func (cfg *Cfg) savePodcast(channel, filename string, file io.Reader) (int64, error) {
+	holder, err := cfg.FS.SavePodcastToDir(channel, filename)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(holder, file)
+	if cerr := holder.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		return n, nil
+	}
+
+	cfg.FS.RemovePodcast(channel, filename)
+
+	var pe *os.PathError
+	if errors.As(err, &pe) || errors.Is(err, syscall.ENOSPC) {
+		return n, err
+	}
+	p := newProblem(http.StatusBadRequest, "invalid_upload", "Upload is not complete")
+	p.cause = err
+	return n, p
+}
+
 func (cfg *Cfg) podcastInfo(w http.ResponseWriter, r *http.Request) error {
 	pid := r.Context().Value(PID).(int64)
 
@@ -77,21 +115,39 @@ func (cfg *Cfg) podcastInfo(w http.ResponseWriter, r *http.Request) error {
 func (cfg *Cfg) updatePodcast(w http.ResponseWriter, r *http.Request) error {
 	var p *store.Podcast
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&p); err != nil {
+	if err := decodeJSON(r, &p); err != nil {
+		return err
+	}
+	if p == nil {
+		return errInvalid("Invalid podcast", fieldError{Field: "podcast", Message: "is required"})
+	}
+
+	// podcast of URL is checked against channel, not the one of body
+	p.ID = r.Context().Value(PID).(int64)
+
+	before, err := cfg.Store.PodcastInfo(p.ID)
+	if err != nil {
 		return err
 	}
 
+	// artwork is set by its upload only
+	p.Artwork = before.Artwork
+
 	if p.GUID == "" {
 		now := time.Now()
 		p.GUID = fmt.Sprintf("%x", now.Unix())
 		p.PubDate = now.UTC().Format("Mon, 2 Jan 2006 15:04:05 MST")
 	}
 
-	err := cfg.Store.UpdatePodcast(p)
+	if err = cfg.Store.UpdatePodcast(p); err != nil {
+		return err
+	}
+
+	after, err := cfg.Store.PodcastInfo(p.ID)
 	if err != nil {
 		return err
 	}
+	cfg.record(r, "podcast.update", podcastTarget(p.ID), r.Context().Value(CID).(int64), before, after)
 
 	return nil
 }
@@ -105,20 +161,37 @@ func (cfg *Cfg) deletePodcast(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	filename, err := cfg.Store.SwapPIDForFilename(pid)
+	p, err := cfg.Store.PodcastInfo(pid)
 	if err != nil {
 		return err
 	}
 
-	err = cfg.Store.DeletePodcast(pid)
-	if err != nil {
-		return err
+	files := []string{p.Filename}
+	if p.Artwork != "" {
+		files = append(files, coverFiles(p.Artwork)...)
 	}
 
-	err = cfg.FS.RemovePodcast(short, filename)
+	var (
+		t     *store.TrashItem
+		moved bool
+	)
+	err = cfg.Store.WithTx(func(tx *store.Store) error {
+		if t, err = tx.TrashPodcast(pid, account(r).Name); err != nil {
+			return err
+		}
+		// some files may be moved even if it fails
+		moved = true
+		return cfg.FS.TrashFiles(t.Path(), short, files...)
+	})
 	if err != nil {
+		if moved {
+			if _, err := cfg.FS.Restore(t.Path(), short); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger(r).Error("podcast files are not moved back", "err", err)
+			}
+		}
 		return err
 	}
 
+	cfg.record(r, "podcast.delete", podcastTarget(pid), cid, p, nil)
 	return nil
 }
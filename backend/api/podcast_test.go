@@ -4,14 +4,16 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/azzzak/fakecast/fs"
@@ -91,7 +93,8 @@ func TestUploadPodcast(t *testing.T) {
 
 			part.Write(fileContents)
 
-			writer.WriteField("length", strconv.Itoa(length))
+			// length claimed by client is not trusted
+			writer.WriteField("length", "unknown")
 
 			err = writer.Close()
 			assert.Nil(err)
@@ -130,10 +133,48 @@ func TestUploadPodcast(t *testing.T) {
 			file.Close()
 
 			assert.Equal(int64(length), fi.Size())
+
+			p, err := s.PodcastInfo(1)
+			assert.Nil(err)
+			assert.Equal(length, p.Length)
 		})
 	}
 }
 
+func TestSavePodcast(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+	defer func() {
+		err := os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cfg := &Cfg{FS: fs.NewRoot(testDir)}
+	err := cfg.FS.CreateDir(1)
+	assert.Nil(err)
+
+	n, err := cfg.savePodcast("1", "ok.mp3", strings.NewReader("audio"))
+	assert.Nil(err)
+	assert.Equal(int64(5), n)
+	assert.True(cfg.FS.IsPodcastExist("1", "ok.mp3"))
+
+	// broken upload is bad request, partial file is removed
+	_, err = cfg.savePodcast("1", "broken.mp3", io.MultiReader(strings.NewReader("au"), iotest.ErrReader(io.ErrUnexpectedEOF)))
+	assert.Equal(http.StatusBadRequest, problemOf(err).Status)
+	assert.False(cfg.FS.IsPodcastExist("1", "broken.mp3"))
+
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+
+	// full disk is reported as such
+	err = os.Symlink("/dev/full", filepath.Join(cfg.FS.Root, "1", "full.mp3"))
+	assert.Nil(err)
+	_, err = cfg.savePodcast("1", "full.mp3", strings.NewReader("audio"))
+	assert.Equal(http.StatusInsufficientStorage, problemOf(err).Status)
+	assert.False(cfg.FS.IsPodcastExist("1", "full.mp3"))
+}
+
 func TestPodcastInfo(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -186,7 +227,7 @@ func TestPodcastInfo(t *testing.T) {
 			err = root.CreateDir(c.ID)
 			assert.Nil(err)
 
-			_, err = s.AddPodcastToChannel(c.ID, "podcast.mp3", "podcast", "10001")
+			_, err = s.AddPodcastToChannel(c.ID, "podcast.mp3", "podcast", 10001)
 			assert.Nil(err)
 
 			_, err = os.Create(filepath.Join(testDir, fs.PodcastsDirName, "1", "podcast.mp3"))
@@ -285,7 +326,7 @@ func TestUpdatePodcast(t *testing.T) {
 			err = root.CreateDir(c.ID)
 			assert.Nil(err)
 
-			_, err = s.AddPodcastToChannel(c.ID, "podcast.mp3", "p", "10001")
+			_, err = s.AddPodcastToChannel(c.ID, "podcast.mp3", "p", 10001)
 			assert.Nil(err)
 
 			p, err := s.PodcastInfo(1)
@@ -302,14 +343,21 @@ func TestUpdatePodcast(t *testing.T) {
 			jsonStr, err := json.Marshal(p)
 			assert.Nil(err)
 
+			// empty body is rejected, not dereferenced
+			r := httptest.NewRequest("PUT", "/api/channel/1/podcast/1", strings.NewReader("null"))
+			w := httptest.NewRecorder()
+			InitHandlers(cfg).ServeHTTP(w, r)
+			assert.Equal(http.StatusUnprocessableEntity, w.Code)
+			assert.Contains(w.Body.String(), `"field":"podcast"`)
+
 			if tt.wantErr {
 				err := s.DropPodcasts()
 				assert.Nil(err)
 			}
 
-			r := httptest.NewRequest("PUT", "/api/channel/1/podcast/1", bytes.NewBuffer(jsonStr))
+			r = httptest.NewRequest("PUT", "/api/channel/1/podcast/1", bytes.NewBuffer(jsonStr))
 
-			w := httptest.NewRecorder()
+			w = httptest.NewRecorder()
 			handler := http.Handler(InitHandlers(cfg))
 			handler.ServeHTTP(w, r)
 
@@ -332,7 +380,6 @@ func TestUpdatePodcast(t *testing.T) {
 				Title:       "podcast",
 				Description: "desc",
 				Duration:    101,
-				Artwork:     "omahe.png",
 				Explicit:    1,
 				Season:      2,
 				Episode:     3,
@@ -402,7 +449,7 @@ func TestDeletePodcast(t *testing.T) {
 			assert.Nil(err)
 
 			for i := 1; i < 4; i++ {
-				_, err := s.AddPodcastToChannel(c.ID, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), fmt.Sprintf("1000%d", i))
+				_, err := s.AddPodcastToChannel(c.ID, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), int64(10000+i))
 				assert.Nil(err)
 
 				_, err = os.Create(filepath.Join(testDir, fs.PodcastsDirName, "1", fmt.Sprintf("podcast%d.mp3", i)))
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"syscall"
+
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is failure of request reported to client as RFC 7807 problem
+// details. Code is machine-readable kind of problem
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Code     string       `json:"code"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []fieldError `json:"errors,omitempty"`
+
+	// cause is logged, it's never shown to client
+	cause error
+}
+
+// fieldError of invalid input
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (p *problem) Error() string {
+	if p.cause != nil {
+		return p.Code + ": " + p.cause.Error()
+	}
+	return p.Code + ": " + p.Detail
+}
+
+// Unwrap cause of problem
+func (p *problem) Unwrap() error {
+	return p.cause
+}
+
+func newProblem(status int, code, detail string) *problem {
+	return &problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+func errBadRequest(code, detail string) error {
+	return newProblem(http.StatusBadRequest, code, detail)
+}
+
+func errForbidden(detail string) error {
+	return newProblem(http.StatusForbidden, "forbidden", detail)
+}
+
+func errNotFound(detail string) error {
+	return newProblem(http.StatusNotFound, "not_found", detail)
+}
+
+func errConflict(code, detail string) error {
+	return newProblem(http.StatusConflict, code, detail)
+}
+
+// errInvalid input with errors of its fields
+func errInvalid(detail string, fields ...fieldError) error {
+	p := newProblem(http.StatusUnprocessableEntity, "validation_failed", detail)
+	p.Errors = fields
+	return p
+}
+
+// problemOf error returned by handler. Errors of store and filesystem are
+// classified, anything else is internal error
+func problemOf(err error) *problem {
+	var p *problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		p = newProblem(http.StatusNotFound, "not_found", "Not found")
+	case errors.Is(err, store.ErrConflict):
+		p = newProblem(http.StatusConflict, "conflict", "Conflicts with existing data")
+	case errors.Is(err, store.ErrFull), errors.Is(err, syscall.ENOSPC):
+		p = newProblem(http.StatusInsufficientStorage, "storage_full", "Storage is full")
+	default:
+		p = newProblem(http.StatusInternalServerError, "internal_error", "")
+	}
+	p.cause = err
+	return p
+}
+
+// writeProblem of request. Server errors are logged along with their cause
+func writeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemOf(err)
+
+	if p.Status >= http.StatusInternalServerError {
+		var (
+			se *store.Error
+			fe *fs.Error
+		)
+		switch {
+		case errors.As(err, &se):
+			logger(r).Error("database error", "err", err)
+		case errors.As(err, &fe):
+			logger(r).Error("filesystem error", "err", err)
+		default:
+			logger(r).Error("request failed", "err", err)
+		}
+	}
+
+	out := *p
+	out.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(out)
+}
+
+// decodeJSON body of request into v, malformed body is bad request
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		p := newProblem(http.StatusBadRequest, "invalid_json", "Body is not valid JSON")
+		p.cause = err
+		return p
+	}
+	return nil
+}
+
+// formFile of upload. Broken multipart body is bad request, full disk while
+// it's spooled stays as it is
+func formFile(r *http.Request, key string) (multipart.File, *multipart.FileHeader, error) {
+	file, header, err := r.FormFile(key)
+	switch {
+	case err == nil:
+		return file, header, nil
+	case errors.Is(err, http.ErrMissingFile):
+		return nil, nil, errInvalid("No file", fieldError{Field: key, Message: "is required"})
+	case errors.Is(err, syscall.ENOSPC):
+		return nil, nil, err
+	}
+
+	p := newProblem(http.StatusBadRequest, "invalid_upload", "Upload is not valid multipart form")
+	p.cause = err
+	return nil, nil, p
+}
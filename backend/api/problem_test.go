@@ -0,0 +1,68 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/azzzak/fakecast/store"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"problem", errConflict("alias_taken", "Alias is taken"), http.StatusConflict, "alias_taken"},
+		{"wrapped problem", fmt.Errorf("restore: %w", errForbidden("No")), http.StatusForbidden, "forbidden"},
+		{"no rows", &store.Error{Op: "ChannelInfo", Err: sql.ErrNoRows}, http.StatusNotFound, "not_found"},
+		{"constraint", &store.Error{Op: "AddUser", Err: sqlite3.Error{Code: sqlite3.ErrConstraint}}, http.StatusConflict, "conflict"},
+		{"database full", &store.Error{Op: "AddPodcast", Err: sqlite3.Error{Code: sqlite3.ErrFull}}, http.StatusInsufficientStorage, "storage_full"},
+		{"disk full", fmt.Errorf("write: %w", syscall.ENOSPC), http.StatusInsufficientStorage, "storage_full"},
+		{"other", errors.New("boom"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := problemOf(tt.err)
+			assert.Equal(t, tt.status, p.Status)
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, http.StatusText(tt.status), p.Title)
+		})
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	assert := assert.New(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "/api/users/2", nil)
+	writeProblem(w, r, errInvalid("Invalid user", roleError))
+
+	assert.Equal(http.StatusUnprocessableEntity, w.Code)
+	assert.Equal("application/problem+json", w.Header().Get("Content-Type"))
+
+	var p problem
+	err := json.NewDecoder(w.Body).Decode(&p)
+	assert.Nil(err)
+	assert.Equal("validation_failed", p.Code)
+	assert.Equal("/api/users/2", p.Instance)
+	assert.Equal([]fieldError{roleError}, p.Errors)
+
+	// cause of server error stays in log
+	w = httptest.NewRecorder()
+	writeProblem(w, r, &store.Error{Op: "UpdateUser", Err: errors.New("secret detail")})
+
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.NotContains(w.Body.String(), "secret detail")
+	assert.Contains(w.Body.String(), `"code":"internal_error"`)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/store"
+	"github.com/go-chi/chi"
+)
+
+const (
+	sessionCookie = "fakecast_session"
+	csrfHeader    = "X-CSRF-Token"
+
+	defaultSessionTTL = 24 * time.Hour
+)
+
+type loginRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type loginResponse struct {
+	User *store.User `json:"user"`
+	CSRF string      `json:"csrf"`
+}
+
+// session of request, nil if it's made without session cookie
+func session(r *http.Request) *store.Session {
+	ss, _ := r.Context().Value(Session).(*store.Session)
+	return ss
+}
+
+// sessionOf cookie of request, nil if there is no valid session
+func (cfg *Cfg) sessionOf(r *http.Request) *store.Session {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || c.Value == "" {
+		return nil
+	}
+
+	ss, err := cfg.Store.SessionByHash(auth.HashToken(c.Value))
+	if err != nil {
+		return nil
+	}
+	return ss
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// validCSRF token in header of request
+func validCSRF(r *http.Request, ss *store.Session) bool {
+	token := r.Header.Get(csrfHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(ss.CSRF)) == 1
+}
+
+func (cfg *Cfg) sessionTTL() time.Duration {
+	if cfg.Auth.SessionTTL > 0 {
+		return cfg.Auth.SessionTTL
+	}
+	return defaultSessionTTL
+}
+
+// setSessionCookie of value, which is removed if maxAge is negative. It's
+// sent to API only and never read by scripts of page
+func (cfg *Cfg) setSessionCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     cfg.baseURL + "/api",
+		MaxAge:   maxAge,
+		Secure:   r.TLS != nil || strings.HasPrefix(cfg.Host, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// login to web UI with password. Session is started with cookie and CSRF
+// token, which has to be sent back in header with every change
+func (cfg *Cfg) login(w http.ResponseWriter, r *http.Request) error {
+	var req loginRequest
+
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+
+	if cfg.blocked(w, r, "password", req.Name) {
+		return nil
+	}
+
+	u, err := cfg.checkPassword(req.Name, req.Password)
+	if err != nil {
+		cfg.failed(r, "password", req.Name, err.Error())
+		return newProblem(http.StatusUnauthorized, "invalid_credentials", "Invalid credentials")
+	}
+	cfg.succeeded(r, req.Name)
+
+	csrf, err := cfg.startSession(w, r, u)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(loginResponse{User: u, CSRF: csrf}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// startSession of user with cookie, returning its CSRF token
+func (cfg *Cfg) startSession(w http.ResponseWriter, r *http.Request, u *store.User) (string, error) {
+	id, err := auth.NewSecret()
+	if err != nil {
+		return "", err
+	}
+	csrf, err := auth.NewSecret()
+	if err != nil {
+		return "", err
+	}
+
+	ss := &store.Session{
+		User:      u.ID,
+		Hash:      auth.HashToken(id),
+		CSRF:      csrf,
+		IP:        cfg.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if err := cfg.Store.AddSession(ss, cfg.sessionTTL()); err != nil {
+		return "", err
+	}
+
+	cfg.setSessionCookie(w, r, id, int(cfg.sessionTTL().Seconds()))
+	w.Header().Set(csrfHeader, csrf)
+
+	return csrf, nil
+}
+
+// logout ends session of request
+func (cfg *Cfg) logout(w http.ResponseWriter, r *http.Request) error {
+	if ss := session(r); ss != nil {
+		if _, err := cfg.Store.DeleteSession(ss.User, ss.ID); err != nil {
+			return err
+		}
+	}
+
+	cfg.setSessionCookie(w, r, "", -1)
+	return nil
+}
+
+func (cfg *Cfg) listSessions(w http.ResponseWriter, r *http.Request) error {
+	sss, err := cfg.Store.SessionsOf(account(r).ID)
+	if err != nil {
+		return err
+	}
+
+	if current := session(r); current != nil {
+		for i := range sss {
+			sss[i].Current = sss[i].ID == current.ID
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(sss); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deleteSession of account, which logs it out on that device
+func (cfg *Cfg) deleteSession(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.ParseInt(chi.URLParam(r, "session"), 10, 64)
+	if err != nil {
+		return errNotFound("No such session")
+	}
+
+	ok, err := cfg.Store.DeleteSession(account(r).ID, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNotFound("No such session")
+	}
+
+	if ss := session(r); ss != nil && ss.ID == id {
+		cfg.setSessionCookie(w, r, "", -1)
+	}
+
+	return nil
+}
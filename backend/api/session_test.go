@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "https://localhost/admin",
+		Users: []config.User{{Name: "ed", Password: "pass", Role: "editor"}},
+	})
+
+	do := func(cookie *http.Cookie, csrf, method, path string, body interface{}) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		r := httptest.NewRequest(method, path, &b)
+		r.Header.Set("X-Requested-With", "XMLHttpRequest")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		if csrf != "" {
+			r.Header.Set(csrfHeader, csrf)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	login := func() (*http.Cookie, string) {
+		w := do(nil, "", "POST", "/admin/api/login", loginRequest{Name: "ed", Password: "pass"})
+		assert.Equal(http.StatusOK, w.Code)
+
+		var resp loginResponse
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		assert.Nil(err)
+		assert.Equal("ed", resp.User.Name)
+		assert.NotEmpty(resp.CSRF)
+
+		cookies := w.Result().Cookies()
+		assert.Len(cookies, 1)
+		return cookies[0], resp.CSRF
+	}
+
+	w := do(nil, "", "POST", "/admin/api/login", loginRequest{Name: "ed", Password: "wrong"})
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Empty(w.Result().Cookies())
+
+	// web UI gets no password prompt of browser
+	w = do(nil, "", "GET", "/admin/api/me", nil)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Empty(w.Header().Get("WWW-Authenticate"))
+
+	cookie, csrf := login()
+	assert.Equal(sessionCookie, cookie.Name)
+	assert.Equal("/admin/api", cookie.Path)
+	assert.True(cookie.HttpOnly)
+	assert.True(cookie.Secure)
+	assert.Equal(http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(int(defaultSessionTTL.Seconds()), cookie.MaxAge)
+
+	w = do(cookie, "", "GET", "/admin/api/me", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(csrf, w.Header().Get(csrfHeader))
+
+	assert.Equal(http.StatusForbidden, do(cookie, "", "POST", "/admin/api/channel", nil).Code)
+	assert.Equal(http.StatusForbidden, do(cookie, "wrong", "POST", "/admin/api/channel", nil).Code)
+	assert.Equal(http.StatusOK, do(cookie, csrf, "POST", "/admin/api/channel", nil).Code)
+
+	other, otherCSRF := login()
+	assert.NotEqual(csrf, otherCSRF)
+	assert.Equal(http.StatusForbidden, do(other, csrf, "POST", "/admin/api/channel", nil).Code)
+
+	w = do(cookie, "", "GET", "/admin/api/sessions", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	var sss []store.Session
+	err = json.NewDecoder(w.Body).Decode(&sss)
+	assert.Nil(err)
+	assert.Len(sss, 2)
+	var current int
+	for _, ss := range sss {
+		if ss.Current {
+			current++
+		}
+	}
+	assert.Equal(1, current)
+
+	// revoke the other one
+	var otherID int64
+	for _, ss := range sss {
+		if !ss.Current {
+			otherID = ss.ID
+		}
+	}
+	assert.Equal(http.StatusOK, do(cookie, csrf, "DELETE", fmt.Sprintf("/admin/api/sessions/%d", otherID), nil).Code)
+	assert.Equal(http.StatusUnauthorized, do(other, "", "GET", "/admin/api/me", nil).Code)
+	assert.Equal(http.StatusNotFound, do(cookie, csrf, "DELETE", fmt.Sprintf("/admin/api/sessions/%d", otherID), nil).Code)
+
+	assert.Equal(http.StatusForbidden, do(cookie, "", "POST", "/admin/api/logout", nil).Code)
+	w = do(cookie, csrf, "POST", "/admin/api/logout", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(-1, w.Result().Cookies()[0].MaxAge)
+	assert.Equal(http.StatusUnauthorized, do(cookie, "", "GET", "/admin/api/me", nil).Code)
+
+	// expired session is refused
+	ed, err := s.UserByName("ed")
+	assert.Nil(err)
+	err = s.AddSession(&store.Session{User: ed.ID, Hash: "expired", CSRF: "csrf"}, -time.Second)
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, do(&http.Cookie{Name: sessionCookie, Value: "expired"}, "", "GET", "/admin/api/me", nil).Code)
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		allowed bool
+	}{
+		{"allowed", []string{"http://localhost:3000"}, "http://localhost:3000", true},
+		{"trailing slash", []string{"http://localhost:3000/"}, "http://localhost:3000", true},
+		{"other", []string{"http://localhost:3000"}, "https://evil.example.com", false},
+		{"none", nil, "http://localhost:3000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			h := corsMiddleware(tt.origins).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest("OPTIONS", "/api/list", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", "GET")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if tt.allowed {
+				assert.Equal(tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Equal("true", w.Header().Get("Access-Control-Allow-Credentials"))
+			} else {
+				assert.Empty(w.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
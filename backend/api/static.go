@@ -1,7 +1,7 @@
 package api
 
 import (
-	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -15,6 +15,13 @@ type protect struct {
 }
 
 func (nfs protect) Open(path string) (http.File, error) {
+	// dot files like trash are never served
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, ".") {
+			return nil, os.ErrNotExist
+		}
+	}
+
 	f, err := nfs.fs.Open(path)
 	if err != nil {
 		return nil, err
@@ -22,7 +29,7 @@ func (nfs protect) Open(path string) (http.File, error) {
 
 	s, err := f.Stat()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error while opening static file")
+		slog.Error("Error while opening static file", "path", path, "err", err)
 	}
 
 	if s.IsDir() {
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/store"
+	"github.com/go-chi/chi"
+)
+
+type tokenRequest struct {
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Channel int64    `json:"channel"`
+	Expires int64    `json:"expires"`
+}
+
+// tokenResponse has the token itself, which is shown only once
+type tokenResponse struct {
+	*store.Token
+	Value string `json:"token"`
+}
+
+// apiToken of request, nil if it's made with password
+func apiToken(r *http.Request) *store.Token {
+	t, _ := r.Context().Value(APIToken).(*store.Token)
+	return t
+}
+
+// bearerToken from Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < len("Bearer ") || !strings.EqualFold(h[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[len("Bearer "):]), true
+}
+
+// hasScope granted to token among scopes
+func hasScope(t *store.Token, scopes []auth.Scope) bool {
+	for _, s := range scopes {
+		for _, granted := range t.Scopes {
+			if granted == string(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokenChannelOnly leaves the only channel of token restricted to it
+func tokenChannelOnly(t *store.Token, cs []store.Channel) []store.Channel {
+	if t == nil || t.Channel == 0 {
+		return cs
+	}
+
+	for _, c := range cs {
+		if c.ID == t.Channel {
+			return []store.Channel{c}
+		}
+	}
+	return []store.Channel{}
+}
+
+func (cfg *Cfg) listTokens(w http.ResponseWriter, r *http.Request) error {
+	ts, err := cfg.Store.TokensOf(account(r).ID)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(ts); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createToken of account. Token restricted to channel needs access to it
+func (cfg *Cfg) createToken(w http.ResponseWriter, r *http.Request) error {
+	u := account(r)
+	if u.ID == 0 {
+		return errBadRequest("no_account", "Tokens need an account")
+	}
+
+	var req tokenRequest
+
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+
+	var fields []fieldError
+	if req.Name == "" {
+		fields = append(fields, fieldError{Field: "name", Message: "is required"})
+	}
+	if len(req.Scopes) == 0 {
+		fields = append(fields, fieldError{Field: "scopes", Message: "is required"})
+	}
+	for _, s := range req.Scopes {
+		if !auth.Scope(s).Valid() {
+			fields = append(fields, fieldError{Field: "scopes", Message: "unknown scope " + s})
+		}
+	}
+	if req.Expires != 0 && req.Expires <= time.Now().Unix() {
+		fields = append(fields, fieldError{Field: "expires", Message: "must be in the future"})
+	}
+	if len(fields) > 0 {
+		return errInvalid("Invalid token", fields...)
+	}
+
+	if req.Channel != 0 {
+		role, err := cfg.roleIn(u, req.Channel)
+		if err != nil {
+			return err
+		}
+		if role == "" {
+			return errForbidden("Not a member of the channel")
+		}
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+
+	t := &store.Token{
+		User:    u.ID,
+		Name:    req.Name,
+		Hash:    auth.HashToken(token),
+		Scopes:  req.Scopes,
+		Channel: req.Channel,
+		Expires: req.Expires,
+	}
+	if err := cfg.Store.AddToken(t); err != nil {
+		return err
+	}
+
+	cfg.record(r, "token.create", tokenTarget(t.ID), t.Channel, nil, t)
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(tokenResponse{Token: t, Value: token}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deleteToken of account, which revokes it
+func (cfg *Cfg) deleteToken(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.ParseInt(chi.URLParam(r, "token"), 10, 64)
+	if err != nil {
+		return errNotFound("No such token")
+	}
+
+	ts, err := cfg.Store.TokensOf(account(r).ID)
+	if err != nil {
+		return err
+	}
+
+	var t *store.Token
+	for i := range ts {
+		if ts[i].ID == id {
+			t = &ts[i]
+		}
+	}
+	if t == nil {
+		return errNotFound("No such token")
+	}
+
+	ok, err := cfg.Store.DeleteToken(account(r).ID, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNotFound("No such token")
+	}
+
+	cfg.record(r, "token.delete", tokenTarget(id), t.Channel, t, nil)
+	return nil
+}
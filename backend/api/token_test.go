@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	root := fs.NewRoot(testDir)
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    root,
+		Host:  "http://localhost",
+		Users: []config.User{{Name: "ci", Password: "pass", Role: "editor"}},
+	})
+
+	do := func(token, method, path string, body interface{}) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		r := httptest.NewRequest(method, path, &b)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			r.SetBasicAuth("ci", "pass")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	create := func(req tokenRequest) tokenResponse {
+		w := do("", "POST", "/api/tokens", req)
+		assert.Equal(http.StatusOK, w.Code)
+		var resp tokenResponse
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		assert.Nil(err)
+		return resp
+	}
+
+	for i := 0; i < 2; i++ {
+		w := do("", "POST", "/api/channel", nil)
+		assert.Equal(http.StatusOK, w.Code)
+		var c store.Channel
+		json.NewDecoder(w.Body).Decode(&c)
+		err = s.UpdateChannel(&store.Channel{ID: c.ID, Alias: fmt.Sprint(c.ID)})
+		assert.Nil(err)
+	}
+
+	p, err := s.AddPodcastToChannel(1, "episode.mp3", "Episode", 10)
+	assert.Nil(err)
+	err = ioutil.WriteFile(filepath.Join(root.Root, "1", "episode.mp3"), []byte("audio"), 0644)
+	assert.Nil(err)
+
+	invalid := []tokenRequest{
+		{Scopes: []string{"episode:write"}},
+		{Name: "no scopes"},
+		{Name: "bad scope", Scopes: []string{"users"}},
+		{Name: "expired", Scopes: []string{"channel:read"}, Expires: time.Now().Unix() - 1},
+	}
+	for _, req := range invalid {
+		assert.Equal(http.StatusUnprocessableEntity, do("", "POST", "/api/tokens", req).Code, req.Name)
+	}
+	assert.Equal(http.StatusForbidden, do("", "POST", "/api/tokens", tokenRequest{Name: "other", Scopes: []string{"channel:read"}, Channel: 3}).Code)
+
+	upload := create(tokenRequest{Name: "upload", Scopes: []string{"episode:write", "channel:read"}, Channel: 1})
+	assert.Regexp(`^fct_`, upload.Value)
+	assert.Equal(int64(1), upload.Channel)
+
+	read := create(tokenRequest{Name: "read", Scopes: []string{"channel:read"}, Expires: time.Now().Add(time.Hour).Unix()})
+
+	episode := fmt.Sprintf("/api/channel/1/podcast/%d", p.ID)
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{"unknown", "fct_unknown", "GET", "/api/list", http.StatusUnauthorized},
+		{"list", read.Value, "GET", "/api/list", http.StatusOK},
+		{"channel", read.Value, "GET", "/api/channel/2", http.StatusOK},
+		{"no scope", read.Value, "DELETE", "/api/channel/2", http.StatusForbidden},
+		{"no scope episode", read.Value, "GET", episode, http.StatusForbidden},
+		{"people only", read.Value, "GET", "/api/me", http.StatusForbidden},
+		{"no tokens by token", read.Value, "POST", "/api/tokens", http.StatusForbidden},
+		{"restricted", upload.Value, "GET", "/api/channel/2", http.StatusForbidden},
+		{"restricted create", upload.Value, "POST", "/api/channel", http.StatusForbidden},
+		{"scope", upload.Value, "DELETE", episode, http.StatusOK},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.status, do(tt.token, tt.method, tt.path, nil).Code, tt.name)
+	}
+
+	w := do(upload.Value, "GET", "/api/list", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	var cs []store.Channel
+	err = json.NewDecoder(w.Body).Decode(&cs)
+	assert.Nil(err)
+	assert.Len(cs, 1)
+	assert.Equal(int64(1), cs[0].ID)
+
+	w = do("", "GET", "/api/tokens", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NotContains(w.Body.String(), upload.Value)
+	var ts []store.Token
+	err = json.NewDecoder(w.Body).Decode(&ts)
+	assert.Nil(err)
+	assert.Len(ts, 2)
+	for _, tok := range ts {
+		assert.NotZero(tok.LastUsed, tok.Name)
+	}
+
+	// expired and revoked tokens are refused
+	ci, err := s.UserByName("ci")
+	assert.Nil(err)
+	err = s.AddToken(&store.Token{User: ci.ID, Name: "old", Hash: auth.HashToken("fct_old"), Scopes: []string{"channel:read"}, Expires: time.Now().Unix() - 1})
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, do("fct_old", "GET", "/api/list", nil).Code)
+
+	path := fmt.Sprintf("/api/tokens/%d", upload.ID)
+	assert.Equal(http.StatusOK, do("", "DELETE", path, nil).Code)
+	assert.Equal(http.StatusNotFound, do("", "DELETE", path, nil).Code)
+	assert.Equal(http.StatusUnauthorized, do(upload.Value, "GET", "/api/list", nil).Code)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/azzzak/fakecast/store"
+	"github.com/go-chi/chi"
+)
+
+func trashTarget(t *store.TrashItem) string {
+	return t.Kind + ":" + strconv.FormatInt(t.Item, 10)
+}
+
+// trashItem of request
+func (cfg *Cfg) trashItem(r *http.Request) (*store.TrashItem, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "item"), 10, 64)
+	if err != nil {
+		return nil, errNotFound("No such item in trash")
+	}
+
+	t, err := cfg.Store.TrashInfo(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound("No such item in trash")
+	}
+	return t, err
+}
+
+// purge item of trash with its files. Podcasts of purged channel go along
+func (cfg *Cfg) purge(id int64) ([]store.TrashItem, error) {
+	ts, err := cfg.Store.PurgeTrash(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range ts {
+		if err := cfg.FS.Purge(t.Path()); err != nil {
+			return ts, err
+		}
+	}
+	return ts, nil
+}
+
+func (cfg *Cfg) listTrash(w http.ResponseWriter, r *http.Request) error {
+	ts, err := cfg.Store.ListTrash()
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(ts); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cfg *Cfg) restoreTrash(w http.ResponseWriter, r *http.Request) error {
+	t, err := cfg.trashItem(r)
+	if err != nil {
+		return err
+	}
+
+	alias := t.Name
+	switch t.Kind {
+	case store.KindChannel:
+		_, err = cfg.Store.SwapAliasForCID(alias)
+		if err == nil {
+			return errConflict("alias_taken", "Alias is taken")
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	case store.KindPodcast:
+		alias, err = cfg.Store.SwapCIDForAlias(t.Channel)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errConflict("channel_deleted", "Channel is deleted")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// files are moved within transaction and put back if it fails, so item
+	// is never live while its files are in trash, or the other way round
+	var files []string
+	err = cfg.Store.WithTx(func(tx *store.Store) error {
+		var err error
+		// some files may be moved even if it fails
+		if files, err = cfg.FS.Restore(t.Path(), alias); err != nil {
+			return err
+		}
+		return tx.RestoreTrash(t.ID)
+	})
+	if err != nil {
+		if len(files) > 0 {
+			if err := cfg.FS.TrashFiles(t.Path(), alias, files...); err != nil {
+				logger(r).Error("restored files are not moved back", "err", err)
+			}
+		}
+		if errors.Is(err, os.ErrExist) {
+			return errConflict("file_exists", "File exists")
+		}
+		return err
+	}
+
+	cfg.record(r, t.Kind+".restore", trashTarget(t), t.Channel, nil, nil)
+
+	return nil
+}
+
+func (cfg *Cfg) purgeTrash(w http.ResponseWriter, r *http.Request) error {
+	t, err := cfg.trashItem(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err = cfg.purge(t.ID); err != nil {
+		return err
+	}
+
+	cfg.record(r, t.Kind+".purge", trashTarget(t), t.Channel, nil, nil)
+
+	return nil
+}
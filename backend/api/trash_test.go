@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cfg := &Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "http://localhost",
+		Users: []config.User{
+			{Name: "admin", Password: "pass", Role: "owner"},
+			{Name: "ann", Password: "pass", Role: "editor"},
+		},
+	}
+	h := InitHandlers(cfg)
+
+	do := func(user, method, path string, body interface{}) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		r := httptest.NewRequest(method, path, &b)
+		r.SetBasicAuth(user, "pass")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	trash := func() []store.TrashItem {
+		w := do("admin", "GET", "/api/trash", nil)
+		assert.Equal(http.StatusOK, w.Code)
+		var ts []store.TrashItem
+		err := json.NewDecoder(w.Body).Decode(&ts)
+		assert.Nil(err)
+		return ts
+	}
+
+	var c store.Channel
+	w := do("ann", "POST", "/api/channel", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&c)
+	path := fmt.Sprintf("/api/channel/%d", c.ID)
+	assert.Equal(http.StatusOK, do("ann", "PUT", path, updateChannel{Channel: &store.Channel{Title: "News", Alias: "news"}}).Code)
+
+	p, err := s.AddPodcastToChannel(c.ID, "episode.mp3", "Episode", 5)
+	assert.Nil(err)
+	episode := filepath.Join(cfg.FS.Root, "news", "episode.mp3")
+	err = ioutil.WriteFile(episode, []byte("audio"), 0644)
+	assert.Nil(err)
+
+	// episode is kept in trash, not served any more
+	assert.Equal(http.StatusOK, do("ann", "DELETE", fmt.Sprintf("%s/podcast/%d", path, p.ID), nil).Code)
+	assert.False(cfg.FS.IsPodcastExist("news", "episode.mp3"))
+
+	ts := trash()
+	assert.Len(ts, 1)
+	assert.Equal(store.KindPodcast, ts[0].Kind)
+	assert.Equal("ann", ts[0].Actor)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/files/%s/podcast-%d/episode.mp3", fs.TrashDirName, p.ID), nil))
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	assert.Equal(http.StatusForbidden, do("ann", "GET", "/api/trash", nil).Code)
+	assert.Equal(http.StatusNotFound, do("admin", "POST", "/api/trash/100/restore", nil).Code)
+
+	assert.Equal(http.StatusOK, do("admin", "POST", fmt.Sprintf("/api/trash/%d/restore", ts[0].ID), nil).Code)
+	assert.True(cfg.FS.IsPodcastExist("news", "episode.mp3"))
+	assert.Equal(http.StatusOK, do("ann", "GET", fmt.Sprintf("%s/podcast/%d", path, p.ID), nil).Code)
+	assert.Empty(trash())
+
+	// alias of deleted channel is free, so restore waits for it
+	assert.Equal(http.StatusOK, do("admin", "DELETE", path, nil).Code)
+	assert.False(cfg.FS.IsDirExist("news"))
+
+	var other store.Channel
+	w = do("admin", "POST", "/api/channel", nil)
+	json.NewDecoder(w.Body).Decode(&other)
+	otherPath := fmt.Sprintf("/api/channel/%d", other.ID)
+	assert.Equal(http.StatusOK, do("admin", "PUT", otherPath, updateChannel{Channel: &store.Channel{Alias: "news"}}).Code)
+
+	ts = trash()
+	assert.Len(ts, 1)
+	assert.Equal(store.KindChannel, ts[0].Kind)
+	restore := fmt.Sprintf("/api/trash/%d/restore", ts[0].ID)
+	assert.Equal(http.StatusConflict, do("admin", "POST", restore, nil).Code)
+
+	assert.Equal(http.StatusOK, do("admin", "PUT", otherPath, updateChannel{Channel: &store.Channel{Alias: "other"}}).Code)
+	assert.Equal(http.StatusOK, do("admin", "POST", restore, nil).Code)
+	assert.True(cfg.FS.IsPodcastExist("news", "episode.mp3"))
+	assert.Equal(http.StatusOK, do("ann", "GET", path, nil).Code)
+
+	// channel stays live when its dir can't be moved
+	blocker := filepath.Join(cfg.FS.Root, fs.TrashDirName, fmt.Sprintf("channel-%d", c.ID), "file")
+	err = os.MkdirAll(blocker, os.ModePerm)
+	assert.Nil(err)
+	assert.Equal(http.StatusInternalServerError, do("admin", "DELETE", path, nil).Code)
+	assert.Equal(http.StatusOK, do("ann", "GET", path, nil).Code)
+	assert.True(cfg.FS.IsPodcastExist("news", "episode.mp3"))
+	assert.Empty(trash())
+	err = os.RemoveAll(filepath.Dir(blocker))
+	assert.Nil(err)
+
+	// purged by hand
+	assert.Equal(http.StatusOK, do("admin", "DELETE", otherPath, nil).Code)
+	ts = trash()
+	assert.Len(ts, 1)
+	assert.Equal(http.StatusOK, do("admin", "DELETE", fmt.Sprintf("/api/trash/%d", ts[0].ID), nil).Code)
+	assert.Empty(trash())
+	assert.False(cfg.FS.IsDirExist(filepath.Join(fs.TrashDirName, "channel-"+fmt.Sprint(other.ID))))
+
+	// and after retention
+	assert.Equal(http.StatusOK, do("ann", "DELETE", path, nil).Code)
+	cfg.Trash.Retention = time.Hour
+	cfg.housekeep()
+	assert.Len(trash(), 1)
+
+	cfg.Trash.Retention = time.Millisecond
+	time.Sleep(1100 * time.Millisecond)
+	cfg.housekeep()
+	assert.Empty(trash())
+	assert.False(cfg.FS.IsDirExist(fs.TrashDirName + "/channel-" + fmt.Sprint(c.ID)))
+
+	// dot aliases are taken by trash
+	w = do("admin", "POST", "/api/channel", nil)
+	json.NewDecoder(w.Body).Decode(&other)
+	w = do("admin", "PUT", fmt.Sprintf("/api/channel/%d", other.ID), updateChannel{Channel: &store.Channel{Alias: fs.TrashDirName}})
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"error":true`)
+
+	// files go back to trash when item can't be restored
+	alias := fmt.Sprint(other.ID)
+	p, err = s.AddPodcastToChannel(other.ID, "episode.mp3", "Episode", 5)
+	assert.Nil(err)
+	err = ioutil.WriteFile(filepath.Join(cfg.FS.Root, alias, "episode.mp3"), []byte("audio"), 0644)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, do("admin", "DELETE", fmt.Sprintf("/api/channel/%d/podcast/%d", other.ID, p.ID), nil).Code)
+
+	ts = trash()
+	assert.Len(ts, 1)
+	err = s.DropPodcasts()
+	assert.Nil(err)
+	assert.Equal(http.StatusInternalServerError, do("admin", "POST", fmt.Sprintf("/api/trash/%d/restore", ts[0].ID), nil).Code)
+	assert.False(cfg.FS.IsPodcastExist(alias, "episode.mp3"))
+	_, err = os.Stat(filepath.Join(cfg.FS.Root, fs.TrashDirName, ts[0].Path(), "episode.mp3"))
+	assert.Nil(err)
+	assert.Len(trash(), 1)
+}
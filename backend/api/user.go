@@ -0,0 +1,310 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/store"
+	"github.com/go-chi/chi"
+)
+
+type userRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// auditUser is user as it's recorded in audit. Password itself is never
+// there, only the fact it's changed
+type auditUser struct {
+	store.User
+	Password string `json:"password,omitempty"`
+}
+
+var (
+	errUnknownUser = errors.New("unknown user")
+	errPassword    = errors.New("wrong password")
+)
+
+// checkPassword of user by name. Unknown user takes as long to check as
+// known one
+func (cfg *Cfg) checkPassword(name, password string) (*store.User, error) {
+	u, err := cfg.Store.UserByName(name)
+	if err != nil {
+		auth.CheckPassword("", password)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errUnknownUser
+		}
+		return nil, err
+	}
+
+	if !auth.CheckPassword(u.PasswordHash, password) {
+		return nil, errPassword
+	}
+	return u, nil
+}
+
+// account of request user
+func account(r *http.Request) *store.User {
+	return r.Context().Value(Account).(*store.User)
+}
+
+// syncUsers from credential and config file, so they are able to log in.
+// Role and password of existing accounts follow the config
+func (cfg *Cfg) syncUsers() error {
+	users := cfg.Users
+	if cfg.Credential != "" {
+		for name, pass := range credential(cfg.Credential) {
+			users = append(users, config.User{Name: name, Password: pass, Role: string(auth.Owner)})
+		}
+	}
+
+	for _, cu := range users {
+		u, err := cfg.Store.UserByName(cu.Name)
+		if errors.Is(err, sql.ErrNoRows) {
+			hash, err := auth.HashPassword(cu.Password)
+			if err != nil {
+				return err
+			}
+			if err := cfg.Store.AddUser(&store.User{Name: cu.Name, Role: cu.Role, PasswordHash: hash}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if u.Role == cu.Role && auth.CheckPassword(u.PasswordHash, cu.Password) {
+			continue
+		}
+
+		u.Role = cu.Role
+		if u.PasswordHash, err = auth.HashPassword(cu.Password); err != nil {
+			return err
+		}
+		if err := cfg.Store.UpdateUser(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lastOwner is the only owner left, so admin area can't lose its owner
+func (cfg *Cfg) lastOwner(u *store.User) (bool, error) {
+	if u.Role != string(auth.Owner) {
+		return false, nil
+	}
+	n, err := cfg.Store.CountUsers(string(auth.Owner))
+	return n == 1, err
+}
+
+// roleError of request with unknown role
+var roleError = fieldError{Field: "role", Message: "must be viewer, uploader, editor or owner"}
+
+// userOf request by id in URL
+func (cfg *Cfg) userOf(r *http.Request) (*store.User, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "user"), 10, 64)
+	if err != nil {
+		return nil, errNotFound("No such user")
+	}
+
+	u, err := cfg.Store.UserInfo(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound("No such user")
+	}
+	return u, err
+}
+
+func (cfg *Cfg) listUsers(w http.ResponseWriter, r *http.Request) error {
+	us, err := cfg.Store.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(us); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cfg *Cfg) createUser(w http.ResponseWriter, r *http.Request) error {
+	var req userRequest
+
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+
+	var fields []fieldError
+	if req.Name == "" {
+		fields = append(fields, fieldError{Field: "name", Message: "is required"})
+	}
+	if req.Password == "" {
+		fields = append(fields, fieldError{Field: "password", Message: "is required"})
+	}
+	if !auth.Role(req.Role).Valid() {
+		fields = append(fields, roleError)
+	}
+	if len(fields) > 0 {
+		return errInvalid("Invalid user", fields...)
+	}
+
+	if _, err := cfg.Store.UserByName(req.Name); err == nil {
+		return errConflict("user_exists", "User exists")
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+
+	u := &store.User{Name: req.Name, Role: req.Role, PasswordHash: hash}
+	if err := cfg.Store.AddUser(u); err != nil {
+		return err
+	}
+
+	cfg.record(r, "user.create", userTarget(u.ID), 0, nil, u)
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(u); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// updateUser changes fields set in request
+func (cfg *Cfg) updateUser(w http.ResponseWriter, r *http.Request) error {
+	u, err := cfg.userOf(r)
+	if err != nil {
+		return err
+	}
+
+	var req userRequest
+
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+
+	before := *u
+
+	if req.Role != "" && !auth.Role(req.Role).Valid() {
+		return errInvalid("Invalid user", roleError)
+	}
+
+	if req.Name != "" && req.Name != u.Name {
+		if _, err := cfg.Store.UserByName(req.Name); err == nil {
+			return errConflict("user_exists", "User exists")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		u.Name = req.Name
+	}
+
+	if req.Role != "" && req.Role != u.Role {
+		last, err := cfg.lastOwner(u)
+		if err != nil {
+			return err
+		}
+		if last {
+			return errConflict("last_owner", "Last owner can't be changed")
+		}
+		u.Role = req.Role
+	}
+
+	if req.Password != "" {
+		if u.PasswordHash, err = auth.HashPassword(req.Password); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.Store.UpdateUser(u); err != nil {
+		return err
+	}
+
+	after := auditUser{User: *u}
+	if req.Password != "" {
+		after.Password = "changed"
+	}
+	cfg.record(r, "user.update", userTarget(u.ID), 0, auditUser{User: before}, after)
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(u); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cfg *Cfg) deleteUser(w http.ResponseWriter, r *http.Request) error {
+	u, err := cfg.userOf(r)
+	if err != nil {
+		return err
+	}
+
+	last, err := cfg.lastOwner(u)
+	if err != nil {
+		return err
+	}
+	if last {
+		return errConflict("last_owner", "Last owner can't be deleted")
+	}
+
+	if err := cfg.Store.DeleteUser(u.ID); err != nil {
+		return err
+	}
+
+	cfg.record(r, "user.delete", userTarget(u.ID), 0, u, nil)
+	return nil
+}
+
+// me is account of request user. Without accounts it's anonymous owner
+func (cfg *Cfg) me(w http.ResponseWriter, r *http.Request) error {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(account(r)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// updateMe changes password of request user
+func (cfg *Cfg) updateMe(w http.ResponseWriter, r *http.Request) error {
+	u := account(r)
+
+	var req userRequest
+
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+
+	if u.ID == 0 {
+		return errBadRequest("no_account", "There is no account to change")
+	}
+	if req.Password == "" {
+		return errInvalid("Invalid user", fieldError{Field: "password", Message: "is required"})
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordHash = hash
+	if err := cfg.Store.UpdateUser(u); err != nil {
+		return err
+	}
+
+	cfg.record(r, "user.update", userTarget(u.ID), 0, auditUser{User: *u}, auditUser{User: *u, Password: "changed"})
+	return nil
+}
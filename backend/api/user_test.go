@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/auth"
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	h := InitHandlers(&Cfg{
+		Store:      s,
+		FS:         fs.NewRoot(testDir),
+		Host:       "http://localhost",
+		Credential: "admin:secret",
+		Users:      []config.User{{Name: "vi", Password: "pass", Role: "viewer"}},
+	})
+
+	do := func(user, pass, method, path string, body interface{}) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		r := httptest.NewRequest(method, path, &b)
+		if user != "" {
+			r.SetBasicAuth(user, pass)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(http.StatusUnauthorized, do("", "", "GET", "/api/list", nil).Code)
+	assert.Equal(http.StatusUnauthorized, do("admin", "wrong", "GET", "/api/list", nil).Code)
+	assert.Equal(http.StatusUnauthorized, do("nobody", "secret", "GET", "/api/list", nil).Code)
+
+	admin, err := s.UserByName("admin")
+	assert.Nil(err)
+	assert.Equal("owner", admin.Role)
+
+	w := do("admin", "secret", "POST", "/api/users", userRequest{Name: "ed", Password: "pass", Role: "editor"})
+	assert.Equal(http.StatusOK, w.Code)
+	var ed store.User
+	err = json.NewDecoder(w.Body).Decode(&ed)
+	assert.Nil(err)
+	assert.Equal("editor", ed.Role)
+	assert.NotContains(w.Body.String(), "pass")
+
+	assert.Equal(http.StatusConflict, do("admin", "secret", "POST", "/api/users", userRequest{Name: "ed", Password: "x", Role: "viewer"}).Code)
+	assert.Equal(http.StatusUnprocessableEntity, do("admin", "secret", "POST", "/api/users", userRequest{Name: "x", Password: "x", Role: "admin"}).Code)
+	assert.Equal(http.StatusUnprocessableEntity, do("admin", "secret", "POST", "/api/users", userRequest{Name: "x", Role: "viewer"}).Code)
+
+	w = do("admin", "secret", "GET", "/api/users", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	var us []store.User
+	err = json.NewDecoder(w.Body).Decode(&us)
+	assert.Nil(err)
+	assert.Len(us, 3)
+
+	roles := []struct {
+		user   string
+		method string
+		path   string
+		status int
+	}{
+		{"vi", "GET", "/api/list", http.StatusOK},
+		{"vi", "POST", "/api/channel", http.StatusForbidden},
+		{"vi", "GET", "/api/users", http.StatusForbidden},
+		{"ed", "POST", "/api/channel", http.StatusOK},
+		{"ed", "GET", "/api/channel/1", http.StatusOK},
+		{"ed", "GET", "/api/users", http.StatusForbidden},
+		{"vi", "GET", "/api/channel/1/stats", http.StatusForbidden},
+		{"vi", "DELETE", "/api/channel/1", http.StatusForbidden},
+		{"vi", "POST", "/api/channel/1/upload", http.StatusForbidden},
+	}
+	for _, tt := range roles {
+		assert.Equal(tt.status, do(tt.user, "pass", tt.method, tt.path, nil).Code, tt.user+" "+tt.method+" "+tt.path)
+	}
+
+	// the only owner stays
+	path := fmt.Sprintf("/api/users/%d", admin.ID)
+	assert.Equal(http.StatusConflict, do("admin", "secret", "PUT", path, userRequest{Role: "editor"}).Code)
+	assert.Equal(http.StatusConflict, do("admin", "secret", "DELETE", path, nil).Code)
+	assert.Equal(http.StatusNotFound, do("admin", "secret", "DELETE", "/api/users/100", nil).Code)
+
+	w = do("admin", "secret", "PUT", fmt.Sprintf("/api/users/%d", ed.ID), userRequest{Role: "owner"})
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(http.StatusOK, do("ed", "pass", "GET", "/api/users", nil).Code)
+
+	w = do("vi", "pass", "GET", "/api/me", nil)
+	assert.Equal(http.StatusOK, w.Code)
+	var me store.User
+	err = json.NewDecoder(w.Body).Decode(&me)
+	assert.Nil(err)
+	assert.Equal("vi", me.Name)
+	assert.Equal("viewer", me.Role)
+
+	assert.Equal(http.StatusOK, do("vi", "pass", "PUT", "/api/me", userRequest{Password: "new"}).Code)
+	assert.Equal(http.StatusUnauthorized, do("vi", "pass", "GET", "/api/me", nil).Code)
+	assert.Equal(http.StatusOK, do("vi", "new", "GET", "/api/me", nil).Code)
+
+	assert.Equal(http.StatusOK, do("ed", "pass", "DELETE", fmt.Sprintf("/api/users/%d", admin.ID), nil).Code)
+	assert.Equal(http.StatusUnauthorized, do("admin", "secret", "GET", "/api/list", nil).Code)
+}
+
+func TestOpenAccess(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	h := InitHandlers(&Cfg{
+		Store: s,
+		FS:    fs.NewRoot(testDir),
+		Host:  "http://localhost",
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/me", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"role":"owner"`)
+
+	// the first account closes admin area
+	body, _ := json.Marshal(userRequest{Name: "alice", Password: "secret", Role: "owner"})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/api/users", bytes.NewReader(body)))
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/list", nil))
+	assert.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func TestSyncUsers(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	s, err := store.NewStore(testDir)
+	assert.Nil(err)
+	defer func() {
+		s.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cfg := &Cfg{
+		Store:      s,
+		Credential: "secret",
+		Users:      []config.User{{Name: "alice", Password: "one", Role: "editor"}},
+	}
+
+	err = cfg.syncUsers()
+	assert.Nil(err)
+
+	u, err := s.UserByName("fakecast")
+	assert.Nil(err)
+	assert.Equal("owner", u.Role)
+	assert.True(auth.CheckPassword(u.PasswordHash, "secret"))
+
+	// config wins over changes made since
+	cfg.Users[0] = config.User{Name: "alice", Password: "two", Role: "viewer"}
+	err = cfg.syncUsers()
+	assert.Nil(err)
+
+	u, err = s.UserByName("alice")
+	assert.Nil(err)
+	assert.Equal("viewer", u.Role)
+	assert.True(auth.CheckPassword(u.PasswordHash, "two"))
+
+	n, err := s.CountUsers("")
+	assert.Nil(err)
+	assert.Equal(int64(2), n)
+}
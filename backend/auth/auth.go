@@ -0,0 +1,126 @@
+// Package auth holds roles of admin area users, their passwords and tokens
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role of user. Every role is allowed to do what the roles below it can
+type Role string
+
+// Roles from the least privileged
+const (
+	// Viewer sees channels, episodes and their stats
+	Viewer Role = "viewer"
+	// Uploader adds episodes and images
+	Uploader Role = "uploader"
+	// Editor changes and deletes channels and episodes
+	Editor Role = "editor"
+	// Owner manages users
+	Owner Role = "owner"
+)
+
+var ranks = map[Role]int{
+	Viewer:   1,
+	Uploader: 2,
+	Editor:   3,
+	Owner:    4,
+}
+
+// Valid role
+func (r Role) Valid() bool {
+	_, ok := ranks[r]
+	return ok
+}
+
+// Allows action which requires role
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && ranks[r] >= ranks[required]
+}
+
+// HashPassword for store
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+var (
+	dummyOnce sync.Once
+	dummyHash []byte
+)
+
+// CheckPassword against its hash. Empty hash of unknown user or user
+// without password takes as long as real one, so users can't be guessed
+// by time of response
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		dummyOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Scope of token. Token is never allowed more than its user
+type Scope string
+
+// Scopes of tokens
+const (
+	// ChannelRead sees channels and their stats
+	ChannelRead Scope = "channel:read"
+	// ChannelWrite creates, changes and deletes channels and their covers
+	ChannelWrite Scope = "channel:write"
+	// EpisodeRead sees episodes
+	EpisodeRead Scope = "episode:read"
+	// EpisodeWrite uploads, changes and deletes episodes and their artwork
+	EpisodeWrite Scope = "episode:write"
+)
+
+// Valid scope
+func (s Scope) Valid() bool {
+	switch s {
+	case ChannelRead, ChannelWrite, EpisodeRead, EpisodeWrite:
+		return true
+	}
+	return false
+}
+
+// TokenPrefix tells tokens apart from passwords, e.g. in leaked secrets scans
+const TokenPrefix = "fct_"
+
+// NewSecret of 256 random bits, like session id or CSRF token
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewToken to be shown once, only its hash is kept
+func NewToken() (string, error) {
+	secret, err := NewSecret()
+	if err != nil {
+		return "", err
+	}
+	return TokenPrefix + secret, nil
+}
+
+// HashToken or other secret for store. Secret is random enough for fast
+// hash, so it can be looked up by the hash
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
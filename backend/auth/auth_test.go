@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{Owner, Owner, true},
+		{Owner, Viewer, true},
+		{Editor, Owner, false},
+		{Editor, Uploader, true},
+		{Uploader, Editor, false},
+		{Uploader, Uploader, true},
+		{Viewer, Uploader, false},
+		{Viewer, Viewer, true},
+		{"admin", Viewer, false},
+		{"", Viewer, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" "+string(tt.required), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.role.Allows(tt.required))
+		})
+	}
+}
+
+func TestPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, err := HashPassword("secret")
+	assert.Nil(err)
+	assert.NotEqual("secret", hash)
+
+	assert.True(CheckPassword(hash, "secret"))
+	assert.False(CheckPassword(hash, "Secret"))
+	assert.False(CheckPassword("", "secret"))
+}
+
+func TestToken(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := NewToken()
+	assert.Nil(err)
+	assert.Regexp(`^fct_[A-Za-z0-9_-]{43}$`, a)
+
+	b, err := NewToken()
+	assert.Nil(err)
+	assert.NotEqual(a, b)
+
+	assert.Len(HashToken(a), 64)
+	assert.Equal(HashToken(a), HashToken(a))
+	assert.NotEqual(HashToken(a), HashToken(b))
+}
+
+func TestScope(t *testing.T) {
+	assert.True(t, EpisodeWrite.Valid())
+	assert.True(t, Scope("channel:read").Valid())
+	assert.False(t, Scope("users").Valid())
+	assert.False(t, Scope("").Valid())
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults of Limiter
+const (
+	DefaultFree    = 5
+	DefaultBackoff = time.Second
+	DefaultLockout = 15 * time.Minute
+)
+
+// Limiter of failed login attempts by key, like address or user name. After
+// free attempts every failure blocks the key for twice as long as the
+// previous one, up to lockout. Key is forgotten after lockout passes
+// without failures
+type Limiter struct {
+	free    int
+	backoff time.Duration
+	lockout time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*attempts
+}
+
+type attempts struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// NewLimiter constructor, zero values are replaced with defaults
+func NewLimiter(free int, backoff, lockout time.Duration) *Limiter {
+	if free <= 0 {
+		free = DefaultFree
+	}
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	if lockout <= 0 {
+		lockout = DefaultLockout
+	}
+	return &Limiter{
+		free:    free,
+		backoff: backoff,
+		lockout: lockout,
+		now:     time.Now,
+		entries: map[string]*attempts{},
+	}
+}
+
+// Wait before key is allowed to try again, zero if it's allowed now
+func (l *Limiter) Wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.entries[key]
+	if !ok {
+		return 0
+	}
+
+	if wait := a.until.Sub(l.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Fail of attempt by key
+func (l *Limiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	a, ok := l.entries[key]
+	if !ok {
+		a = &attempts{}
+		l.entries[key] = a
+	}
+
+	a.failures++
+	a.last = now
+
+	if over := a.failures - l.free; over > 0 {
+		block := l.lockout
+		if over <= 30 {
+			if d := l.backoff << uint(over-1); d > 0 && d < l.lockout {
+				block = d
+			}
+		}
+		a.until = now.Add(block)
+	}
+}
+
+// Reset key after successful attempt
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+// prune keys without failures for lockout, so memory doesn't grow with
+// every address ever seen
+func (l *Limiter) prune(now time.Time) {
+	for key, a := range l.entries {
+		if now.Sub(a.last) > l.lockout && !now.Before(a.until) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1000, 0)
+	l := NewLimiter(3, time.Second, 10*time.Second)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		assert.Zero(l.Wait("ip"))
+		l.Fail("ip")
+	}
+	assert.Zero(l.Wait("ip"))
+	assert.Zero(l.Wait("other"))
+
+	// backoff doubles up to lockout
+	for _, want := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		l.Fail("ip")
+		assert.Equal(want*time.Second, l.Wait("ip"))
+	}
+
+	now = now.Add(4 * time.Second)
+	assert.Equal(6*time.Second, l.Wait("ip"))
+
+	now = now.Add(6 * time.Second)
+	assert.Zero(l.Wait("ip"))
+
+	// still counted until lockout passes without failures
+	l.Fail("ip")
+	assert.Equal(10*time.Second, l.Wait("ip"))
+
+	l.Reset("ip")
+	assert.Zero(l.Wait("ip"))
+
+	l.Fail("user")
+	now = now.Add(11 * time.Second)
+	l.Fail("ip")
+	assert.Len(l.entries, 1)
+}
+
+func TestLimiterDefaults(t *testing.T) {
+	l := NewLimiter(0, 0, 0)
+	assert.Equal(t, DefaultFree, l.free)
+	assert.Equal(t, DefaultBackoff, l.backoff)
+	assert.Equal(t, DefaultLockout, l.lockout)
+}
@@ -0,0 +1,123 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves TLS certificate and reloads it when files change on disk,
+// e.g. after certbot renewal
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader constructor
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate to be used in tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload certificate if any of files was modified since the last load.
+// The current certificate is kept if new one can't be loaded
+func (r *Reloader) Reload() (bool, error) {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	same := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch files every interval until stop is closed
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				slog.Error("TLS certificate is not reloaded", "cert", r.certFile, "err", err)
+				continue
+			}
+			if reloaded {
+				slog.Info("TLS certificate is reloaded", "cert", r.certFile)
+			}
+		}
+	}
+}
+
+func (r *Reloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		s, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if s.ModTime().After(last) {
+			last = s.ModTime()
+		}
+	}
+	return last, nil
+}
+
+// LoadPool of CA certificates from PEM file
+func LoadPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,138 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePair(t *testing.T, dir, cn string, modTime time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	files := map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+	}
+	for name, block := range files {
+		if err := ioutil.WriteFile(name, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, r *Reloader) string {
+	c, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+	defer func() {
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	now := time.Now()
+	certFile, keyFile := writePair(t, testDir, "first", now.Add(-time.Minute))
+
+	r, err := NewReloader(certFile, keyFile)
+	assert.Nil(err)
+	assert.Equal("first", commonName(t, r))
+
+	reloaded, err := r.Reload()
+	assert.Nil(err)
+	assert.False(reloaded)
+
+	writePair(t, testDir, "second", now)
+
+	reloaded, err = r.Reload()
+	assert.Nil(err)
+	assert.True(reloaded)
+	assert.Equal("second", commonName(t, r))
+
+	err = ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	assert.Nil(err)
+	err = os.Chtimes(keyFile, now.Add(time.Minute), now.Add(time.Minute))
+	assert.Nil(err)
+
+	reloaded, err = r.Reload()
+	assert.NotNil(err)
+	assert.False(reloaded)
+	assert.Equal("second", commonName(t, r))
+
+	_, err = NewReloader(filepath.Join(testDir, "absent.pem"), keyFile)
+	assert.NotNil(err)
+}
+
+func TestLoadPool(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+	defer func() {
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	certFile, keyFile := writePair(t, testDir, "ca", time.Now())
+
+	pool, err := LoadPool(certFile)
+	assert.Nil(err)
+	assert.NotNil(pool)
+
+	_, err = LoadPool(keyFile)
+	assert.NotNil(err)
+}
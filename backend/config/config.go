@@ -0,0 +1,689 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/azzzak/fakecast/auth"
+	"gopkg.in/yaml.v2"
+)
+
+// LocalStorage backend keeps content on the local disk
+const LocalStorage = "local"
+
+// Config of the app
+type Config struct {
+	Host       string    `yaml:"host"`
+	Listen     string    `yaml:"listen"`
+	Port       int       `yaml:"port"`
+	Credential string    `yaml:"credential"`
+	Server     Server    `yaml:"server"`
+	Log        Log       `yaml:"log"`
+	TLS        TLS       `yaml:"tls"`
+	Auth       Auth      `yaml:"auth"`
+	Storage    Storage   `yaml:"storage"`
+	Feed       Feed      `yaml:"feed"`
+	Metrics    Metrics   `yaml:"metrics"`
+	Analytics  Analytics `yaml:"analytics"`
+	Audit      Audit     `yaml:"audit"`
+	Trash      Trash     `yaml:"trash"`
+}
+
+// Server timeouts. Read and write timeouts limit API and feed requests,
+// streams of files and uploads are limited by StreamTimeout of inactivity
+type Server struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	StreamTimeout     time.Duration `yaml:"stream_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	TrustedProxies    []string      `yaml:"trusted_proxies"`
+	// AllowedOrigins of admin UI served from another host, e.g. in development
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// Log settings
+type Log struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// TLS settings. Certificate files are reloaded on change every
+// ReloadInterval, requests to /api require client certificate signed
+// by ClientCA if it's set
+type TLS struct {
+	Cert           string        `yaml:"cert"`
+	Key            string        `yaml:"key"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	RedirectPort   int           `yaml:"redirect_port"`
+	HSTS           time.Duration `yaml:"hsts"`
+	ClientCA       string        `yaml:"client_ca"`
+}
+
+// Auth settings. Sessions of web UI expire after SessionTTL since login
+type Auth struct {
+	Users      []User        `yaml:"users"`
+	SessionTTL time.Duration `yaml:"session_ttl"`
+	Attempts   Attempts      `yaml:"attempts"`
+	OIDC       OIDC          `yaml:"oidc"`
+}
+
+// Attempts of login from one address or as one user. After Free failures
+// each one blocks next attempts for Backoff doubled every time, up to Lockout
+type Attempts struct {
+	Free    int           `yaml:"free"`
+	Backoff time.Duration `yaml:"backoff"`
+	Lockout time.Duration `yaml:"lockout"`
+}
+
+// OIDC login with identity provider. Role of user is the highest one of
+// groups mapped by Roles, or DefaultRole. Users without role are not let in
+type OIDC struct {
+	Issuer        string            `yaml:"issuer"`
+	ClientID      string            `yaml:"client_id"`
+	ClientSecret  string            `yaml:"client_secret"`
+	Scopes        []string          `yaml:"scopes"`
+	UsernameClaim string            `yaml:"username_claim"`
+	GroupsClaim   string            `yaml:"groups_claim"`
+	Roles         map[string]string `yaml:"roles"`
+	DefaultRole   string            `yaml:"default_role"`
+}
+
+// Enabled login with identity provider
+func (o OIDC) Enabled() bool {
+	return o.Issuer != ""
+}
+
+// User of admin area. Role is owner unless set
+type User struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"`
+	Role     string `yaml:"role"`
+}
+
+// Storage settings
+type Storage struct {
+	Backend string `yaml:"backend"`
+	Root    string `yaml:"root"`
+}
+
+// Metrics settings. Admin credentials protect metrics if Credential is empty
+type Metrics struct {
+	Enabled    bool   `yaml:"enabled"`
+	Credential string `yaml:"credential"`
+}
+
+// Analytics settings. UserAgents is a file with rules in format of the open
+// podcast user-agent list, built-in rules are used if it's empty
+type Analytics struct {
+	UserAgents string `yaml:"user_agents"`
+}
+
+// Audit settings. Records of changes older than Retention are purged,
+// zero keeps them forever
+type Audit struct {
+	Retention time.Duration `yaml:"retention"`
+}
+
+// Trash settings. Deleted channels and episodes are purged after
+// Retention, zero keeps them until they are purged by hand
+type Trash struct {
+	Retention time.Duration `yaml:"retention"`
+}
+
+// Feed settings
+type Feed struct {
+	Defaults FeedDefaults            `yaml:"defaults"`
+	Channels map[string]FeedDefaults `yaml:"channels"`
+}
+
+// FeedDefaults are used in a feed when a channel doesn't set a value itself
+type FeedDefaults struct {
+	Author    string `yaml:"author"`
+	Copyright string `yaml:"copyright"`
+	Language  string `yaml:"language"`
+	Type      string `yaml:"type"`
+	Explicit  *bool  `yaml:"explicit"`
+	// Limit of items in a feed page, 0 means all episodes in one feed
+	Limit int `yaml:"limit"`
+}
+
+// Default config
+func Default() *Config {
+	return &Config{
+		Port: 80,
+		Server: Server{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			StreamTimeout:     30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   3 * time.Second,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		TLS: TLS{
+			ReloadInterval: time.Minute,
+		},
+		Auth: Auth{
+			SessionTTL: 24 * time.Hour,
+			Attempts: Attempts{
+				Free:    5,
+				Backoff: time.Second,
+				Lockout: 15 * time.Minute,
+			},
+			OIDC: OIDC{
+				UsernameClaim: "preferred_username",
+				GroupsClaim:   "groups",
+			},
+		},
+		Storage: Storage{
+			Backend: LocalStorage,
+			Root:    "/fakecast",
+		},
+		Metrics: Metrics{
+			Enabled: true,
+		},
+		Audit: Audit{
+			Retention: 90 * 24 * time.Hour,
+		},
+		Trash: Trash{
+			Retention: 30 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load config from file on top of defaults
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path == "" {
+		return c, nil
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.parse(src); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Validate config file: it is loaded and then checked with env applied
+func Validate(path string, lookup func(string) (string, bool)) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	c := Default()
+	if err := c.parse(src); err != nil {
+		return err
+	}
+
+	if err := c.ApplyEnv(lookup); err != nil {
+		return err
+	}
+
+	errs := c.Check()
+	for i := range errs {
+		errs[i].Line = lineOf(src, errs[i].Field)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) parse(src []byte) error {
+	if err := yaml.UnmarshalStrict(src, c); err != nil {
+		return yamlErrors(err)
+	}
+	return nil
+}
+
+// ApplyEnv overrides config with values of env variables
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	str := map[string]*string{
+		"HOST":       &c.Host,
+		"LISTEN":     &c.Listen,
+		"ROOT":       &c.Storage.Root,
+		"CREDENTIAL": &c.Credential,
+		"TLS_CERT":   &c.TLS.Cert,
+		"TLS_KEY":    &c.TLS.Key,
+		"TLS_CA":     &c.TLS.ClientCA,
+		"LOG_LEVEL":  &c.Log.Level,
+		"LOG_FORMAT": &c.Log.Format,
+
+		"METRICS_CREDENTIAL": &c.Metrics.Credential,
+		"USER_AGENTS":        &c.Analytics.UserAgents,
+		"OIDC_ISSUER":        &c.Auth.OIDC.Issuer,
+		"OIDC_CLIENT_ID":     &c.Auth.OIDC.ClientID,
+		"OIDC_CLIENT_SECRET": &c.Auth.OIDC.ClientSecret,
+	}
+
+	for key, field := range str {
+		if val, ok := lookup(key); ok {
+			*field = val
+		}
+	}
+
+	num := map[string]*int{
+		"PORT":          &c.Port,
+		"REDIRECT_PORT": &c.TLS.RedirectPort,
+	}
+
+	for key, field := range num {
+		if val, ok := lookup(key); ok {
+			v, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("Env[%s]: %v", key, err)
+			}
+			*field = v
+		}
+	}
+
+	return nil
+}
+
+// Addr to listen on
+func (c *Config) Addr() string {
+	return net.JoinHostPort(c.Listen, strconv.Itoa(c.Port))
+}
+
+// Proxies parses trusted proxies. Single address is treated as a network
+// of one host
+func (s Server) Proxies() ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range s.TrustedProxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", p)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// SlogLevel of log
+func (l Log) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(l.Level))
+	return level, err
+}
+
+// Users of auth section with default role
+func (c *Config) Users() []User {
+	var us []User
+	for _, u := range c.Auth.Users {
+		if u.Role == "" {
+			u.Role = string(auth.Owner)
+		}
+		us = append(us, u)
+	}
+	return us
+}
+
+// For returns feed defaults of a channel with its overrides applied
+func (f Feed) For(alias string) FeedDefaults {
+	d := f.Defaults
+
+	o, ok := f.Channels[alias]
+	if !ok {
+		return d
+	}
+
+	if o.Author != "" {
+		d.Author = o.Author
+	}
+	if o.Copyright != "" {
+		d.Copyright = o.Copyright
+	}
+	if o.Language != "" {
+		d.Language = o.Language
+	}
+	if o.Type != "" {
+		d.Type = o.Type
+	}
+	if o.Explicit != nil {
+		d.Explicit = o.Explicit
+	}
+	if o.Limit != 0 {
+		d.Limit = o.Limit
+	}
+
+	return d
+}
+
+//
+// Validation
+//
+
+// FieldError describes invalid setting
+type FieldError struct {
+	Line  int
+	Field string
+	Msg   string
+}
+
+func (e FieldError) Error() string {
+	var b strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, "%s: ", e.Field)
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// Errors of config
+type Errors []FieldError
+
+func (errs Errors) Error() string {
+	s := make([]string, len(errs))
+	for i, e := range errs {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Check config for semantic errors
+func (c *Config) Check() Errors {
+	var errs Errors
+	add := func(field, format string, a ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	if c.Host == "" {
+		add("host", "is required")
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		add("port", "must be between 1 and 65535, got %d", c.Port)
+	}
+
+	timeouts := []struct {
+		field string
+		value time.Duration
+	}{
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.stream_timeout", c.Server.StreamTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"tls.reload_interval", c.TLS.ReloadInterval},
+		{"tls.hsts", c.TLS.HSTS},
+		{"auth.session_ttl", c.Auth.SessionTTL},
+		{"auth.attempts.backoff", c.Auth.Attempts.Backoff},
+		{"auth.attempts.lockout", c.Auth.Attempts.Lockout},
+		{"audit.retention", c.Audit.Retention},
+		{"trash.retention", c.Trash.Retention},
+	}
+	for _, t := range timeouts {
+		if t.value < 0 {
+			add(t.field, "must not be negative")
+		}
+	}
+
+	for i, p := range c.Server.TrustedProxies {
+		s := Server{TrustedProxies: []string{p}}
+		if _, err := s.Proxies(); err != nil {
+			add(fmt.Sprintf("server.trusted_proxies[%d]", i), "%v", err)
+		}
+	}
+
+	for i, o := range c.Server.AllowedOrigins {
+		if u, err := url.Parse(o); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			add(fmt.Sprintf("server.allowed_origins[%d]", i), "must be scheme and host like https://admin.example.com, got %q", o)
+		}
+	}
+
+	if _, err := c.Log.SlogLevel(); err != nil {
+		add("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		add("log.format", "must be text or json, got %q", c.Log.Format)
+	}
+
+	if c.TLS.Cert != "" && c.TLS.Key == "" {
+		add("tls.key", "is required when tls.cert is set")
+	}
+	if c.TLS.Key != "" && c.TLS.Cert == "" {
+		add("tls.cert", "is required when tls.key is set")
+	}
+	if c.TLS.ClientCA != "" && c.TLS.Cert == "" {
+		add("tls.client_ca", "requires tls.cert and tls.key")
+	}
+	if c.TLS.RedirectPort < 0 || c.TLS.RedirectPort > 65535 {
+		add("tls.redirect_port", "must be between 1 and 65535, got %d", c.TLS.RedirectPort)
+	}
+	if c.TLS.RedirectPort != 0 && c.TLS.RedirectPort == c.Port {
+		add("tls.redirect_port", "must differ from port")
+	}
+
+	seen := map[string]bool{}
+	for i, u := range c.Auth.Users {
+		field := fmt.Sprintf("auth.users[%d]", i)
+		switch {
+		case u.Name == "":
+			add(field+".name", "is required")
+		case seen[u.Name]:
+			add(field+".name", "duplicate user %q", u.Name)
+		}
+		if u.Password == "" {
+			add(field+".password", "is required")
+		}
+		if u.Role != "" && !auth.Role(u.Role).Valid() {
+			add(field+".role", "must be owner, editor, uploader or viewer, got %q", u.Role)
+		}
+		seen[u.Name] = true
+	}
+
+	if c.Auth.Attempts.Free < 0 {
+		add("auth.attempts.free", "must not be negative, got %d", c.Auth.Attempts.Free)
+	}
+
+	if o := c.Auth.OIDC; o.Enabled() {
+		if u, err := url.Parse(o.Issuer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("auth.oidc.issuer", "must be URL of provider, got %q", o.Issuer)
+		}
+		if o.ClientID == "" {
+			add("auth.oidc.client_id", "is required")
+		}
+		if o.UsernameClaim == "" {
+			add("auth.oidc.username_claim", "is required")
+		}
+
+		groups := make([]string, 0, len(o.Roles))
+		for g := range o.Roles {
+			groups = append(groups, g)
+		}
+		sort.Strings(groups)
+
+		for _, g := range groups {
+			if !auth.Role(o.Roles[g]).Valid() {
+				add("auth.oidc.roles."+g, "must be owner, editor, uploader or viewer, got %q", o.Roles[g])
+			}
+		}
+		if o.DefaultRole != "" && !auth.Role(o.DefaultRole).Valid() {
+			add("auth.oidc.default_role", "must be owner, editor, uploader or viewer, got %q", o.DefaultRole)
+		}
+	}
+
+	if c.Storage.Backend != LocalStorage {
+		add("storage.backend", "unsupported backend %q", c.Storage.Backend)
+	}
+	if c.Storage.Root == "" {
+		add("storage.root", "is required")
+	}
+
+	checkFeed := func(field string, d FeedDefaults) {
+		switch d.Type {
+		case "", "episodic", "serial":
+		default:
+			add(field+".type", "must be episodic or serial, got %q", d.Type)
+		}
+		if d.Limit < 0 {
+			add(field+".limit", "must not be negative, got %d", d.Limit)
+		}
+	}
+
+	checkFeed("feed.defaults", c.Feed.Defaults)
+
+	aliases := make([]string, 0, len(c.Feed.Channels))
+	for alias := range c.Feed.Channels {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		checkFeed("feed.channels."+alias, c.Feed.Channels[alias])
+	}
+
+	return errs
+}
+
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+func yamlErrors(err error) error {
+	var msgs []string
+	switch e := err.(type) {
+	case *yaml.TypeError:
+		msgs = e.Errors
+	default:
+		msgs = []string{err.Error()}
+	}
+
+	var errs Errors
+	for _, m := range msgs {
+		fe := FieldError{Msg: m}
+		if sm := yamlLine.FindStringSubmatch(m); sm != nil {
+			fe.Line, _ = strconv.Atoi(sm[1])
+			fe.Msg = sm[2]
+		}
+		errs = append(errs, fe)
+	}
+	return errs
+}
+
+// lineOf finds line of a field like "auth.users[1].name" in YAML source.
+// Line of the closest parent is returned if field itself is absent
+func lineOf(src []byte, field string) int {
+	lines := map[string]int{}
+
+	type level struct {
+		indent int
+		key    string
+		items  int
+	}
+	var stack []level
+
+	path := func() string {
+		var b strings.Builder
+		for _, l := range stack {
+			if b.Len() > 0 && !strings.HasPrefix(l.key, "[") {
+				b.WriteByte('.')
+			}
+			b.WriteString(l.key)
+		}
+		return b.String()
+	}
+
+	push := func(indent int, key string, n int) {
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, level{indent: indent, key: key})
+		if p := path(); lines[p] == 0 {
+			lines[p] = n
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for n := 1; scanner.Scan(); n++ {
+		text := scanner.Text()
+		content := strings.TrimLeft(text, " ")
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		indent := len(text) - len(content)
+
+		if strings.HasPrefix(content, "- ") || content == "-" {
+			// item of a sequence is nested deeper than its parent key even
+			// when the dash is written at the same column
+			indent++
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				if strings.HasPrefix(stack[len(stack)-1].key, "[") && stack[len(stack)-1].indent == indent {
+					break
+				}
+				stack = stack[:len(stack)-1]
+			}
+
+			ix := 0
+			if len(stack) > 0 && strings.HasPrefix(stack[len(stack)-1].key, "[") && stack[len(stack)-1].indent == indent {
+				ix = stack[len(stack)-1].items + 1
+				stack = stack[:len(stack)-1]
+			}
+			push(indent, fmt.Sprintf("[%d]", ix), n)
+			stack[len(stack)-1].items = ix
+
+			content = strings.TrimPrefix(strings.TrimPrefix(content, "-"), " ")
+			indent++
+			if content == "" {
+				continue
+			}
+		}
+
+		if i := strings.Index(content, ":"); i > 0 {
+			push(indent, strings.Trim(content[:i], `"'`), n)
+		}
+	}
+
+	for f := field; f != ""; {
+		if n, ok := lines[f]; ok {
+			return n
+		}
+		i := strings.LastIndexAny(f, ".[")
+		if i < 0 {
+			break
+		}
+		f = f[:i]
+	}
+
+	return 0
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+func writeConfig(t *testing.T, src string) (string, func()) {
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().UnixNano())
+	if err := os.MkdirAll(testDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(testDir, "fakecast.yaml")
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, func() {
+		os.RemoveAll(testDir)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	path, cleanup := writeConfig(t, `
+host: https://example.com
+port: 8080
+server:
+  write_timeout: 1m
+auth:
+  users:
+    - name: alice
+      password: secret
+feed:
+  defaults:
+    author: Team
+    language: en
+    limit: 100
+  channels:
+    news:
+      author: Newsroom
+      explicit: true
+      limit: 20
+`)
+	defer cleanup()
+
+	c, err := Load(path)
+	assert.Nil(err)
+
+	assert.Equal("https://example.com", c.Host)
+	assert.Equal(":8080", c.Addr())
+	assert.Equal(time.Minute, c.Server.WriteTimeout)
+	assert.Equal(10*time.Second, c.Server.ReadTimeout)
+	assert.Equal(24*time.Hour, c.Auth.SessionTTL)
+	assert.Equal(90*24*time.Hour, c.Audit.Retention)
+	assert.Equal(30*24*time.Hour, c.Trash.Retention)
+	assert.Equal(LocalStorage, c.Storage.Backend)
+	assert.Equal([]User{{Name: "alice", Password: "secret", Role: "owner"}}, c.Users())
+
+	d := c.Feed.For("news")
+	assert.Equal("Newsroom", d.Author)
+	assert.Equal("en", d.Language)
+	assert.NotNil(d.Explicit)
+	assert.True(*d.Explicit)
+	assert.Equal(20, d.Limit)
+
+	d = c.Feed.For("other")
+	assert.Equal("Team", d.Author)
+	assert.Nil(d.Explicit)
+	assert.Equal(100, d.Limit)
+}
+
+func TestApplyEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	env := map[string]string{
+		"HOST": "env.example.com",
+		"PORT": "9000",
+		"ROOT": "/data",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	c := Default()
+	c.Host = "file.example.com"
+
+	err := c.ApplyEnv(lookup)
+	assert.Nil(err)
+	assert.Equal("env.example.com", c.Host)
+	assert.Equal(9000, c.Port)
+	assert.Equal("/data", c.Storage.Root)
+
+	env["PORT"] = "port"
+	err = c.ApplyEnv(lookup)
+	assert.NotNil(err)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "ok",
+			src: `
+host: example.com
+storage:
+  root: /tmp
+`,
+			want: nil,
+		}, {
+			name: "semantic",
+			src: `host: example.com
+tls:
+  cert: cert.pem
+auth:
+  users:
+    - name: alice
+      password: one
+    - name: alice
+      password: two
+      role: admin
+storage:
+  backend: s3
+feed:
+  channels:
+    news:
+      type: daily
+      limit: -1
+`,
+			want: []string{
+				"line 2: tls.key: is required when tls.cert is set",
+				"line 8: auth.users[1].name: duplicate user \"alice\"",
+				"line 10: auth.users[1].role: must be owner, editor, uploader or viewer, got \"admin\"",
+				"line 12: storage.backend: unsupported backend \"s3\"",
+				"line 16: feed.channels.news.type: must be episodic or serial, got \"daily\"",
+				"line 17: feed.channels.news.limit: must not be negative, got -1",
+			},
+		}, {
+			name: "origins",
+			src: `host: example.com
+server:
+  allowed_origins:
+    - http://localhost:3000
+    - "*"
+auth:
+  session_ttl: -1h
+`,
+			want: []string{
+				"line 7: auth.session_ttl: must not be negative",
+				"line 5: server.allowed_origins[1]: must be scheme and host like https://admin.example.com, got \"*\"",
+			},
+		}, {
+			name: "oidc",
+			src: `host: example.com
+auth:
+  oidc:
+    issuer: idp.example.com
+    roles:
+      admins: owner
+      staff: admin
+`,
+			want: []string{
+				"line 4: auth.oidc.issuer: must be URL of provider, got \"idp.example.com\"",
+				"line 3: auth.oidc.client_id: is required",
+				"line 7: auth.oidc.roles.staff: must be owner, editor, uploader or viewer, got \"admin\"",
+			},
+		}, {
+			name: "type",
+			src: `host: example.com
+port: eighty
+`,
+			want: []string{
+				"line 2: cannot unmarshal !!str `eighty` into int",
+			},
+		}, {
+			name: "unknown field",
+			src: `host: example.com
+server:
+  timeout: 1s
+`,
+			want: []string{
+				"line 3: field timeout not found in type config.Server",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, cleanup := writeConfig(t, tt.src)
+			defer cleanup()
+
+			err := Validate(path, noEnv)
+			if tt.want == nil {
+				assert.Nil(t, err)
+				return
+			}
+
+			errs, ok := err.(Errors)
+			assert.True(t, ok)
+
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLineOf(t *testing.T) {
+	src := []byte(`# comment
+host: example.com
+auth:
+  users:
+  - name: a
+    password: b
+  -
+    name: c
+feed:
+  channels:
+    "news":
+      author: x
+`)
+
+	tests := []struct {
+		field string
+		want  int
+	}{
+		{"host", 2},
+		{"auth.users[0].password", 6},
+		{"auth.users[1].name", 8},
+		{"auth.users[1].password", 7},
+		{"feed.channels.news.author", 12},
+		{"tls.cert", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			assert.Equal(t, tt.want, lineOf(src, tt.field))
+		})
+	}
+}
+
+func TestProxies(t *testing.T) {
+	assert := assert.New(t)
+
+	s := Server{TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1", "::1"}}
+	nets, err := s.Proxies()
+	assert.Nil(err)
+	assert.Len(nets, 3)
+	assert.Equal("127.0.0.1/32", nets[1].String())
+	assert.Equal("::1/128", nets[2].String())
+
+	s = Server{TrustedProxies: []string{"proxy"}}
+	_, err = s.Proxies()
+	assert.NotNil(err)
+}
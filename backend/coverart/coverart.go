@@ -0,0 +1,206 @@
+// Package coverart checks and resizes cover art the way podcast directories
+// require it: square RGB JPEG or PNG from 1400 to 3000 px
+package coverart
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // decoder of PNG covers
+	"io"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// MinSize of cover side in px
+	MinSize = 1400
+	// MaxSize of cover side in px, larger covers are scaled down
+	MaxSize = 3000
+	// MaxBytes of uploaded image
+	MaxBytes = 32 << 20
+
+	// maxPixels of decoded image, so a small file can't take all memory.
+	// Twice the side of the largest cover leaves room for odd aspects
+	maxPixels = (2 * MaxSize) * (2 * MaxSize)
+	quality   = 90
+)
+
+// Sizes of variants generated next to a cover
+var Sizes = []int{1400, 600, 300}
+
+var (
+	// ErrFormat of image which is neither JPEG nor PNG
+	ErrFormat = errors.New("cover must be JPEG or PNG")
+	// ErrTooSmall image
+	ErrTooSmall = fmt.Errorf("cover must be at least %dx%d px", MinSize, MinSize)
+	// ErrTooLarge image
+	ErrTooLarge = errors.New("cover is too large")
+)
+
+// hashed name of processed cover, possibly with prefix or path before it
+var hashed = regexp.MustCompile(`(^|[/-])[0-9a-f]{16}\.jpg$`)
+
+// file of processed cover or its variant, with episode prefix for artwork
+var file = regexp.MustCompile(`^([0-9]+-)?[0-9a-f]{16}(-[0-9]+)?\.jpg$`)
+
+// File of cover or its variant
+type File struct {
+	Name string
+	Size int
+	Data []byte
+}
+
+// Process uploaded image. Non-square image is cropped to its center, larger
+// one is scaled down, CMYK and transparency are flattened to RGB. The first
+// file is the cover itself, named with prefix and hash of its content, then
+// variants of Sizes follow
+func Process(r io.Reader, prefix string) ([]File, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, ErrFormat
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	if config.Width < MinSize || config.Height < MinSize {
+		return nil, ErrTooSmall
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrFormat
+	}
+
+	cover := square(src)
+	if cover.Bounds().Dx() > MaxSize {
+		cover = resize(cover, MaxSize)
+	}
+
+	master, err := encode(cover)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(master)
+	base := prefix + hex.EncodeToString(sum[:8])
+
+	files := []File{{Name: base + ".jpg", Size: cover.Bounds().Dx(), Data: master}}
+	for _, size := range Sizes {
+		b, err := encode(resize(cover, size))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: Variant(base+".jpg", size), Size: size, Data: b})
+	}
+
+	return files, nil
+}
+
+// Variant of cover name or URL resized to size. Covers uploaded before they
+// were processed have no variants, so their name is returned as is
+func Variant(name string, size int) string {
+	if !hashed.MatchString(name) {
+		return name
+	}
+	return name[:len(name)-len(".jpg")] + "-" + strconv.Itoa(size) + ".jpg"
+}
+
+// Valid file name of processed cover or its variant. Anything else, like
+// path or name of cover uploaded before processing, is not
+func Valid(name string) bool {
+	return file.MatchString(name)
+}
+
+// Variants of cover name
+func Variants(name string) []string {
+	if !hashed.MatchString(name) {
+		return nil
+	}
+
+	var names []string
+	for _, size := range Sizes {
+		names = append(names, Variant(name, size))
+	}
+	return names
+}
+
+func encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// square from center of image drawn over white, which converts any color
+// model to RGB and drops transparency
+func square(src image.Image) *image.RGBA {
+	b := src.Bounds()
+
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	origin := image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2)
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, origin, draw.Over)
+
+	return dst
+}
+
+// resize square image with box filter, which is good enough for downscaling
+func resize(src *image.RGBA, size int) *image.RGBA {
+	n := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	span := func(i int) (int, int) {
+		from, to := i*n/size, (i+1)*n/size
+		if to == from {
+			to = from + 1
+		}
+		return from, to
+	}
+
+	for y := 0; y < size; y++ {
+		y0, y1 := span(y)
+		for x := 0; x < size; x++ {
+			x0, x1 := span(x)
+
+			var r, g, b, count int
+			for sy := y0; sy < y1; sy++ {
+				off := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[off])
+					g += int(src.Pix[off+1])
+					b += int(src.Pix[off+2])
+					off += 4
+					count++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / count)
+			dst.Pix[i+1] = uint8(g / count)
+			dst.Pix[i+2] = uint8(b / count)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,205 @@
+package coverart
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encoded(t *testing.T, img image.Image, format string) []byte {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	assert.Nil(t, err)
+	return buf.Bytes()
+}
+
+func filled(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestProcess(t *testing.T) {
+	red := color.NRGBA{R: 0xff, A: 0xff}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		prefix string
+		size   int
+		err    error
+	}{
+		{"square jpeg", encoded(t, filled(1400, 1400, red), "jpeg"), "", 1400, nil},
+		{"wide png", encoded(t, filled(1600, 1500, red), "png"), "7-", 1500, nil},
+		{"oversized", encoded(t, filled(3200, 3200, red), "jpeg"), "", 3000, nil},
+		{"too small", encoded(t, filled(1400, 1000, red), "png"), "", 0, ErrTooSmall},
+		{"gif", encoded(t, filled(1400, 1400, red), "gif"), "", 0, ErrFormat},
+		{"not image", []byte("text"), "", 0, ErrFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			files, err := Process(bytes.NewReader(tt.data), tt.prefix)
+			assert.Equal(tt.err, err)
+			if err != nil {
+				return
+			}
+
+			assert.Len(files, 1+len(Sizes))
+			assert.Regexp(`^`+tt.prefix+`[0-9a-f]{16}\.jpg$`, files[0].Name)
+			assert.Equal(Variants(files[0].Name), []string{files[1].Name, files[2].Name, files[3].Name})
+
+			want := append([]int{tt.size}, Sizes...)
+			for i, f := range files {
+				img, format, err := image.Decode(bytes.NewReader(f.Data))
+				assert.Nil(err)
+				assert.Equal("jpeg", format)
+				assert.Equal(want[i], f.Size)
+				assert.Equal(image.Rect(0, 0, want[i], want[i]), img.Bounds())
+			}
+		})
+	}
+}
+
+func TestProcessIsStable(t *testing.T) {
+	data := encoded(t, filled(1400, 1400, color.White), "png")
+
+	a, err := Process(bytes.NewReader(data), "")
+	assert.Nil(t, err)
+	b, err := Process(bytes.NewReader(data), "")
+	assert.Nil(t, err)
+
+	assert.Equal(t, a[0].Name, b[0].Name)
+}
+
+// pngHeader of w x h image without pixels, that's all DecodeConfig reads
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], w)
+	binary.BigEndian.PutUint32(ihdr[8:], h)
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 6 // RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)-4))
+	buf.Write(ihdr)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return buf.Bytes()
+}
+
+func TestProcessTooLarge(t *testing.T) {
+	_, err := Process(strings.NewReader(strings.Repeat("x", MaxBytes+1)), "")
+	assert.Equal(t, ErrTooLarge, err)
+
+	// tiny file of huge image is rejected before it's decoded
+	data := pngHeader(7000, 7000)
+	assert.Less(t, len(data), 100)
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, 7000, config.Width)
+
+	_, err = Process(bytes.NewReader(data), "")
+	assert.Equal(t, ErrTooLarge, err)
+}
+
+func TestSquare(t *testing.T) {
+	assert := assert.New(t)
+
+	// transparent stripes left and right are cropped, the rest is flattened on white
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	src.Set(1, 0, color.NRGBA{R: 0xff, A: 0xff})
+	src.Set(2, 1, color.NRGBA{B: 0xff, A: 0})
+
+	dst := square(src)
+	assert.Equal(image.Rect(0, 0, 2, 2), dst.Bounds())
+	assert.Equal(color.RGBA{R: 0xff, A: 0xff}, dst.At(0, 0))
+	assert.Equal(color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, dst.At(1, 1))
+
+	cmyk := image.NewCMYK(image.Rect(0, 0, 1, 1))
+	cmyk.Set(0, 0, color.CMYK{C: 0xff})
+	assert.Equal(color.RGBA{G: 0xff, B: 0xff, A: 0xff}, square(cmyk).At(0, 0))
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if (x+y)%2 == 0 {
+				src.Set(x, y, color.RGBA{R: 200, G: 100, A: 0xff})
+			} else {
+				src.Set(x, y, color.RGBA{B: 100, A: 0xff})
+			}
+		}
+	}
+
+	dst := resize(src, 2)
+	assert.Equal(t, image.Rect(0, 0, 2, 2), dst.Bounds())
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			assert.Equal(t, color.RGBA{R: 100, G: 50, B: 50, A: 0xff}, dst.At(x, y))
+		}
+	}
+}
+
+func TestVariant(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"0123456789abcdef.jpg", "0123456789abcdef-600.jpg"},
+		{"7-0123456789abcdef.jpg", "7-0123456789abcdef-600.jpg"},
+		{"http://host/files/news/cover/0123456789abcdef.jpg", "http://host/files/news/cover/0123456789abcdef-600.jpg"},
+		{"cover.jpg", "cover.jpg"},
+		{"mycover0123456789abcdef.jpg", "mycover0123456789abcdef.jpg"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Variant(tt.name, 600))
+		})
+	}
+
+	assert.Nil(t, Variants("cover.jpg"))
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"0123456789abcdef.jpg", true},
+		{"7-0123456789abcdef.jpg", true},
+		{"7-0123456789abcdef-300.jpg", true},
+		{"cover.jpg", false},
+		{".0123456789abcdef.jpg", false},
+		{"../0123456789abcdef.jpg", false},
+		{"cover/0123456789abcdef.jpg", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Valid(tt.name))
+		})
+	}
+}
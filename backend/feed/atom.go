@@ -0,0 +1,114 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/markdown"
+	"github.com/azzzak/fakecast/store"
+)
+
+// Atom feed (RFC 4287)
+type Atom struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang     string      `xml:"http://www.w3.org/XML/1998/namespace lang,attr,omitempty"`
+	History  string      `xml:"xmlns:fh,attr,omitempty"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Rights   string      `xml:"rights,omitempty"`
+	Author   *AtomPerson `xml:"author,omitempty"`
+	Logo     string      `xml:"logo,omitempty"`
+	Complete *struct{}   `xml:"fh:complete"`
+	Archive  *struct{}   `xml:"fh:archive"`
+	Links    []Link      `xml:"link"`
+
+	Entries []AtomEntry `xml:"entry"`
+}
+
+// AtomPerson entity
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+// AtomEntry entity
+type AtomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Updated   string       `xml:"updated"`
+	Published string       `xml:"published,omitempty"`
+	Summary   string       `xml:"summary,omitempty"`
+	Content   *AtomContent `xml:"content,omitempty"`
+	Links     []Link       `xml:"link"`
+}
+
+// AtomContent entity, type is text or html
+type AtomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// SetHistory of the document like RSS.SetHistory
+func (a *Atom) SetHistory(complete, archive bool) {
+	a.History, a.Complete, a.Archive = history(complete, archive)
+}
+
+// GenerateAtom with content of channel. Links are added to the feed as is
+func GenerateAtom(channel *store.Channel, podcasts []store.Podcast, host string, defaults config.FeedDefaults, links []Link) Atom {
+	updated := time.Now().UTC()
+	if channel.LastModified != 0 {
+		updated = time.Unix(channel.LastModified, 0).UTC()
+	}
+
+	feed := Atom{
+		Lang:     defaults.Language,
+		ID:       host + "/feed/" + channel.Alias,
+		Title:    channel.Title,
+		Subtitle: markdown.Text(channel.Description),
+		Updated:  updated.Format(time.RFC3339),
+		Rights:   defaults.Copyright,
+		Logo:     channel.Cover,
+		Links:    links,
+	}
+
+	author := channel.Author
+	if author == "" {
+		author = defaults.Author
+	}
+	if author != "" {
+		feed.Author = &AtomPerson{Name: author}
+	}
+
+	for _, p := range podcasts {
+		url := enclosureURL(host, channel.Alias, p.Filename)
+		text, html := showNotes(p.Description, url)
+
+		entry := AtomEntry{
+			ID:      itemID(host, channel.Alias, p),
+			Title:   p.Title,
+			Updated: feed.Updated,
+			Summary: text,
+			Links: []Link{{
+				Rel:    "enclosure",
+				Href:   url,
+				Type:   enclosureType(p.Filename),
+				Length: p.Length,
+			}},
+		}
+
+		if html != "" {
+			entry.Content = &AtomContent{Type: "html", Value: html}
+		}
+
+		if t, ok := pubTime(p); ok {
+			entry.Published = t.UTC().Format(time.RFC3339)
+			entry.Updated = entry.Published
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
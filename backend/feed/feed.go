@@ -3,8 +3,11 @@ package feed
 import (
 	"encoding/xml"
 	"strings"
+	"time"
 
+	"github.com/azzzak/fakecast/config"
 	"github.com/azzzak/fakecast/fs"
+	"github.com/azzzak/fakecast/markdown"
 	"github.com/azzzak/fakecast/store"
 )
 
@@ -14,6 +17,8 @@ type RSS struct {
 	Version string   `xml:"version,attr"`
 	Itunes  string   `xml:"xmlns:itunes,attr"`
 	Content string   `xml:"xmlns:content,attr"`
+	Atom    string   `xml:"xmlns:atom,attr,omitempty"`
+	History string   `xml:"xmlns:fh,attr,omitempty"`
 
 	Channel Channel `xml:"channel"`
 }
@@ -25,27 +30,54 @@ type Channel struct {
 	Copyright   string `xml:"copyright,omitempty"`
 	Author      string `xml:"itunes:author,omitempty"`
 	Description string `xml:"description,omitempty"`
+	Summary     string `xml:"itunes:summary,omitempty"`
+	Language    string `xml:"language,omitempty"`
+	Explicit    bool   `xml:"itunes:explicit,omitempty"`
 	Type        string `xml:"itunes:type,omitempty"`
 	Image       struct {
 		Href string `xml:"href,attr,omitempty"`
 	} `xml:"itunes:image"`
+	Complete *struct{} `xml:"fh:complete"`
+	Archive  *struct{} `xml:"fh:archive"`
+	Links    []Link    `xml:"atom:link"`
 
 	Items []Item `xml:"item"`
 }
 
+// Link to another document of the feed, e.g. a page of paged feed (RFC 5005)
+type Link struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int    `xml:"length,attr,omitempty"`
+}
+
 // Item entity
 type Item struct {
 	Title     string    `xml:"title"`
 	Enclosure Enclosure `xml:"enclosure"`
 
-	GUID        string `xml:"guid,omitempty"`
-	PubDate     string `xml:"pubDate"`
-	Description string `xml:"description,omitempty"`
-	Duration    int    `xml:"itunes:duration"`
-	Link        string `xml:"link,omitempty"`
-	Explicit    bool   `xml:"itunes:explicit,omitempty"`
-	Season      int    `xml:"itunes:season,omitempty"`
-	Episode     int    `xml:"itunes:episode,omitempty"`
+	GUID           string `xml:"guid,omitempty"`
+	PubDate        string `xml:"pubDate"`
+	Description    string `xml:"description,omitempty"`
+	Summary        string `xml:"itunes:summary,omitempty"`
+	ContentEncoded *CDATA `xml:"content:encoded,omitempty"`
+	Image          *Image `xml:"itunes:image,omitempty"`
+	Duration       int    `xml:"itunes:duration"`
+	Link           string `xml:"link,omitempty"`
+	Explicit       bool   `xml:"itunes:explicit,omitempty"`
+	Season         int    `xml:"itunes:season,omitempty"`
+	Episode        int    `xml:"itunes:episode,omitempty"`
+}
+
+// CDATA section, so HTML stays readable in XML
+type CDATA struct {
+	Value string `xml:",cdata"`
+}
+
+// Image entity
+type Image struct {
+	Href string `xml:"href,attr"`
 }
 
 // Enclosure entity
@@ -55,18 +87,32 @@ type Enclosure struct {
 	Type   string `xml:"type,attr,omitempty"`
 }
 
-// GenerateFeed with content of channel
-func GenerateFeed(channel *store.Channel, podcasts []store.Podcast, host string) RSS {
+// GenerateFeed with content of channel. Defaults fill fields the channel leaves empty
+func GenerateFeed(channel *store.Channel, podcasts []store.Podcast, host string, defaults config.FeedDefaults) RSS {
 	feed := RSS{
 		Version: "2.0",
 		Itunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
 		Content: "http://purl.org/rss/1.0/modules/content/",
 	}
 
+	description := markdown.Text(channel.Description)
+
 	feed.Channel = Channel{
 		Title:       channel.Title,
-		Description: channel.Description,
+		Description: description,
+		Summary:     description,
 		Author:      channel.Author,
+		Copyright:   defaults.Copyright,
+		Language:    defaults.Language,
+		Type:        defaults.Type,
+	}
+
+	if feed.Channel.Author == "" {
+		feed.Channel.Author = defaults.Author
+	}
+
+	if defaults.Explicit != nil {
+		feed.Channel.Explicit = *defaults.Explicit
 	}
 
 	feed.Channel.Image.Href = channel.Cover
@@ -78,32 +124,115 @@ func GenerateFeed(channel *store.Channel, podcasts []store.Podcast, host string)
 			explicit = true
 		}
 
-		// Types
-		// mp3 (*.mp3): audio/mpeg
-		// aac (*.m4a): audio/x-m4a
+		url := enclosureURL(host, channel.Alias, p.Filename)
+		text, html := showNotes(p.Description, url)
 
-		cType := "audio/mpeg"
-		if _, ext := fs.NameAndExtFrom(p.Filename); ext == "m4a" {
-			cType = "audio/x-m4a"
-		}
-
-		items = append(items, Item{
+		item := Item{
 			Title: p.Title,
 			Enclosure: Enclosure{
-				URL:    strings.Join([]string{host, "files", channel.Alias, p.Filename}, "/"),
+				URL:    url,
 				Length: p.Length,
-				Type:   cType,
+				Type:   enclosureType(p.Filename),
 			},
 			GUID:        p.GUID,
 			PubDate:     p.PubDate,
-			Description: p.Description,
+			Description: text,
+			Summary:     text,
 			Duration:    p.Duration,
 			Explicit:    explicit,
 			Season:      p.Season,
 			Episode:     p.Episode,
-		})
+		}
+
+		if html != "" {
+			item.ContentEncoded = &CDATA{Value: html}
+		}
+
+		if image := artworkOf(channel, p); image != "" {
+			item.Image = &Image{Href: image}
+		}
+
+		items = append(items, item)
 	}
 
 	feed.Channel.Items = items
 	return feed
 }
+
+// showNotes written in Markdown as plain text and HTML. Timestamps in HTML
+// link to the episode file
+func showNotes(description, url string) (string, string) {
+	return markdown.Text(description), markdown.HTML(description, markdown.Options{TimestampURL: url})
+}
+
+// artworkOf episode, channel cover if it has no own
+func artworkOf(channel *store.Channel, p store.Podcast) string {
+	if p.Artwork != "" {
+		return p.Artwork
+	}
+	return channel.Cover
+}
+
+func enclosureURL(host, alias, filename string) string {
+	return strings.Join([]string{host, "files", alias, filename}, "/")
+}
+
+// Types
+// mp3 (*.mp3): audio/mpeg
+// aac (*.m4a): audio/x-m4a
+func enclosureType(filename string) string {
+	if _, ext := fs.NameAndExtFrom(filename); ext == "m4a" {
+		return "audio/x-m4a"
+	}
+	return "audio/mpeg"
+}
+
+// pubTime of podcast, pub date is kept in RSS format
+func pubTime(p store.Podcast) (time.Time, bool) {
+	for _, layout := range []string{"Mon, 2 Jan 2006 15:04:05 MST", time.RFC1123Z} {
+		if t, err := time.Parse(layout, p.PubDate); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// itemID is guid of podcast or URL of its file
+func itemID(host, alias string, p store.Podcast) string {
+	if p.GUID != "" {
+		return p.GUID
+	}
+	return enclosureURL(host, alias, p.Filename)
+}
+
+// HistoryNS of feed history elements (RFC 5005). There is no element for
+// paging or archives in podcast namespace, so it's left out
+const HistoryNS = "http://purl.org/syndication/history/1.0"
+
+// SetHistory of the document: complete one has all entries of the feed,
+// archive one has entries older than the current document
+func (r *RSS) SetHistory(complete, archive bool) {
+	r.History, r.Channel.Complete, r.Channel.Archive = history(complete, archive)
+}
+
+func history(complete, archive bool) (ns string, c, a *struct{}) {
+	if complete {
+		c = &struct{}{}
+	}
+	if archive {
+		a = &struct{}{}
+	}
+	if complete || archive {
+		ns = HistoryNS
+	}
+	return ns, c, a
+}
+
+// SetLinks of the feed, so Atom namespace is declared only when needed
+func (r *RSS) SetLinks(links []Link) {
+	r.Channel.Links = links
+	r.Atom = ""
+	if len(links) > 0 {
+		r.Atom = "http://www.w3.org/2005/Atom"
+	}
+}
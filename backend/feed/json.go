@@ -0,0 +1,102 @@
+package feed
+
+import (
+	"time"
+
+	"github.com/azzzak/fakecast/config"
+	"github.com/azzzak/fakecast/coverart"
+	"github.com/azzzak/fakecast/markdown"
+	"github.com/azzzak/fakecast/store"
+)
+
+// JSONFeedVersion implemented
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// iconSize of cover variant close to 512 px the spec suggests for icon
+const iconSize = 600
+
+// JSONFeed entity
+type JSONFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	FeedURL     string       `json:"feed_url,omitempty"`
+	NextURL     string       `json:"next_url,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Icon        string       `json:"icon,omitempty"`
+	Authors     []JSONAuthor `json:"authors,omitempty"`
+	Language    string       `json:"language,omitempty"`
+	Items       []JSONItem   `json:"items"`
+}
+
+// JSONAuthor entity
+type JSONAuthor struct {
+	Name string `json:"name"`
+}
+
+// JSONItem entity
+type JSONItem struct {
+	ID            string           `json:"id"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	ContentText   string           `json:"content_text"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	Attachments   []JSONAttachment `json:"attachments"`
+}
+
+// JSONAttachment entity
+type JSONAttachment struct {
+	URL               string `json:"url"`
+	MimeType          string `json:"mime_type"`
+	SizeInBytes       int    `json:"size_in_bytes,omitempty"`
+	DurationInSeconds int    `json:"duration_in_seconds,omitempty"`
+}
+
+// GenerateJSON feed with content of channel. nextURL is the next page of paged feed
+func GenerateJSON(channel *store.Channel, podcasts []store.Podcast, host string, defaults config.FeedDefaults, feedURL, nextURL string) JSONFeed {
+	feed := JSONFeed{
+		Version:     JSONFeedVersion,
+		Title:       channel.Title,
+		FeedURL:     feedURL,
+		NextURL:     nextURL,
+		Description: markdown.Text(channel.Description),
+		Icon:        coverart.Variant(channel.Cover, iconSize),
+		Language:    defaults.Language,
+		Items:       []JSONItem{},
+	}
+
+	author := channel.Author
+	if author == "" {
+		author = defaults.Author
+	}
+	if author != "" {
+		feed.Authors = []JSONAuthor{{Name: author}}
+	}
+
+	for _, p := range podcasts {
+		url := enclosureURL(host, channel.Alias, p.Filename)
+		text, html := showNotes(p.Description, url)
+
+		item := JSONItem{
+			ID:          itemID(host, channel.Alias, p),
+			Title:       p.Title,
+			ContentHTML: html,
+			ContentText: text,
+			Image:       p.Artwork,
+			Attachments: []JSONAttachment{{
+				URL:               url,
+				MimeType:          enclosureType(p.Filename),
+				SizeInBytes:       p.Length,
+				DurationInSeconds: p.Duration,
+			}},
+		}
+
+		if t, ok := pubTime(p); ok {
+			item.DatePublished = t.UTC().Format(time.RFC3339)
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed
+}
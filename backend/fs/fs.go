@@ -1,10 +1,13 @@
 package fs
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/azzzak/fakecast/coverart"
 )
 
 // CoverDirName const
@@ -16,13 +19,43 @@ const PodcastsDirName = "podcasts"
 // FrontDirName const
 const FrontDirName = "front"
 
+// TrashDirName of deleted content kept until purge
+const TrashDirName = ".trash"
+
+var (
+	// ErrCoverName of file which is not a processed cover
+	ErrCoverName = errors.New("invalid cover name")
+	// ErrOutside of channel dir, path of file leads elsewhere
+	ErrOutside = errors.New("path is outside of channel dir")
+)
+
 // Error type
 type Error struct {
-	Err error
+	Op   string
+	Path string
+	Err  error
 }
 
 func (err *Error) Error() string {
-	return err.Err.Error()
+	if err.Op == "" {
+		return err.Err.Error()
+	}
+
+	// os errors repeat the path, so only their cause is kept
+	cause := err.Err
+	switch e := cause.(type) {
+	case *os.PathError:
+		cause = e.Err
+	case *os.LinkError:
+		cause = e.Err
+	}
+
+	return err.Op + " " + err.Path + ": " + cause.Error()
+}
+
+// Unwrap underlying error
+func (err *Error) Unwrap() error {
+	return err.Err
 }
 
 // Dir entity
@@ -45,7 +78,7 @@ func NewRoot(root string) Dir {
 func (d *Dir) CreateDir(channel int64) error {
 	path := filepath.Join(d.Root, strconv.FormatInt(channel, 10), CoverDirName)
 	if err := os.MkdirAll(path, os.ModePerm); err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "create dir", Path: path, Err: err}
 	}
 	return nil
 }
@@ -58,7 +91,7 @@ func (d *Dir) CreateDir(channel int64) error {
 func (d *Dir) RemoveDir(channel string) error {
 	path := filepath.Join(d.Root, channel)
 	if err := os.RemoveAll(path); err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "remove dir", Path: path, Err: err}
 	}
 	return nil
 }
@@ -69,15 +102,19 @@ func (d *Dir) RemovePodcast(channel, podcast string) error {
 	return d.remove(path)
 }
 
-// RemoveCover action
+// RemoveCover action. Only processed covers are removed, so stored name
+// can't point anywhere else
 func (d *Dir) RemoveCover(channel, cover string) error {
 	path := filepath.Join(d.Root, channel, CoverDirName, cover)
+	if !filepath.IsLocal(channel) || filepath.Base(cover) != cover || strings.HasPrefix(cover, ".") || !coverart.Valid(cover) {
+		return &Error{Op: "remove", Path: path, Err: ErrCoverName}
+	}
 	return d.remove(path)
 }
 
 func (d *Dir) remove(path string) error {
 	if err := os.Remove(path); err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "remove", Path: path, Err: err}
 	}
 	return nil
 }
@@ -101,7 +138,7 @@ func (d *Dir) SaveCover(channel, filename string) (*os.File, error) {
 func (d *Dir) save(path string) (*os.File, error) {
 	f, err := os.Create(path)
 	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: "save", Path: path, Err: err}
 	}
 	return f, nil
 }
@@ -116,11 +153,123 @@ func (d *Dir) RenameDir(old, new string) error {
 		return filepath.Join(d.Root, s)
 	}
 	if err := os.Rename(expose(old), expose(new)); err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "rename", Path: expose(old), Err: err}
 	}
 	return nil
 }
 
+//
+// Trash
+//
+
+// TrashDir of channel, so it's kept as item of trash
+func (d *Dir) TrashDir(item, channel string) error {
+	if err := os.MkdirAll(d.trash(), os.ModePerm); err != nil {
+		return &Error{Op: "trash", Path: d.trash(), Err: err}
+	}
+
+	path := filepath.Join(d.Root, channel)
+	if err := os.Rename(path, d.trash(item)); err != nil {
+		return &Error{Op: "trash", Path: path, Err: err}
+	}
+	return nil
+}
+
+// TrashFiles of channel, so they are kept as item of trash. Files are
+// relative to channel dir, missing ones are skipped
+func (d *Dir) TrashFiles(item, channel string, files ...string) error {
+	if !filepath.IsLocal(item) || !filepath.IsLocal(channel) {
+		return &Error{Op: "trash", Path: filepath.Join(d.Root, channel), Err: ErrOutside}
+	}
+	for _, f := range files {
+		path := filepath.Join(d.Root, channel, f)
+		if !filepath.IsLocal(f) {
+			return &Error{Op: "trash", Path: path, Err: ErrOutside}
+		}
+	}
+
+	for _, f := range files {
+		path := filepath.Join(d.Root, channel, f)
+		if !isFileExist(path) {
+			continue
+		}
+
+		dest := d.trash(item, f)
+		if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+			return &Error{Op: "trash", Path: dest, Err: err}
+		}
+		if err := os.Rename(path, dest); err != nil {
+			return &Error{Op: "trash", Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+// Restore item of trash into channel dir and return files moved, relative
+// to channel dir, so they can be put back with TrashFiles. Nothing is moved
+// if some file is in the way, then error is os.ErrExist. Links are never
+// restored, they could lead out of channel dir
+func (d *Dir) Restore(item, channel string) ([]string, error) {
+	src := d.trash(item)
+	if !filepath.IsLocal(item) || !filepath.IsLocal(channel) {
+		return nil, &Error{Op: "restore", Path: src, Err: ErrOutside}
+	}
+
+	var files []string
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return ErrOutside
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(src, path)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &Error{Op: "restore", Path: src, Err: err}
+	}
+
+	for _, f := range files {
+		if dest := filepath.Join(d.Root, channel, f); isFileExist(dest) {
+			return nil, &Error{Op: "restore", Path: dest, Err: os.ErrExist}
+		}
+	}
+
+	// channel dirs are restored even if they are empty
+	if err := os.MkdirAll(filepath.Join(d.Root, channel, CoverDirName), os.ModePerm); err != nil {
+		return nil, &Error{Op: "restore", Path: filepath.Join(d.Root, channel), Err: err}
+	}
+
+	for i, f := range files {
+		dest := filepath.Join(d.Root, channel, f)
+		if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+			return files[:i], &Error{Op: "restore", Path: dest, Err: err}
+		}
+		if err := os.Rename(filepath.Join(src, f), dest); err != nil {
+			return files[:i], &Error{Op: "restore", Path: dest, Err: err}
+		}
+	}
+
+	return files, d.Purge(item)
+}
+
+// Purge item of trash for good
+func (d *Dir) Purge(item string) error {
+	path := d.trash(item)
+	if err := os.RemoveAll(path); err != nil {
+		return &Error{Op: "purge", Path: path, Err: err}
+	}
+	return nil
+}
+
+func (d *Dir) trash(p ...string) string {
+	return filepath.Join(append([]string{d.Root, TrashDirName}, p...)...)
+}
+
 //
 // Helpers
 //
@@ -143,6 +292,24 @@ func isFileExist(p ...string) bool {
 	return false
 }
 
+// Usage of disk by content in bytes
+func (d *Dir) Usage() (int64, error) {
+	var size int64
+	err := filepath.Walk(d.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, &Error{Op: "usage", Path: d.Root, Err: err}
+	}
+	return size, nil
+}
+
 // NameAndExtFrom helper
 func NameAndExtFrom(filename string) (string, string) {
 	t := strings.Split(filename, ".")
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -87,7 +88,7 @@ func TestRemove(t *testing.T) {
 	_, err = os.Stat(path)
 	assert.Nil(err)
 
-	coverName := "image.jpg"
+	coverName := "0123456789abcdef.jpg"
 	coverPath := filepath.Join(d.Root, channelStr, CoverDirName, coverName)
 	_, err = os.Create(coverPath)
 	assert.Nil(err)
@@ -104,6 +105,13 @@ func TestRemove(t *testing.T) {
 	err = d.RemoveCover(channelStr, coverName)
 	assert.NotNil(err)
 
+	// names which are not processed covers are never removed
+	for _, name := range []string{"../" + podcastName, ".hidden", "image.jpg", "cover/0123456789abcdef.jpg"} {
+		err = d.RemoveCover(channelStr, name)
+		assert.True(errors.Is(err, ErrCoverName), name)
+	}
+	assert.True(d.IsPodcastExist(channelStr, podcastName))
+
 	err = d.RemovePodcast(channelStr, podcastName)
 	assert.Nil(err)
 	_, err = os.Stat(podcastPath)
@@ -286,3 +294,126 @@ func TestNameAndExtFrom(t *testing.T) {
 		})
 	}
 }
+
+func TestError(t *testing.T) {
+	assert := assert.New(t)
+
+	d := &Dir{
+		Root: filepath.Join("not_exist", PodcastsDirName),
+	}
+
+	err := d.RemovePodcast("channel", "podcast.mp3")
+	assert.NotNil(err)
+
+	fsErr, ok := err.(*Error)
+	assert.True(ok)
+	assert.Equal("remove", fsErr.Op)
+	assert.Equal(filepath.Join(d.Root, "channel", "podcast.mp3"), fsErr.Path)
+	assert.True(os.IsNotExist(errors.Unwrap(fsErr)))
+	assert.Equal("remove "+fsErr.Path+": no such file or directory", err.Error())
+}
+
+func TestUsage(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+	defer func() {
+		err := os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	d := &Dir{
+		Root: filepath.Join(testDir, PodcastsDirName),
+	}
+
+	_, err := d.Usage()
+	assert.NotNil(err)
+
+	err = d.CreateDir(1)
+	assert.Nil(err)
+
+	err = ioutil.WriteFile(filepath.Join(d.Root, "1", "podcast.mp3"), make([]byte, 100), 0644)
+	assert.Nil(err)
+	err = ioutil.WriteFile(filepath.Join(d.Root, "1", CoverDirName, "cover.jpg"), make([]byte, 20), 0644)
+	assert.Nil(err)
+
+	n, err := d.Usage()
+	assert.Nil(err)
+	assert.Equal(int64(120), n)
+}
+
+func TestTrash(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+	defer func() {
+		err := os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	d := &Dir{
+		Root: filepath.Join(testDir, PodcastsDirName),
+	}
+
+	err := d.CreateDir(1)
+	assert.Nil(err)
+
+	podcastPath := filepath.Join(d.Root, "1", "podcast.mp3")
+	artworkPath := filepath.Join(d.Root, "1", CoverDirName, "artwork.jpg")
+	err = ioutil.WriteFile(podcastPath, []byte("audio"), 0644)
+	assert.Nil(err)
+	err = ioutil.WriteFile(artworkPath, []byte("image"), 0644)
+	assert.Nil(err)
+
+	// missing variant of artwork is skipped
+	err = d.TrashFiles("podcast-1", "1", "podcast.mp3", filepath.Join(CoverDirName, "artwork.jpg"), filepath.Join(CoverDirName, "artwork-300.jpg"))
+	assert.Nil(err)
+	assert.False(d.IsPodcastExist("1", "podcast.mp3"))
+	_, err = os.Stat(artworkPath)
+	assert.True(errors.Is(err, os.ErrNotExist))
+	_, err = os.Stat(filepath.Join(d.Root, TrashDirName, "podcast-1", "podcast.mp3"))
+	assert.Nil(err)
+
+	// file in the way blocks restore, nothing is moved
+	err = ioutil.WriteFile(podcastPath, []byte("another"), 0644)
+	assert.Nil(err)
+	files, err := d.Restore("podcast-1", "1")
+	assert.True(errors.Is(err, os.ErrExist))
+	assert.Empty(files)
+	_, err = os.Stat(artworkPath)
+	assert.True(errors.Is(err, os.ErrNotExist))
+
+	err = os.Remove(podcastPath)
+	assert.Nil(err)
+	files, err = d.Restore("podcast-1", "1")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"podcast.mp3", filepath.Join(CoverDirName, "artwork.jpg")}, files)
+	data, err := ioutil.ReadFile(podcastPath)
+	assert.Nil(err)
+	assert.Equal("audio", string(data))
+	_, err = os.Stat(artworkPath)
+	assert.Nil(err)
+	assert.False(isFileExist(d.Root, TrashDirName, "podcast-1"))
+
+	// channel comes back under another alias
+	err = d.TrashDir("channel-1", "1")
+	assert.Nil(err)
+	assert.False(d.IsDirExist("1"))
+
+	_, err = d.Restore("channel-1", "news")
+	assert.Nil(err)
+	assert.True(d.IsPodcastExist("news", "podcast.mp3"))
+
+	// files out of channel dir are not trashed
+	err = d.TrashFiles("podcast-2", "news", "podcast.mp3", "../news/podcast.mp3")
+	assert.True(errors.Is(err, ErrOutside))
+	assert.True(d.IsPodcastExist("news", "podcast.mp3"))
+	err = d.TrashFiles("podcast-2", "..", "news/podcast.mp3")
+	assert.True(errors.Is(err, ErrOutside))
+	_, err = d.Restore("podcast-2", "../news")
+	assert.True(errors.Is(err, ErrOutside))
+
+	err = d.TrashDir("channel-1", "news")
+	assert.Nil(err)
+	err = d.Purge("channel-1")
+	assert.Nil(err)
+	assert.False(isFileExist(d.Root, TrashDirName, "channel-1"))
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,99 +16,256 @@ import (
 	"time"
 
 	"github.com/azzzak/fakecast/api"
+	"github.com/azzzak/fakecast/cert"
+	"github.com/azzzak/fakecast/config"
 	"github.com/azzzak/fakecast/fs"
 	"github.com/azzzak/fakecast/store"
+	"github.com/azzzak/fakecast/useragent"
 )
 
 var version string
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCmd(os.Args[2:]))
+	}
+
 	var (
+		configPath string = ""
 		host       string = ""
-		root       string = "/fakecast"
+		root       string = ""
 		credential string = ""
-		listenPort int    = 80
+		listen     string = ""
+		listenPort int    = 0
 	)
 
-	flag.StringVar(&host, "host", lookupEnvOrString("HOST", host), "host url")
-	flag.StringVar(&root, "root", lookupEnvOrString("ROOT", root), "root of content directory")
-	flag.StringVar(&credential, "credential", lookupEnvOrString("CREDENTIAL", credential), "access credential")
-	flag.IntVar(&listenPort, "port", lookupEnvOrInt("PORT", listenPort), "port")
+	flag.StringVar(&configPath, "config", lookupEnvOrString("CONFIG", configPath), "path to YAML config file")
+	flag.StringVar(&host, "host", host, "host url")
+	flag.StringVar(&root, "root", root, "root of content directory")
+	flag.StringVar(&credential, "credential", credential, "access credential")
+	flag.StringVar(&listen, "listen", listen, "listen address")
+	flag.IntVar(&listenPort, "port", listenPort, "port")
 
 	flag.Parse()
 
-	if host == "" {
+	// precedence: flags > env > config file > defaults
+	c, err := config.Load(configPath)
+	if err != nil {
+		fmt.Printf("Error while loading config %s:\n%s\n", configPath, err)
+		os.Exit(1)
+	}
+
+	if err := c.ApplyEnv(os.LookupEnv); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			c.Host = host
+		case "root":
+			c.Storage.Root = root
+		case "credential":
+			c.Credential = credential
+		case "listen":
+			c.Listen = listen
+		case "port":
+			c.Port = listenPort
+		}
+	})
+
+	if c.Host == "" {
 		fmt.Println("You must set HOST env variable to proper work of app")
 		os.Exit(1)
 	}
 
+	if errs := c.Check(); len(errs) > 0 {
+		fmt.Printf("Invalid config:\n%s\n", errs)
+		os.Exit(1)
+	}
+
+	log := newLogger(c.Log)
+	slog.SetDefault(log)
+
+	proxies, _ := c.Server.Proxies()
+
+	agents := useragent.Default()
+	if c.Analytics.UserAgents != "" {
+		if agents, err = useragent.Load(c.Analytics.UserAgents); err != nil {
+			log.Error("Error while loading user agent rules", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	host = c.Host
 	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
 		host = fmt.Sprintf("https://%s", host)
 	}
 	host = strings.TrimSuffix(host, "/")
 
-	s, err := store.NewStore(root)
+	s, err := store.NewStore(c.Storage.Root)
 	if err != nil {
-		fmt.Printf("Error while connecting to DB: %s\n", err)
+		log.Error("Error while connecting to DB", "err", err)
 		os.Exit(1)
 	}
 	defer s.Close()
 
-	fs := fs.NewRoot(root)
+	fs := fs.NewRoot(c.Storage.Root)
 
 	cfg := &api.Cfg{
 		Store:      s,
 		FS:         fs,
 		Host:       host,
-		Credential: credential,
+		Credential: c.Credential,
+		Users:      c.Users(),
+		Auth:       c.Auth,
+		Feed:       c.Feed,
+		Server:     c.Server,
+		TLS:        c.TLS,
+		Metrics:    c.Metrics,
+		Audit:      c.Audit,
+		Trash:      c.Trash,
+
+		Log:            log,
+		TrustedProxies: proxies,
+		Agents:         agents,
 	}
 
+	// read and write deadlines are set per route by api handlers
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", listenPort),
-		Handler:      api.InitHandlers(cfg),
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 5 * time.Second,
-		IdleTimeout:  10 * time.Second,
+		Addr:              c.Addr(),
+		Handler:           api.InitHandlers(cfg),
+		ReadHeaderTimeout: c.Server.ReadHeaderTimeout,
+		IdleTimeout:       c.Server.IdleTimeout,
 	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("Could not listen on port %d: %v\n", listenPort, err)
+	servers := []*http.Server{srv}
+	stopWatch := make(chan struct{})
+
+	go cfg.Housekeep(time.Hour, stopWatch)
+
+	if c.TLS.Cert != "" {
+		reloader, err := cert.NewReloader(c.TLS.Cert, c.TLS.Key)
+		if err != nil {
+			log.Error("Error while loading TLS certificate", "err", err)
+			os.Exit(1)
+		}
+
+		if c.TLS.ReloadInterval > 0 {
+			go reloader.Watch(c.TLS.ReloadInterval, stopWatch)
+		}
+
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
 		}
-	}()
 
-	fmt.Printf("fakecast %s is running\n", version)
+		if c.TLS.ClientCA != "" {
+			pool, err := cert.LoadPool(c.TLS.ClientCA)
+			if err != nil {
+				log.Error("Error while loading client CA", "err", err)
+				os.Exit(1)
+			}
+			// certificate is checked by /api routes only, so other routes
+			// stay available to podcast apps
+			srv.TLSConfig.ClientCAs = pool
+			srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+
+		if c.TLS.RedirectPort > 0 {
+			servers = append(servers, &http.Server{
+				Addr:              net.JoinHostPort(c.Listen, strconv.Itoa(c.TLS.RedirectPort)),
+				Handler:           api.RedirectHandler(host),
+				ReadHeaderTimeout: c.Server.ReadHeaderTimeout,
+				IdleTimeout:       c.Server.IdleTimeout,
+			})
+		}
+	}
+
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.Error("Could not listen", "addr", srv.Addr, "err", err)
+			}
+		}(srv)
+	}
+
+	log.Info("fakecast is running", "version", version, "addr", srv.Addr)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	<-stop
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	close(stopWatch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Server.ShutdownTimeout)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error("Error while stopping server", "err", err)
+			os.Exit(1)
+		}
 	}
 
-	fmt.Println("fakecast is stopped")
+	log.Info("fakecast is stopped")
 }
 
-func lookupEnvOrString(key string, defaultVal string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return val
+func newLogger(c config.Log) *slog.Logger {
+	level, _ := c.SlogLevel()
+	opts := &slog.HandlerOptions{Level: level}
+
+	if c.Format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
 	}
-	return defaultVal
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
 }
 
-func lookupEnvOrInt(key string, defaultVal int) int {
-	if val, ok := os.LookupEnv(key); ok {
-		v, err := strconv.Atoi(val)
-		if err != nil {
-			fmt.Printf("Env[%s]: %v", key, err)
-			os.Exit(1)
+func configCmd(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Println("Usage: fakecast config validate [--config fakecast.yaml]")
+		return 2
+	}
+
+	cmd := flag.NewFlagSet("config validate", flag.ExitOnError)
+	path := cmd.String("config", lookupEnvOrString("CONFIG", "fakecast.yaml"), "path to YAML config file")
+	cmd.Parse(args[1:])
+
+	err := config.Validate(*path, os.LookupEnv)
+	if err == nil {
+		fmt.Printf("%s is valid\n", *path)
+		return 0
+	}
+
+	errs, ok := err.(config.Errors)
+	if !ok {
+		fmt.Println(err)
+		return 1
+	}
+
+	for _, e := range errs {
+		line := e.Line
+		e.Line = 0
+		if line > 0 {
+			fmt.Printf("%s:%d: %s\n", *path, line, e)
+			continue
 		}
-		return v
+		fmt.Printf("%s: %s\n", *path, e)
+	}
+
+	return 1
+}
+
+func lookupEnvOrString(key string, defaultVal string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return val
 	}
 	return defaultVal
 }
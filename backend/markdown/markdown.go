@@ -0,0 +1,408 @@
+// Package markdown renders show notes written in a subset of Markdown.
+// Raw HTML is never passed through, so rendered HTML is safe to embed in feeds
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Options of rendering
+type Options struct {
+	// TimestampURL is a media file timestamps like 12:34 link to, with
+	// fragment #t=seconds. Timestamps are left as is when it's empty
+	TimestampURL string
+}
+
+type blockKind int
+
+const (
+	paragraph blockKind = iota
+	heading
+	bulletList
+	orderedList
+	quote
+	code
+	rule
+)
+
+type block struct {
+	kind  blockKind
+	level int
+	lines []string
+	// items of lists, each item may span several lines
+	items [][]string
+}
+
+var (
+	headingLine  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	bulletLine   = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedLine  = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	quoteLine    = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	fenceLine    = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	timestamp    = regexp.MustCompile(`^(?:(\d{1,2}):)?([0-5]?\d):([0-5]\d)`)
+	safeSchemes  = []string{"http://", "https://", "mailto:"}
+	trailingPunc = ".,;:!?)'\""
+)
+
+// parse source into blocks
+func parse(src string) []block {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var (
+		blocks []block
+		cur    *block
+	)
+
+	flush := func() {
+		if cur != nil {
+			blocks = append(blocks, *cur)
+			cur = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := fenceLine.FindStringSubmatch(line); m != nil {
+			flush()
+			b := block{kind: code}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+				b.lines = append(b.lines, lines[i])
+			}
+			blocks = append(blocks, b)
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		if m := headingLine.FindStringSubmatch(line); m != nil {
+			flush()
+			blocks = append(blocks, block{kind: heading, level: len(m[1]), lines: []string{m[2]}})
+			continue
+		}
+
+		if isRule(line) {
+			flush()
+			blocks = append(blocks, block{kind: rule})
+			continue
+		}
+
+		if m := bulletLine.FindStringSubmatch(line); m != nil {
+			if cur == nil || cur.kind != bulletList {
+				flush()
+				cur = &block{kind: bulletList}
+			}
+			cur.items = append(cur.items, []string{m[1]})
+			continue
+		}
+
+		if m := orderedLine.FindStringSubmatch(line); m != nil {
+			if cur == nil || cur.kind != orderedList {
+				flush()
+				cur = &block{kind: orderedList}
+			}
+			cur.items = append(cur.items, []string{m[1]})
+			continue
+		}
+
+		if m := quoteLine.FindStringSubmatch(line); m != nil {
+			if cur == nil || cur.kind != quote {
+				flush()
+				cur = &block{kind: quote}
+			}
+			cur.lines = append(cur.lines, m[1])
+			continue
+		}
+
+		switch {
+		case cur == nil:
+			cur = &block{kind: paragraph}
+		case cur.kind == bulletList || cur.kind == orderedList:
+			// continuation of the last item
+			last := len(cur.items) - 1
+			cur.items[last] = append(cur.items[last], strings.TrimSpace(line))
+			continue
+		case cur.kind != paragraph:
+			flush()
+			cur = &block{kind: paragraph}
+		}
+		cur.lines = append(cur.lines, strings.TrimSpace(line))
+	}
+	flush()
+
+	return blocks
+}
+
+// HTML of Markdown source
+func HTML(src string, opts Options) string {
+	r := renderer{opts: opts, html: true}
+
+	var sb strings.Builder
+	for _, b := range parse(src) {
+		switch b.kind {
+		case paragraph:
+			sb.WriteString("<p>" + r.lines(b.lines) + "</p>\n")
+		case heading:
+			fmt.Fprintf(&sb, "<h%d>%s</h%d>\n", b.level, r.inline(b.lines[0]), b.level)
+		case bulletList, orderedList:
+			tag := "ul"
+			if b.kind == orderedList {
+				tag = "ol"
+			}
+			sb.WriteString("<" + tag + ">\n")
+			for _, item := range b.items {
+				sb.WriteString("<li>" + r.lines(item) + "</li>\n")
+			}
+			sb.WriteString("</" + tag + ">\n")
+		case quote:
+			sb.WriteString("<blockquote><p>" + r.lines(b.lines) + "</p></blockquote>\n")
+		case code:
+			sb.WriteString("<pre><code>" + html.EscapeString(strings.Join(b.lines, "\n")) + "</code></pre>\n")
+		case rule:
+			sb.WriteString("<hr>\n")
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Text of Markdown source without markup. Links keep their URLs
+func Text(src string) string {
+	r := renderer{}
+
+	var parts []string
+	for _, b := range parse(src) {
+		switch b.kind {
+		case paragraph, quote:
+			parts = append(parts, r.lines(b.lines))
+		case heading:
+			parts = append(parts, r.inline(b.lines[0]))
+		case bulletList, orderedList:
+			var items []string
+			for i, item := range b.items {
+				marker := "-"
+				if b.kind == orderedList {
+					marker = strconv.Itoa(i+1) + "."
+				}
+				items = append(items, marker+" "+r.lines(item))
+			}
+			parts = append(parts, strings.Join(items, "\n"))
+		case code:
+			parts = append(parts, strings.Join(b.lines, "\n"))
+		}
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+type renderer struct {
+	opts Options
+	html bool
+	// inside of link text, where nested links are not allowed
+	inLink bool
+}
+
+func (r renderer) lines(lines []string) string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = r.inline(l)
+	}
+
+	if r.html {
+		return strings.Join(out, "<br>\n")
+	}
+	return strings.Join(out, "\n")
+}
+
+func (r renderer) text(s string) string {
+	if r.html {
+		return html.EscapeString(s)
+	}
+	return s
+}
+
+// inline markup of a line
+func (r renderer) inline(s string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		boundary := i == 0 || !isWordChar(s[i-1])
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_[]()#+-.!<>", s[i+1]) >= 0:
+			sb.WriteString(r.text(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end >= 0 {
+				inner := s[i+1 : i+1+end]
+				if r.html {
+					sb.WriteString("<code>" + html.EscapeString(inner) + "</code>")
+				} else {
+					sb.WriteString(inner)
+				}
+				i += end + 2
+				continue
+			}
+
+		case c == '[' && !r.inLink:
+			if text, url, n, ok := parseLink(s[i:]); ok {
+				sb.WriteString(r.link(text, url))
+				i += n
+				continue
+			}
+
+		case (c == '*' || c == '_') && (c == '*' || boundary):
+			if out, n, ok := r.emphasis(s[i:]); ok {
+				sb.WriteString(out)
+				i += n
+				continue
+			}
+
+		case boundary && !r.inLink && (strings.HasPrefix(s[i:], "http://") || strings.HasPrefix(s[i:], "https://")):
+			end := strings.IndexAny(s[i:], " \t<>")
+			if end < 0 {
+				end = len(s) - i
+			}
+			url := strings.TrimRight(s[i:i+end], trailingPunc)
+			sb.WriteString(r.link(url, url))
+			i += len(url)
+			continue
+
+		case boundary && !r.inLink && c >= '0' && c <= '9':
+			if m := timestamp.FindStringSubmatch(s[i:]); m != nil && (i+len(m[0]) == len(s) || !isWordChar(s[i+len(m[0])])) {
+				sb.WriteString(r.timestamp(m))
+				i += len(m[0])
+				continue
+			}
+		}
+
+		sb.WriteString(r.text(s[i : i+1]))
+		i++
+	}
+
+	return sb.String()
+}
+
+// emphasis starting at s, ** or __ is strong
+func (r renderer) emphasis(s string) (string, int, bool) {
+	delim := s[:1]
+	if strings.HasPrefix(s, delim+delim) {
+		delim += delim
+	}
+
+	end := strings.Index(s[len(delim):], delim)
+	if end <= 0 {
+		return "", 0, false
+	}
+	inner := s[len(delim) : len(delim)+end]
+	if strings.TrimSpace(inner) != inner {
+		return "", 0, false
+	}
+
+	n := 2*len(delim) + end
+	if !r.html {
+		return r.inline(inner), n, true
+	}
+
+	tag := "em"
+	if len(delim) == 2 {
+		tag = "strong"
+	}
+	return "<" + tag + ">" + r.inline(inner) + "</" + tag + ">", n, true
+}
+
+func (r renderer) link(text, url string) string {
+	inner := r
+	inner.inLink = true
+
+	if !safeURL(url) {
+		return inner.inline(text)
+	}
+
+	if !r.html {
+		if text == url {
+			return url
+		}
+		return inner.inline(text) + " (" + url + ")"
+	}
+
+	return `<a href="` + html.EscapeString(url) + `">` + inner.inline(text) + "</a>"
+}
+
+func (r renderer) timestamp(m []string) string {
+	if !r.html || r.opts.TimestampURL == "" {
+		return m[0]
+	}
+
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.Atoi(m[3])
+
+	url := fmt.Sprintf("%s#t=%d", r.opts.TimestampURL, hours*3600+minutes*60+seconds)
+	return `<a href="` + html.EscapeString(url) + `">` + m[0] + "</a>"
+}
+
+// parseLink like [text](url) at start of s
+func parseLink(s string) (string, string, int, bool) {
+	mid := strings.Index(s, "](")
+	if mid < 0 {
+		return "", "", 0, false
+	}
+
+	// URL may have balanced parentheses itself
+	end, depth := -1, 0
+	for i, c := range s[mid+2:] {
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth == 0 {
+				end = i
+				break
+			}
+			depth--
+		}
+	}
+	if end < 0 {
+		return "", "", 0, false
+	}
+
+	url := strings.TrimSpace(s[mid+2 : mid+2+end])
+	if url == "" || strings.ContainsAny(url, " \t") {
+		return "", "", 0, false
+	}
+
+	return s[1:mid], url, mid + 3 + end, true
+}
+
+func safeURL(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range safeSchemes {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRule like --- or * * *
+func isRule(line string) bool {
+	s := strings.Join(strings.Fields(line), "")
+	if len(s) < 3 || strings.IndexByte("-*_", s[0]) < 0 {
+		return false
+	}
+	return strings.Count(s, s[:1]) == len(s)
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
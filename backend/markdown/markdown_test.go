@@ -0,0 +1,68 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTML(t *testing.T) {
+	opts := Options{TimestampURL: "https://host/files/news/ep.mp3"}
+
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"empty", "", ""},
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>"},
+		{"heading", "## Topics ##", "<h2>Topics</h2>"},
+		{"emphasis", "*a* **b** _c_ __d__ snake_case_name", "<p><em>a</em> <strong>b</strong> <em>c</em> <strong>d</strong> snake_case_name</p>"},
+		{"code", "run `<b>` now\n```\n<i>x</i>\n```", "<p>run <code>&lt;b&gt;</code> now</p>\n<pre><code>&lt;i&gt;x&lt;/i&gt;</code></pre>"},
+		{"link", "see [the *site*](https://example.com/?a=1&b=2)", `<p>see <a href="https://example.com/?a=1&amp;b=2">the <em>site</em></a></p>`},
+		{"unsafe link", "[click](javascript:alert(1))", "<p>click</p>"},
+		{"bare url", "at https://example.com/path.", `<p>at <a href="https://example.com/path">https://example.com/path</a>.</p>`},
+		{"raw html", `<script>alert("x")</script>`, "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>"},
+		{"escape", `\*not em\*`, "<p>*not em*</p>"},
+		{"lists", "- one\n- two\n  more\n\n1. first\n2) second", "<ul>\n<li>one</li>\n<li>two<br>\nmore</li>\n</ul>\n<ol>\n<li>first</li>\n<li>second</li>\n</ol>"},
+		{"quote", "> said\n> twice", "<blockquote><p>said<br>\ntwice</p></blockquote>"},
+		{"rule", "a\n\n---\n\nb", "<p>a</p>\n<hr>\n<p>b</p>"},
+		{
+			"timestamps",
+			"00:00 Intro\n12:34 Topic\n1:02:03 Outro\nnot 12:345 or 99:99",
+			`<p><a href="https://host/files/news/ep.mp3#t=0">00:00</a> Intro<br>` + "\n" +
+				`<a href="https://host/files/news/ep.mp3#t=754">12:34</a> Topic<br>` + "\n" +
+				`<a href="https://host/files/news/ep.mp3#t=3723">1:02:03</a> Outro<br>` + "\n" +
+				`not 12:345 or 99:99</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, HTML(tt.src, opts))
+		})
+	}
+}
+
+func TestHTMLWithoutTimestampURL(t *testing.T) {
+	assert.Equal(t, "<p>12:34 Topic</p>", HTML("12:34 Topic", Options{}))
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"empty", "", ""},
+		{"markup", "# Title\n\n**Bold** and `code`, [site](https://example.com)", "Title\n\nBold and code, site (https://example.com)"},
+		{"bare url", "https://example.com", "https://example.com"},
+		{"lists", "* one\n* two\n\n3. three\n4. four", "- one\n- two\n\n1. three\n2. four"},
+		{"html is kept as text", "<b>x</b>", "<b>x</b>"},
+		{"timestamps", "12:34 Topic", "12:34 Topic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Text(tt.src))
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets for latencies in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default registry
+var Default = NewRegistry()
+
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry of metrics exposed in Prometheus text format
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry constructor
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register collector replacing one with the same name
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, old := range r.collectors {
+		if old.name() == c.name() {
+			r.collectors[i] = c
+			return
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all metrics in text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	cs := make([]collector, len(r.collectors))
+	copy(cs, r.collectors)
+	r.mu.Unlock()
+
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].name() < cs[j].name()
+	})
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range cs {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves metrics of registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+//
+// Counter
+//
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec registers new counter
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{n: name, help: help, labels: labels},
+		values: map[string]float64{},
+	}
+	r.register(c)
+	return c
+}
+
+// NewCounterVec registers new counter in default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// Inc counter by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add v to counter. Negative values are ignored
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value of counter
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[c.key(labelValues)]
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.header(w, "counter")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.n, c.labelString(key, ""), formatFloat(c.values[key]))
+	}
+}
+
+//
+// Histogram
+//
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers new histogram. DefBuckets are used if buckets are nil
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	h := &HistogramVec{
+		desc:    desc{n: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  map[string]*histogram{},
+	}
+	r.register(h)
+	return h
+}
+
+// NewHistogramVec registers new histogram in default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// Observe value
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+
+	for i, b := range h.buckets {
+		if v <= b {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// Count of observations
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if hv, ok := h.values[h.key(labelValues)]; ok {
+		return hv.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hv := h.values[key]
+		for i, b := range h.buckets {
+			le := `le="` + formatFloat(b) + `"`
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.n, h.labelString(key, le), hv.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.n, h.labelString(key, `le="+Inf"`), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.n, h.labelString(key, ""), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.n, h.labelString(key, ""), hv.count)
+	}
+}
+
+//
+// Gauge
+//
+
+// GaugeFunc is a gauge which value is taken on collect
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers new gauge
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{
+		desc: desc{n: name, help: help},
+		fn:   fn,
+	}
+	r.register(g)
+	return g
+}
+
+// NewGaugeFunc registers new gauge in default registry
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return Default.NewGaugeFunc(name, help, fn)
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.n, formatFloat(g.fn()))
+}
+
+//
+// Helpers
+//
+
+type desc struct {
+	n      string
+	help   string
+	labels []string
+}
+
+func (d *desc) name() string {
+	return d.n
+}
+
+func (d *desc) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.n, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.n, kind)
+}
+
+// key joins label values. Missing values are empty, extra are dropped
+func (d *desc) key(values []string) string {
+	v := make([]string, len(d.labels))
+	copy(v, values)
+	return strings.Join(v, "\xff")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (d *desc) labelString(key, extra string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+labelEscaper.Replace(v)+`"`)
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
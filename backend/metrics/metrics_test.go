@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+	r := NewRegistry()
+
+	c := r.NewCounterVec("test_requests_total", "Requests", "method", "path")
+	c.Inc("GET", "/a")
+	c.Add(2, "GET", "/a")
+	c.Inc("POST", `/b"c`)
+	c.Add(-1, "POST", `/b"c`)
+
+	h := r.NewHistogramVec("test_duration_seconds", "Duration", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	r.NewGaugeFunc("test_items", "Items", func() float64 {
+		return 42
+	})
+
+	assert.Equal(float64(3), c.Value("GET", "/a"))
+	assert.Equal(uint64(3), h.Count())
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	assert.Nil(err)
+
+	want := `# HELP test_duration_seconds Duration
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 2.55
+test_duration_seconds_count 3
+# HELP test_items Items
+# TYPE test_items gauge
+test_items 42
+# HELP test_requests_total Requests
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/a"} 3
+test_requests_total{method="POST",path="/b\"c"} 1
+`
+	assert.Equal(want, buf.String())
+}
+
+func TestRegisterReplaces(t *testing.T) {
+	assert := assert.New(t)
+	r := NewRegistry()
+
+	r.NewGaugeFunc("test_items", "Items", func() float64 { return 1 })
+	r.NewGaugeFunc("test_items", "Items", func() float64 { return 2 })
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal("text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal("# HELP test_items Items\n# TYPE test_items gauge\ntest_items 2\n", w.Body.String())
+}
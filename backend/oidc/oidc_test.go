@@ -0,0 +1,114 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azzzak/fakecast/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChallenge(t *testing.T) {
+	// printf verifier | openssl dgst -sha256 -binary | base64url
+	assert.Equal(t, "iMnq5o6zALKXGivsnlom_0F5_WYda32GHkxlV7mq7hQ", Challenge("verifier"))
+}
+
+// login with provider, returning code of callback
+func login(t *testing.T, p *Provider, nonce, verifier string) string {
+	authURL, err := p.AuthURL(context.Background(), "state", nonce, verifier)
+	assert.Nil(t, err)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	back, err := url.Parse(resp.Header.Get("Location"))
+	assert.Nil(t, err)
+	assert.Equal(t, "state", back.Query().Get("state"))
+	return back.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	idp := oidctest.NewServer("fakecast", "secret")
+	defer idp.Close()
+	idp.Claims["preferred_username"] = "alice"
+	idp.Claims["groups"] = []string{"admins", "staff"}
+
+	p := NewProvider(idp.URL+"/", "fakecast", "secret", "http://localhost/api/oidc/callback", nil)
+
+	code := login(t, p, "nonce", "verifier")
+	claims, err := p.Exchange(context.Background(), code, "verifier", "nonce")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", claims.String("preferred_username"))
+	assert.Equal(t, []string{"admins", "staff"}, claims.Strings("groups"))
+
+	// code is used once
+	_, err = p.Exchange(context.Background(), code, "verifier", "nonce")
+	assert.NotNil(t, err)
+
+	code = login(t, p, "nonce", "verifier")
+	_, err = p.Exchange(context.Background(), code, "other verifier", "nonce")
+	assert.NotNil(t, err)
+
+	code = login(t, p, "nonce", "verifier")
+	_, err = p.Exchange(context.Background(), code, "verifier", "other nonce")
+	assert.Equal(t, ErrNonce, err)
+
+	wrong := NewProvider(idp.URL, "fakecast", "wrong", "http://localhost/api/oidc/callback", nil)
+	code = login(t, wrong, "nonce", "verifier")
+	_, err = wrong.Exchange(context.Background(), code, "verifier", "nonce")
+	assert.NotNil(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	idp := oidctest.NewServer("fakecast", "")
+	defer idp.Close()
+
+	p := NewProvider(idp.URL, "fakecast", "", "", nil)
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   idp.URL,
+			"aud":   []string{"other", "fakecast"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "n",
+			"sub":   "1",
+		}
+	}
+	with := func(k string, v interface{}) map[string]interface{} {
+		c := valid()
+		c[k] = v
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", idp.Sign(valid()), nil},
+		{"issuer", idp.Sign(with("iss", "https://evil.example.com")), ErrToken},
+		{"audience", idp.Sign(with("aud", "other")), ErrToken},
+		{"expired", idp.Sign(with("exp", time.Now().Add(-time.Hour).Unix())), ErrToken},
+		{"nonce", idp.Sign(with("nonce", "other")), ErrNonce},
+		{"tampered", strings.Replace(idp.Sign(valid()), ".", ".e30", 1), ErrToken},
+		{"unsigned", "eyJhbGciOiJub25lIn0.e30.", ErrToken},
+		{"garbage", "token", ErrToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := p.Verify(context.Background(), tt.token, "n")
+			assert.Equal(t, tt.err, err)
+			if err == nil {
+				assert.Equal(t, "1", claims.String("sub"))
+			}
+		})
+	}
+}
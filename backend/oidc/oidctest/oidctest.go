@@ -0,0 +1,184 @@
+// Package oidctest is a mock OpenID Connect provider for tests
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Kid of signing key
+const Kid = "test"
+
+// Server of provider. Login is granted at once with Claims, authorization
+// endpoint redirects straight back with code
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+	Key          *rsa.PrivateKey
+	Claims       map[string]interface{}
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+type grant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+// NewServer of provider for client
+func NewServer(clientID, clientSecret string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		Claims:       map[string]interface{}{},
+		codes:        map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Sign claims as ID token with key of server
+func (s *Server) Sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": Kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = grant{
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		redirectURI: q.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+
+	back, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	bq := back.Query()
+	bq.Set("code", code)
+	bq.Set("state", q.Get("state"))
+	back.RawQuery = bq.Encode()
+
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	id, secret, _ := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != s.ClientID || secret != s.ClientSecret {
+		fail("invalid_client")
+		return
+	}
+
+	s.mu.Lock()
+	g, ok := s.codes[r.FormValue("code")]
+	delete(s.codes, r.FormValue("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	switch {
+	case !ok, r.FormValue("grant_type") != "authorization_code", r.FormValue("redirect_uri") != g.redirectURI:
+		fail("invalid_grant")
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		fail("invalid_grant")
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   s.URL,
+		"aud":   s.ClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": g.nonce,
+	}
+	for k, v := range s.Claims {
+		claims[k] = v
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     s.Sign(claims),
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": Kid,
+			"n":   base64.RawURLEncoding.EncodeToString(s.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.Key.E)).Bytes()),
+		}},
+	})
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
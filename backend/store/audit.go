@@ -0,0 +1,166 @@
+package store
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// AuditRecord of change made by user
+type AuditRecord struct {
+	ID        int64  `json:"id"`
+	Time      int64  `json:"time"`
+	Actor     int64  `json:"actor"`
+	ActorName string `json:"actor_name"`
+	Action    string `json:"action"`
+	// Target is kind and id of changed entity, like podcast:12
+	Target  string `json:"target"`
+	Channel int64  `json:"channel,omitempty"`
+	// Changes are before and after values by field
+	Changes json.RawMessage `json:"changes,omitempty"`
+	IP      string          `json:"ip"`
+}
+
+// AuditFilter for records, empty fields match anything
+type AuditFilter struct {
+	Actor   string
+	Action  string
+	Target  string
+	Channel int64
+	Since   int64
+	Until   int64
+	// Before is id of record, so records older than it are returned
+	Before int64
+	Limit  int
+}
+
+const auditColumns = "id, time, actor, actor_name, action, target, channel, changes, ip"
+
+func scanAuditRecord(row scanner) (*AuditRecord, error) {
+	var (
+		rec     AuditRecord
+		changes string
+	)
+	if err := row.Scan(&rec.ID, &rec.Time, &rec.Actor, &rec.ActorName, &rec.Action, &rec.Target, &rec.Channel, &changes, &rec.IP); err != nil {
+		return nil, err
+	}
+	if changes != "" {
+		rec.Changes = json.RawMessage(changes)
+	}
+	return &rec, nil
+}
+
+//
+// Add
+//
+
+// AddAuditRecord made now
+func (s *Store) AddAuditRecord(rec *AuditRecord) error {
+	defer s.observe("AddAuditRecord", time.Now())
+
+	rec.Time = time.Now().Unix()
+
+	result, err := s.db.Exec("INSERT INTO audit (time, actor, actor_name, action, target, channel, changes, ip) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		rec.Time, rec.Actor, rec.ActorName, rec.Action, rec.Target, rec.Channel, string(rec.Changes), rec.IP)
+	if err != nil {
+		return &Error{Op: "AddAuditRecord", Err: err}
+	}
+
+	rec.ID, err = result.LastInsertId()
+	if err != nil {
+		return &Error{Op: "AddAuditRecord", Err: err}
+	}
+
+	return nil
+}
+
+//
+// List
+//
+
+// AuditRecords matching filter, from the latest
+func (s *Store) AuditRecords(f AuditFilter) ([]AuditRecord, error) {
+	defer s.observe("AuditRecords", time.Now())
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	add := func(cond string, arg interface{}) {
+		where = append(where, cond)
+		args = append(args, arg)
+	}
+
+	if f.Actor != "" {
+		add("actor_name=?", f.Actor)
+	}
+	if f.Action != "" {
+		add("action=?", f.Action)
+	}
+	if f.Target != "" {
+		add("target=?", f.Target)
+	}
+	if f.Channel != 0 {
+		add("channel=?", f.Channel)
+	}
+	if f.Since != 0 {
+		add("time>=?", f.Since)
+	}
+	if f.Until != 0 {
+		add("time<?", f.Until)
+	}
+	if f.Before != 0 {
+		add("id<?", f.Before)
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, &Error{Op: "AuditRecords", Err: err}
+	}
+	defer rows.Close()
+
+	recs := []AuditRecord{}
+	for rows.Next() {
+		rec, err := scanAuditRecord(rows)
+		if err != nil {
+			return nil, &Error{Op: "AuditRecords", Err: err}
+		}
+		recs = append(recs, *rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "AuditRecords", Err: err}
+	}
+
+	return recs, nil
+}
+
+//
+// Delete
+//
+
+// PurgeAudit records made before t, returns number of deleted ones
+func (s *Store) PurgeAudit(t time.Time) (int64, error) {
+	defer s.observe("PurgeAudit", time.Now())
+
+	result, err := s.db.Exec("DELETE FROM audit WHERE time<?", t.Unix())
+	if err != nil {
+		return 0, &Error{Op: "PurgeAudit", Err: err}
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, &Error{Op: "PurgeAudit", Err: err}
+	}
+	return n, nil
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	recs := []*AuditRecord{
+		{Actor: 1, ActorName: "alice", Action: "channel.create", Target: "channel:1", Channel: 1, IP: "10.0.0.1"},
+		{Actor: 2, ActorName: "bob", Action: "podcast.update", Target: "podcast:3", Channel: 1, Changes: json.RawMessage(`{"title":{"before":"a","after":"b"}}`)},
+		{Actor: 1, ActorName: "alice", Action: "channel.create", Target: "channel:2", Channel: 2},
+	}
+	for _, rec := range recs {
+		err = store.AddAuditRecord(rec)
+		assert.Nil(err)
+		assert.NotZero(rec.ID)
+		assert.NotZero(rec.Time)
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []int64
+	}{
+		{"all", AuditFilter{}, []int64{recs[2].ID, recs[1].ID, recs[0].ID}},
+		{"actor", AuditFilter{Actor: "alice"}, []int64{recs[2].ID, recs[0].ID}},
+		{"action", AuditFilter{Action: "podcast.update"}, []int64{recs[1].ID}},
+		{"target", AuditFilter{Target: "channel:2"}, []int64{recs[2].ID}},
+		{"channel", AuditFilter{Channel: 1}, []int64{recs[1].ID, recs[0].ID}},
+		{"limit", AuditFilter{Limit: 1}, []int64{recs[2].ID}},
+		{"before", AuditFilter{Before: recs[1].ID}, []int64{recs[0].ID}},
+		{"until", AuditFilter{Until: recs[0].Time}, []int64{}},
+		{"since", AuditFilter{Since: recs[0].Time + 60}, []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.AuditRecords(tt.filter)
+			assert.Nil(err)
+			ids := []int64{}
+			for _, rec := range got {
+				ids = append(ids, rec.ID)
+			}
+			assert.Equal(tt.want, ids)
+		})
+	}
+
+	got, err := store.AuditRecords(AuditFilter{Action: "podcast.update"})
+	assert.Nil(err)
+	assert.Equal(*recs[1], got[0])
+
+	n, err := store.PurgeAudit(time.Now().Add(-time.Hour))
+	assert.Nil(err)
+	assert.Zero(n)
+
+	n, err = store.PurgeAudit(time.Now().Add(time.Hour))
+	assert.Nil(err)
+	assert.Equal(int64(3), n)
+}
@@ -1,19 +1,23 @@
 package store
 
+import "time"
+
 //
 // Add
 //
 
 // AddChannel action
 func (s *Store) AddChannel() (int64, error) {
-	result, err := s.db.Exec("INSERT INTO channels (title) VALUES ('')")
+	defer s.observe("AddChannel", time.Now())
+
+	result, err := s.db.Exec("INSERT INTO channels (title, last_modified) VALUES ('', ?)", time.Now().Unix())
 	if err != nil {
-		return 0, &Error{Err: err}
+		return 0, &Error{Op: "AddChannel", Err: err}
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return 0, &Error{Err: err}
+		return 0, &Error{Op: "AddChannel", Err: err}
 	}
 
 	return id, nil
@@ -25,9 +29,11 @@ func (s *Store) AddChannel() (int64, error) {
 
 // ListChannels action
 func (s *Store) ListChannels() ([]Channel, error) {
-	rows, err := s.db.Query("SELECT id, alias,title FROM channels")
+	defer s.observe("ListChannels", time.Now())
+
+	rows, err := s.db.Query("SELECT id, alias,title FROM channels WHERE deleted=0")
 	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: "ListChannels", Err: err}
 	}
 	defer rows.Close()
 
@@ -43,7 +49,7 @@ func (s *Store) ListChannels() ([]Channel, error) {
 
 	err = rows.Err()
 	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: "ListChannels", Err: err}
 	}
 
 	return cs, nil
@@ -55,12 +61,14 @@ func (s *Store) ListChannels() ([]Channel, error) {
 
 // ChannelInfo action
 func (s *Store) ChannelInfo(cid int64) (*Channel, error) {
-	row := s.db.QueryRow("SELECT id, alias, title, description, image, author FROM channels WHERE id=?", cid)
+	defer s.observe("ChannelInfo", time.Now())
+
+	row := s.db.QueryRow("SELECT id, alias, title, description, image, author, last_modified FROM channels WHERE id=? AND deleted=0", cid)
 	var c Channel
 
-	err := row.Scan(&c.ID, &c.Alias, &c.Title, &c.Description, &c.Cover, &c.Author)
+	err := row.Scan(&c.ID, &c.Alias, &c.Title, &c.Description, &c.Cover, &c.Author, &c.LastModified)
 	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: "ChannelInfo", Err: err}
 	}
 
 	return &c, nil
@@ -72,11 +80,17 @@ func (s *Store) ChannelInfo(cid int64) (*Channel, error) {
 
 // UpdateChannel action
 func (s *Store) UpdateChannel(c *Channel) error {
-	_, err := s.db.Exec("UPDATE channels SET alias=?, title=?, description=?, image=?, author=? WHERE id=?", c.Alias, c.Title, c.Description, c.Cover, c.Author, c.ID)
+	defer s.observe("UpdateChannel", time.Now())
+
+	c.LastModified = time.Now().Unix()
+
+	_, err := s.db.Exec("UPDATE channels SET alias=?, title=?, description=?, image=?, author=?, last_modified=? WHERE id=?", c.Alias, c.Title, c.Description, c.Cover, c.Author, c.LastModified, c.ID)
 	if err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "UpdateChannel", Err: err}
 	}
 
+	s.changed(c.ID)
+
 	return nil
 }
 
@@ -86,17 +100,22 @@ func (s *Store) UpdateChannel(c *Channel) error {
 
 // DeleteChannel action
 func (s *Store) DeleteChannel(channel int64) error {
-	tx, _ := s.db.Begin()
-	_, err := s.db.Exec("DELETE FROM channels WHERE id=?", channel)
-	if err != nil {
-		return &Error{Err: err}
-	}
+	defer s.observe("DeleteChannel", time.Now())
 
-	_, err = s.db.Exec("DELETE FROM podcasts WHERE channel=?", channel)
+	err := s.WithTx(func(tx *Store) error {
+		// podcasts go along by foreign key
+		if _, err := tx.db.Exec("DELETE FROM channels WHERE id=?", channel); err != nil {
+			return err
+		}
+
+		_, err := tx.db.Exec("DELETE FROM members WHERE channel=?", channel)
+		return err
+	})
 	if err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "DeleteChannel", Err: err}
 	}
-	tx.Commit()
+
+	s.changed(channel)
 
 	return nil
 }
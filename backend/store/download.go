@@ -0,0 +1,159 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Download of an episode file
+type Download struct {
+	ID         int64  `json:"id"`
+	Time       int64  `json:"time"`
+	Channel    int64  `json:"channel"`
+	Podcast    int64  `json:"podcast"`
+	IPHash     string `json:"-"`
+	UserAgent  string `json:"user_agent"`
+	RangeStart int64  `json:"range_start"`
+	RangeEnd   int64  `json:"range_end"`
+	Bytes      int64  `json:"bytes"`
+	Counted    bool   `json:"counted"`
+}
+
+// DailyDownloads of an episode
+type DailyDownloads struct {
+	Date      string `json:"date"`
+	Podcast   int64  `json:"podcast"`
+	Title     string `json:"title"`
+	Downloads int64  `json:"downloads"`
+}
+
+// AgentCount of downloads or feed polls made by a user agent
+type AgentCount struct {
+	UserAgent string
+	Count     int64
+}
+
+//
+// Add
+//
+
+// RecordDownload stores download and counts it once per listener (IP and
+// user agent) within window, when listener got at least minBytes of the episode
+// in total. Result tells whether the download was counted
+func (s *Store) RecordDownload(d *Download, window time.Duration, countable bool, minBytes int64) (bool, error) {
+	defer s.observe("RecordDownload", time.Now())
+
+	err := s.WithTx(func(tx *Store) error {
+		result, err := tx.db.Exec("INSERT INTO downloads (time, channel, podcast, ip_hash, user_agent, range_start, range_end, bytes) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			d.Time, d.Channel, d.Podcast, d.IPHash, d.UserAgent, d.RangeStart, d.RangeEnd, d.Bytes)
+		if err != nil {
+			return err
+		}
+
+		d.ID, err = result.LastInsertId()
+		if err != nil || !countable {
+			return err
+		}
+
+		since := d.Time - int64(window.Seconds())
+
+		var (
+			total   int64
+			counted int64
+		)
+		row := tx.db.QueryRow("SELECT COALESCE(SUM(bytes), 0), COALESCE(MAX(counted), 0) FROM downloads WHERE podcast=? AND ip_hash=? AND user_agent=? AND time>?",
+			d.Podcast, d.IPHash, d.UserAgent, since)
+		if err := row.Scan(&total, &counted); err != nil {
+			return err
+		}
+
+		if counted == 0 && total >= minBytes {
+			if _, err := tx.db.Exec("UPDATE downloads SET counted=1 WHERE id=?", d.ID); err != nil {
+				return err
+			}
+			d.Counted = true
+		}
+		return nil
+	})
+	if err != nil {
+		d.Counted = false
+		return false, &Error{Op: "RecordDownload", Err: err}
+	}
+
+	return d.Counted, nil
+}
+
+//
+// Stats
+//
+
+// DailyDownloadsOf channel between from and to unix times
+func (s *Store) DailyDownloadsOf(cid, from, to int64) ([]DailyDownloads, error) {
+	defer s.observe("DailyDownloadsOf", time.Now())
+
+	rows, err := s.db.Query(`
+		SELECT date(d.time, 'unixepoch') AS day, d.podcast, COALESCE(p.title, ''), count(*)
+		FROM downloads d LEFT JOIN podcasts p ON p.id = d.podcast
+		WHERE d.channel=? AND d.counted=1 AND d.time>=? AND d.time<?
+		GROUP BY day, d.podcast
+		ORDER BY day, d.podcast`, cid, from, to)
+	if err != nil {
+		return nil, &Error{Op: "DailyDownloadsOf", Err: err}
+	}
+	defer rows.Close()
+
+	var (
+		ds []DailyDownloads
+		d  DailyDownloads
+	)
+
+	for rows.Next() {
+		if err := rows.Scan(&d.Date, &d.Podcast, &d.Title, &d.Downloads); err != nil {
+			return nil, &Error{Op: "DailyDownloadsOf", Err: err}
+		}
+		ds = append(ds, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "DailyDownloadsOf", Err: err}
+	}
+
+	return ds, nil
+}
+
+// AgentDownloadsOf channel between from and to unix times
+func (s *Store) AgentDownloadsOf(cid, from, to int64) ([]AgentCount, error) {
+	defer s.observe("AgentDownloadsOf", time.Now())
+
+	rows, err := s.db.Query(`
+		SELECT user_agent, count(*) FROM downloads
+		WHERE channel=? AND counted=1 AND time>=? AND time<?
+		GROUP BY user_agent`, cid, from, to)
+	if err != nil {
+		return nil, &Error{Op: "AgentDownloadsOf", Err: err}
+	}
+
+	return scanAgentCounts("AgentDownloadsOf", rows)
+}
+
+func scanAgentCounts(op string, rows *sql.Rows) ([]AgentCount, error) {
+	defer rows.Close()
+
+	var (
+		as []AgentCount
+		a  AgentCount
+	)
+
+	for rows.Next() {
+		if err := rows.Scan(&a.UserAgent, &a.Count); err != nil {
+			return nil, &Error{Op: op, Err: err}
+		}
+		as = append(as, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: op, Err: err}
+	}
+
+	return as, nil
+}
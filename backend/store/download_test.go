@@ -0,0 +1,71 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordDownload(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cid, err := store.AddChannel()
+	assert.Nil(err)
+
+	p, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", 10000)
+	assert.Nil(err)
+
+	day := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC).Unix()
+	download := func(at int64, ip string, bytes int64, countable bool) bool {
+		d := &Download{
+			Time:      at,
+			Channel:   cid,
+			Podcast:   p.ID,
+			IPHash:    ip,
+			UserAgent: "app",
+			Bytes:     bytes,
+		}
+		counted, err := store.RecordDownload(d, 24*time.Hour, countable, 1000)
+		assert.Nil(err)
+		return counted
+	}
+
+	// ranges add up to the threshold
+	assert.False(download(day, "a", 2, true))
+	assert.True(download(day+10, "a", 1000, true))
+	// repeated within window
+	assert.False(download(day+3600, "a", 10000, true))
+	// another listener
+	assert.True(download(day+3600, "b", 10000, true))
+	// bot
+	assert.False(download(day+3600, "c", 10000, false))
+	// next day
+	assert.True(download(day+25*3600, "a", 10000, true))
+
+	ds, err := store.DailyDownloadsOf(cid, day-3600, day+48*3600)
+	assert.Nil(err)
+	assert.Equal([]DailyDownloads{
+		{Date: "2020-07-01", Podcast: p.ID, Title: "podcast1", Downloads: 2},
+		{Date: "2020-07-02", Podcast: p.ID, Title: "podcast1", Downloads: 1},
+	}, ds)
+
+	as, err := store.AgentDownloadsOf(cid, day-3600, day+3600*2)
+	assert.Nil(err)
+	assert.Equal([]AgentCount{{UserAgent: "app", Count: 2}}, as)
+}
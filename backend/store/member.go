@@ -0,0 +1,119 @@
+package store
+
+import "time"
+
+// Member of channel with role on it
+type Member struct {
+	User    int64  `json:"user"`
+	Name    string `json:"name"`
+	Channel int64  `json:"channel"`
+	Role    string `json:"role"`
+}
+
+//
+// Add
+//
+
+// SetMember of channel, role of existing member is replaced
+func (s *Store) SetMember(cid, uid int64, role string) error {
+	defer s.observe("SetMember", time.Now())
+
+	_, err := s.db.Exec("INSERT INTO members (channel, user, role) VALUES (?, ?, ?) ON CONFLICT(channel, user) DO UPDATE SET role=excluded.role", cid, uid, role)
+	if err != nil {
+		return &Error{Op: "SetMember", Err: err}
+	}
+	return nil
+}
+
+//
+// List
+//
+
+// MembersOf channel by name
+func (s *Store) MembersOf(cid int64) ([]Member, error) {
+	defer s.observe("MembersOf", time.Now())
+
+	rows, err := s.db.Query(`
+		SELECT m.user, u.name, m.channel, m.role FROM members m
+		JOIN users u ON u.id=m.user
+		WHERE m.channel=?
+		ORDER BY u.name`, cid)
+	if err != nil {
+		return nil, &Error{Op: "MembersOf", Err: err}
+	}
+	defer rows.Close()
+
+	ms := []Member{}
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.User, &m.Name, &m.Channel, &m.Role); err != nil {
+			return nil, &Error{Op: "MembersOf", Err: err}
+		}
+		ms = append(ms, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "MembersOf", Err: err}
+	}
+
+	return ms, nil
+}
+
+// RolesOf user in channels by channel id
+func (s *Store) RolesOf(uid int64) (map[int64]string, error) {
+	defer s.observe("RolesOf", time.Now())
+
+	rows, err := s.db.Query("SELECT channel, role FROM members WHERE user=?", uid)
+	if err != nil {
+		return nil, &Error{Op: "RolesOf", Err: err}
+	}
+	defer rows.Close()
+
+	roles := map[int64]string{}
+	for rows.Next() {
+		var (
+			cid  int64
+			role string
+		)
+		if err := rows.Scan(&cid, &role); err != nil {
+			return nil, &Error{Op: "RolesOf", Err: err}
+		}
+		roles[cid] = role
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "RolesOf", Err: err}
+	}
+
+	return roles, nil
+}
+
+//
+// Info
+//
+
+// RoleIn channel of user, sql.ErrNoRows if user is not a member
+func (s *Store) RoleIn(cid, uid int64) (string, error) {
+	defer s.observe("RoleIn", time.Now())
+
+	var role string
+	if err := s.db.QueryRow("SELECT role FROM members WHERE channel=? AND user=?", cid, uid).Scan(&role); err != nil {
+		return "", &Error{Op: "RoleIn", Err: err}
+	}
+	return role, nil
+}
+
+//
+// Delete
+//
+
+// DeleteMember of channel
+func (s *Store) DeleteMember(cid, uid int64) error {
+	defer s.observe("DeleteMember", time.Now())
+
+	_, err := s.db.Exec("DELETE FROM members WHERE channel=? AND user=?", cid, uid)
+	if err != nil {
+		return &Error{Op: "DeleteMember", Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembers(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	news, err := store.AddChannel()
+	assert.Nil(err)
+	err = store.UpdateChannel(&Channel{ID: news, Alias: "news"})
+	assert.Nil(err)
+	sport, err := store.AddChannel()
+	assert.Nil(err)
+
+	alice := &User{Name: "alice", Role: "viewer"}
+	err = store.AddUser(alice)
+	assert.Nil(err)
+	bob := &User{Name: "bob", Role: "viewer"}
+	err = store.AddUser(bob)
+	assert.Nil(err)
+
+	err = store.SetMember(news, bob.ID, "viewer")
+	assert.Nil(err)
+	err = store.SetMember(news, alice.ID, "uploader")
+	assert.Nil(err)
+	err = store.SetMember(sport, alice.ID, "viewer")
+	assert.Nil(err)
+
+	// role is replaced
+	err = store.SetMember(news, bob.ID, "editor")
+	assert.Nil(err)
+
+	ms, err := store.MembersOf(news)
+	assert.Nil(err)
+	assert.Equal([]Member{
+		{User: alice.ID, Name: "alice", Channel: news, Role: "uploader"},
+		{User: bob.ID, Name: "bob", Channel: news, Role: "editor"},
+	}, ms)
+
+	roles, err := store.RolesOf(alice.ID)
+	assert.Nil(err)
+	assert.Equal(map[int64]string{news: "uploader", sport: "viewer"}, roles)
+
+	role, err := store.RoleIn(news, bob.ID)
+	assert.Nil(err)
+	assert.Equal("editor", role)
+
+	_, err = store.RoleIn(sport, bob.ID)
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	err = store.DeleteMember(news, bob.ID)
+	assert.Nil(err)
+	_, err = store.RoleIn(news, bob.ID)
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	// members go away with their channel or user
+	err = store.DeleteChannel(sport)
+	assert.Nil(err)
+	err = store.DeleteUser(alice.ID)
+	assert.Nil(err)
+
+	roles, err = store.RolesOf(alice.ID)
+	assert.Nil(err)
+	assert.Empty(roles)
+
+	ms, err = store.MembersOf(news)
+	assert.Nil(err)
+	assert.Empty(ms)
+}
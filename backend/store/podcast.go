@@ -1,7 +1,8 @@
 package store
 
 import (
-	"strconv"
+	"database/sql"
+	"time"
 )
 
 const (
@@ -14,20 +15,24 @@ const (
 //
 
 // AddPodcastToChannel action
-func (s *Store) AddPodcastToChannel(cid int64, filename, title, size string) (*Podcast, error) {
-	length, err := strconv.Atoi(size)
+func (s *Store) AddPodcastToChannel(cid int64, filename, title string, length int64) (*Podcast, error) {
+	defer s.observe("AddPodcastToChannel", time.Now())
+
+	var id int64
+	err := s.WithTx(func(tx *Store) error {
+		result, err := tx.db.Exec("INSERT INTO podcasts (channel, filename, title, length) VALUES (?, ?, ?, ?)", cid, filename, title, length)
+		if err != nil {
+			return err
+		}
+
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		return tx.touch(cid)
+	})
 	if err != nil {
-		return nil, &Error{Err: err}
-	}
-
-	result, err := s.db.Exec("INSERT INTO podcasts (channel, filename, title, length) VALUES (?, ?, ?, ?)", cid, filename, title, length)
-	if err != nil {
-		return nil, &Error{Err: err}
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: "AddPodcastToChannel", Err: err}
 	}
 
 	p := Podcast{
@@ -44,12 +49,29 @@ func (s *Store) AddPodcastToChannel(cid int64, filename, title, size string) (*P
 
 // PodcastInfo action
 func (s *Store) PodcastInfo(pid int64) (*Podcast, error) {
-	row := s.db.QueryRow("SELECT id, filename, published, title, length, guid, pub_date, description, duration, image, explicit, season, episode FROM podcasts WHERE id=?", pid)
+	defer s.observe("PodcastInfo", time.Now())
+
+	row := s.db.QueryRow("SELECT id, filename, published, title, length, guid, pub_date, description, duration, image, explicit, season, episode FROM podcasts WHERE id=? AND deleted=0", pid)
 	var p Podcast
 
 	err := row.Scan(&p.ID, &p.Filename, &p.Published, &p.Title, &p.Length, &p.GUID, &p.PubDate, &p.Description, &p.Duration, &p.Artwork, &p.Explicit, &p.Season, &p.Episode)
 	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: "PodcastInfo", Err: err}
+	}
+
+	return &p, nil
+}
+
+// PodcastByFilename finds podcast of channel by its file
+func (s *Store) PodcastByFilename(cid int64, filename string) (*Podcast, error) {
+	defer s.observe("PodcastByFilename", time.Now())
+
+	row := s.db.QueryRow("SELECT id, filename, published, title, length, guid, pub_date, description, duration, image, explicit, season, episode FROM podcasts WHERE channel=? AND filename=? AND deleted=0", cid, filename)
+
+	var p Podcast
+	err := row.Scan(&p.ID, &p.Filename, &p.Published, &p.Title, &p.Length, &p.GUID, &p.PubDate, &p.Description, &p.Duration, &p.Artwork, &p.Explicit, &p.Season, &p.Episode)
+	if err != nil {
+		return nil, &Error{Op: "PodcastByFilename", Err: err}
 	}
 
 	return &p, nil
@@ -61,16 +83,27 @@ func (s *Store) PodcastInfo(pid int64) (*Podcast, error) {
 
 // ListPodcastsFrom action
 func (s *Store) ListPodcastsFrom(cid int64) ([]Podcast, error) {
-	return s.listPodcasts(cid, shortForm)
+	defer s.observe("ListPodcastsFrom", time.Now())
+
+	return s.listPodcasts(cid, shortForm, 0, 0)
 }
 
 // ListFullPodcastsFrom action
 func (s *Store) ListFullPodcastsFrom(cid int64) ([]Podcast, error) {
-	return s.listPodcasts(cid, fullForm)
+	defer s.observe("ListFullPodcastsFrom", time.Now())
+
+	return s.listPodcasts(cid, fullForm, 0, 0)
+}
+
+// ListFullPodcastsPage of channel, newest first. Zero limit means no limit
+func (s *Store) ListFullPodcastsPage(cid int64, limit, offset int) ([]Podcast, error) {
+	defer s.observe("ListFullPodcastsPage", time.Now())
+
+	return s.listPodcasts(cid, fullForm, limit, offset)
 }
 
 // ListPodcastsFrom action
-func (s *Store) listPodcasts(cid int64, form int) ([]Podcast, error) {
+func (s *Store) listPodcasts(cid int64, form, limit, offset int) ([]Podcast, error) {
 	var (
 		sql     string
 		holders []interface{}
@@ -83,16 +116,22 @@ func (s *Store) listPodcasts(cid int64, form int) ([]Podcast, error) {
 
 	switch form {
 	case shortForm:
-		sql = "SELECT id, filename, title FROM podcasts WHERE channel=? ORDER BY id DESC"
+		sql = "SELECT id, filename, title FROM podcasts WHERE channel=? AND deleted=0 ORDER BY id DESC"
 		holders = []interface{}{&p.ID, &p.Filename, &p.Title}
 	case fullForm:
-		sql = "SELECT id, filename, published, title, length, guid, pub_date, description, duration, image, explicit, season, episode FROM podcasts WHERE channel=? ORDER BY id DESC"
+		sql = "SELECT id, filename, published, title, length, guid, pub_date, description, duration, image, explicit, season, episode FROM podcasts WHERE channel=? AND deleted=0 ORDER BY id DESC"
 		holders = []interface{}{&p.ID, &p.Filename, &p.Published, &p.Title, &p.Length, &p.GUID, &p.PubDate, &p.Description, &p.Duration, &p.Artwork, &p.Explicit, &p.Season, &p.Episode}
 	}
 
-	rows, err := s.db.Query(sql, cid)
+	// negative limit is no limit for SQLite
+	if limit <= 0 {
+		limit = -1
+	}
+	sql += " LIMIT ? OFFSET ?"
+
+	rows, err := s.db.Query(sql, cid, limit, offset)
 	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: "ListPodcasts", Err: err}
 	}
 	defer rows.Close()
 
@@ -103,7 +142,7 @@ func (s *Store) listPodcasts(cid int64, form int) ([]Podcast, error) {
 
 	err = rows.Err()
 	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: "ListPodcasts", Err: err}
 	}
 
 	return podcasts, nil
@@ -115,9 +154,23 @@ func (s *Store) listPodcasts(cid int64, form int) ([]Podcast, error) {
 
 // UpdatePodcast action
 func (s *Store) UpdatePodcast(p *Podcast) error {
-	_, err := s.db.Exec("UPDATE podcasts SET published=?, title=?, length=?, guid=?, pub_date=?, description=?, duration=?, image=?, explicit=?, season=?, episode=? WHERE id=?", p.Published, p.Title, p.Length, p.GUID, p.PubDate, p.Description, p.Duration, p.Artwork, p.Explicit, p.Season, p.Episode, p.ID)
+	defer s.observe("UpdatePodcast", time.Now())
+
+	err := s.WithTx(func(tx *Store) error {
+		_, err := tx.db.Exec("UPDATE podcasts SET published=?, title=?, length=?, guid=?, pub_date=?, description=?, duration=?, image=?, explicit=?, season=?, episode=? WHERE id=?", p.Published, p.Title, p.Length, p.GUID, p.PubDate, p.Description, p.Duration, p.Artwork, p.Explicit, p.Season, p.Episode, p.ID)
+		if err != nil {
+			return err
+		}
+
+		cid, err := tx.channelOf(p.ID)
+		if err != nil || cid == 0 {
+			return err
+		}
+
+		return tx.touch(cid)
+	})
 	if err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "UpdatePodcast", Err: err}
 	}
 
 	return nil
@@ -129,10 +182,44 @@ func (s *Store) UpdatePodcast(p *Podcast) error {
 
 // DeletePodcast action
 func (s *Store) DeletePodcast(pid int64) error {
-	_, err := s.db.Exec("DELETE FROM podcasts WHERE id=?", pid)
+	defer s.observe("DeletePodcast", time.Now())
+
+	err := s.WithTx(func(tx *Store) error {
+		// channel is unknown once podcast is gone
+		cid, err := tx.channelOf(pid)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.db.Exec("DELETE FROM podcasts WHERE id=?", pid); err != nil || cid == 0 {
+			return err
+		}
+
+		return tx.touch(cid)
+	})
 	if err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "DeletePodcast", Err: err}
 	}
 
 	return nil
 }
+
+// ChannelOf podcast, 0 if there is no such podcast
+func (s *Store) ChannelOf(pid int64) (int64, error) {
+	defer s.observe("ChannelOf", time.Now())
+
+	cid, err := s.channelOf(pid)
+	if err != nil {
+		return 0, &Error{Op: "ChannelOf", Err: err}
+	}
+	return cid, nil
+}
+
+func (s *Store) channelOf(pid int64) (int64, error) {
+	var cid int64
+	err := s.db.QueryRow("SELECT channel FROM podcasts WHERE id=? AND deleted=0", pid).Scan(&cid)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return cid, err
+}
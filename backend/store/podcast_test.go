@@ -48,7 +48,7 @@ func TestAddPodcastToChannel(t *testing.T) {
 				assert.Nil(err)
 			}
 
-			podcast, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", "10001")
+			podcast, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", 10001)
 			if tt.wantErr {
 				assert.NotNil(err)
 				return
@@ -101,7 +101,7 @@ func TestUpdatingPodcast(t *testing.T) {
 			assert.Nil(err)
 			assert.Equal(int64(1), cid)
 
-			np, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", "10001")
+			np, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", 10001)
 			assert.Nil(err)
 			assert.Equal(int64(1), np.ID)
 
@@ -175,7 +175,7 @@ func TestListPodcasts(t *testing.T) {
 			assert.Equal(int64(1), cid)
 
 			for i := 1; i < 4; i++ {
-				p, err := store.AddPodcastToChannel(cid, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), fmt.Sprintf("1000%d", i))
+				p, err := store.AddPodcastToChannel(cid, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), int64(10000+i))
 				assert.Nil(err)
 				assert.Equal(int64(i), p.ID)
 			}
@@ -193,6 +193,21 @@ func TestListPodcasts(t *testing.T) {
 
 			assert.Nil(err)
 			assert.Equal(3, len(ps))
+
+			ps, err = store.ListFullPodcastsPage(cid, 2, 0)
+			assert.Nil(err)
+			assert.Equal(2, len(ps))
+			assert.Equal(int64(3), ps[0].ID)
+			assert.Equal(int64(10003), int64(ps[0].Length))
+
+			ps, err = store.ListFullPodcastsPage(cid, 2, 2)
+			assert.Nil(err)
+			assert.Equal(1, len(ps))
+			assert.Equal(int64(1), ps[0].ID)
+
+			ps, err = store.ListFullPodcastsPage(cid, 0, 1)
+			assert.Nil(err)
+			assert.Equal(2, len(ps))
 		})
 	}
 }
@@ -231,11 +246,11 @@ func TestDeletePodcast(t *testing.T) {
 			assert.Nil(err)
 			assert.Equal(int64(1), cid)
 
-			p, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", "10001")
+			p, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", 10001)
 			assert.Nil(err)
 			assert.Equal(int64(1), p.ID)
 
-			p2, err := store.AddPodcastToChannel(cid, "podcast2.mp3", "podcast2", "10002")
+			p2, err := store.AddPodcastToChannel(cid, "podcast2.mp3", "podcast2", 10002)
 			assert.Nil(err)
 			assert.Equal(int64(2), p2.ID)
 
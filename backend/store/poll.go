@@ -0,0 +1,95 @@
+package store
+
+import (
+	"time"
+)
+
+// FeedPoll is a fetch of channel's feed
+type FeedPoll struct {
+	ID        int64  `json:"id"`
+	Time      int64  `json:"time"`
+	Channel   int64  `json:"channel"`
+	IPHash    string `json:"-"`
+	UserAgent string `json:"user_agent"`
+}
+
+// DailyPollers are unique IPs polling feed with a user agent during a day
+type DailyPollers struct {
+	Date      string
+	UserAgent string
+	IPs       int64
+}
+
+//
+// Add
+//
+
+// RecordPoll of feed
+func (s *Store) RecordPoll(p *FeedPoll) error {
+	defer s.observe("RecordPoll", time.Now())
+
+	result, err := s.db.Exec("INSERT INTO feed_polls (time, channel, ip_hash, user_agent) VALUES (?, ?, ?, ?)",
+		p.Time, p.Channel, p.IPHash, p.UserAgent)
+	if err != nil {
+		return &Error{Op: "RecordPoll", Err: err}
+	}
+
+	p.ID, err = result.LastInsertId()
+	if err != nil {
+		return &Error{Op: "RecordPoll", Err: err}
+	}
+
+	return nil
+}
+
+//
+// Stats
+//
+
+// AgentPollsOf channel between from and to unix times
+func (s *Store) AgentPollsOf(cid, from, to int64) ([]AgentCount, error) {
+	defer s.observe("AgentPollsOf", time.Now())
+
+	rows, err := s.db.Query(`
+		SELECT user_agent, count(*) FROM feed_polls
+		WHERE channel=? AND time>=? AND time<?
+		GROUP BY user_agent`, cid, from, to)
+	if err != nil {
+		return nil, &Error{Op: "AgentPollsOf", Err: err}
+	}
+
+	return scanAgentCounts("AgentPollsOf", rows)
+}
+
+// DailyPollersOf channel between from and to unix times
+func (s *Store) DailyPollersOf(cid, from, to int64) ([]DailyPollers, error) {
+	defer s.observe("DailyPollersOf", time.Now())
+
+	rows, err := s.db.Query(`
+		SELECT date(time, 'unixepoch') AS day, user_agent, count(DISTINCT ip_hash) FROM feed_polls
+		WHERE channel=? AND time>=? AND time<?
+		GROUP BY day, user_agent
+		ORDER BY day, user_agent`, cid, from, to)
+	if err != nil {
+		return nil, &Error{Op: "DailyPollersOf", Err: err}
+	}
+	defer rows.Close()
+
+	var (
+		ps []DailyPollers
+		p  DailyPollers
+	)
+
+	for rows.Next() {
+		if err := rows.Scan(&p.Date, &p.UserAgent, &p.IPs); err != nil {
+			return nil, &Error{Op: "DailyPollersOf", Err: err}
+		}
+		ps = append(ps, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "DailyPollersOf", Err: err}
+	}
+
+	return ps, nil
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordPoll(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cid, err := store.AddChannel()
+	assert.Nil(err)
+
+	day := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for i, ua := range []string{"app", "app", "reader", "app"} {
+		p := &FeedPoll{Time: day + int64(i)*3600, Channel: cid, IPHash: "a", UserAgent: ua}
+		err := store.RecordPoll(p)
+		assert.Nil(err)
+		assert.NotZero(p.ID)
+	}
+
+	as, err := store.AgentPollsOf(cid, day, day+3*3600)
+	assert.Nil(err)
+	assert.ElementsMatch([]AgentCount{
+		{UserAgent: "app", Count: 2},
+		{UserAgent: "reader", Count: 1},
+	}, as)
+
+	as, err = store.AgentPollsOf(cid+1, day, day+24*3600)
+	assert.Nil(err)
+	assert.Empty(as)
+
+	// another IP of app on the same day and next day
+	err = store.RecordPoll(&FeedPoll{Time: day + 3600, Channel: cid, IPHash: "b", UserAgent: "app"})
+	assert.Nil(err)
+	err = store.RecordPoll(&FeedPoll{Time: day + 24*3600, Channel: cid, IPHash: "a", UserAgent: "app"})
+	assert.Nil(err)
+
+	ps, err := store.DailyPollersOf(cid, day, day+48*3600)
+	assert.Nil(err)
+	assert.Equal([]DailyPollers{
+		{Date: "2020-07-01", UserAgent: "app", IPs: 2},
+		{Date: "2020-07-01", UserAgent: "reader", IPs: 1},
+		{Date: "2020-07-02", UserAgent: "app", IPs: 1},
+	}, ps)
+}
@@ -0,0 +1,143 @@
+package store
+
+import "time"
+
+// Session of user logged in web UI. Only hash of session id is kept
+type Session struct {
+	ID        int64  `json:"id"`
+	User      int64  `json:"user"`
+	Hash      string `json:"-"`
+	CSRF      string `json:"-"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Created   int64  `json:"created"`
+	Expires   int64  `json:"expires"`
+	LastSeen  int64  `json:"last_seen"`
+	// Current session of request, not stored
+	Current bool `json:"current"`
+}
+
+const sessionColumns = "id, user, hash, csrf, ip, user_agent, created, expires, last_seen"
+
+func scanSession(row scanner) (*Session, error) {
+	var ss Session
+	if err := row.Scan(&ss.ID, &ss.User, &ss.Hash, &ss.CSRF, &ss.IP, &ss.UserAgent, &ss.Created, &ss.Expires, &ss.LastSeen); err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+//
+// Add
+//
+
+// AddSession which lasts for ttl. Expired sessions are dropped meanwhile
+func (s *Store) AddSession(ss *Session, ttl time.Duration) error {
+	defer s.observe("AddSession", time.Now())
+
+	now := time.Now()
+	ss.Created = now.Unix()
+	ss.Expires = now.Add(ttl).Unix()
+	ss.LastSeen = ss.Created
+
+	err := s.WithTx(func(tx *Store) error {
+		if _, err := tx.db.Exec("DELETE FROM sessions WHERE expires<=?", ss.Created); err != nil {
+			return err
+		}
+
+		result, err := tx.db.Exec("INSERT INTO sessions (user, hash, csrf, ip, user_agent, created, expires, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			ss.User, ss.Hash, ss.CSRF, ss.IP, ss.UserAgent, ss.Created, ss.Expires, ss.LastSeen)
+		if err != nil {
+			return err
+		}
+
+		ss.ID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return &Error{Op: "AddSession", Err: err}
+	}
+
+	return nil
+}
+
+//
+// List
+//
+
+// SessionsOf user which are not expired, from the latest
+func (s *Store) SessionsOf(uid int64) ([]Session, error) {
+	defer s.observe("SessionsOf", time.Now())
+
+	rows, err := s.db.Query("SELECT "+sessionColumns+" FROM sessions WHERE user=? AND expires>? ORDER BY last_seen DESC", uid, time.Now().Unix())
+	if err != nil {
+		return nil, &Error{Op: "SessionsOf", Err: err}
+	}
+	defer rows.Close()
+
+	sss := []Session{}
+	for rows.Next() {
+		ss, err := scanSession(rows)
+		if err != nil {
+			return nil, &Error{Op: "SessionsOf", Err: err}
+		}
+		sss = append(sss, *ss)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "SessionsOf", Err: err}
+	}
+
+	return sss, nil
+}
+
+//
+// Info
+//
+
+// SessionByHash of session id, sql.ErrNoRows if there is no such session or
+// it's expired
+func (s *Store) SessionByHash(hash string) (*Session, error) {
+	defer s.observe("SessionByHash", time.Now())
+
+	ss, err := scanSession(s.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE hash=? AND expires>?", hash, time.Now().Unix()))
+	if err != nil {
+		return nil, &Error{Op: "SessionByHash", Err: err}
+	}
+	return ss, nil
+}
+
+//
+// Update
+//
+
+// TouchSession with time of request
+func (s *Store) TouchSession(id int64, at time.Time) error {
+	defer s.observe("TouchSession", time.Now())
+
+	_, err := s.db.Exec("UPDATE sessions SET last_seen=? WHERE id=?", at.Unix(), id)
+	if err != nil {
+		return &Error{Op: "TouchSession", Err: err}
+	}
+	return nil
+}
+
+//
+// Delete
+//
+
+// DeleteSession of user, false if user has no such session
+func (s *Store) DeleteSession(uid, id int64) (bool, error) {
+	defer s.observe("DeleteSession", time.Now())
+
+	result, err := s.db.Exec("DELETE FROM sessions WHERE id=? AND user=?", id, uid)
+	if err != nil {
+		return false, &Error{Op: "DeleteSession", Err: err}
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, &Error{Op: "DeleteSession", Err: err}
+	}
+	return n > 0, nil
+}
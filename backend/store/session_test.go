@@ -0,0 +1,77 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	alice := &User{Name: "alice", Role: "viewer"}
+	err = store.AddUser(alice)
+	assert.Nil(err)
+
+	laptop := &Session{User: alice.ID, Hash: "h1", CSRF: "c1", IP: "10.0.0.1", UserAgent: "Firefox"}
+	err = store.AddSession(laptop, time.Hour)
+	assert.Nil(err)
+	assert.NotZero(laptop.ID)
+	assert.Equal(laptop.Created+3600, laptop.Expires)
+
+	phone := &Session{User: alice.ID, Hash: "h2", CSRF: "c2"}
+	err = store.AddSession(phone, time.Hour)
+	assert.Nil(err)
+
+	// expired one is never found
+	err = store.AddSession(&Session{User: alice.ID, Hash: "h3"}, -time.Second)
+	assert.Nil(err)
+	_, err = store.SessionByHash("h3")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	ss, err := store.SessionByHash("h1")
+	assert.Nil(err)
+	assert.Equal(laptop, ss)
+
+	err = store.TouchSession(laptop.ID, time.Now().Add(time.Minute))
+	assert.Nil(err)
+
+	sss, err := store.SessionsOf(alice.ID)
+	assert.Nil(err)
+	assert.Len(sss, 2)
+	assert.Equal(laptop.ID, sss[0].ID)
+
+	ok, err := store.DeleteSession(alice.ID+1, laptop.ID)
+	assert.Nil(err)
+	assert.False(ok)
+
+	ok, err = store.DeleteSession(alice.ID, laptop.ID)
+	assert.Nil(err)
+	assert.True(ok)
+
+	_, err = store.SessionByHash("h1")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	err = store.DeleteUser(alice.ID)
+	assert.Nil(err)
+	_, err = store.SessionByHash("h2")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+}
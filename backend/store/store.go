@@ -2,16 +2,36 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"path/filepath"
+	"sync"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3" // sqlite
+	"github.com/azzzak/fakecast/metrics"
+	"github.com/mattn/go-sqlite3"
 )
 
 const storeFile = "fakecast.db"
 
-// Store entity
+// Store entity. Queries go to db, which is transaction in WithTx
 type Store struct {
-	db *sql.DB
+	db    querier
+	conn  *sql.DB
+	hooks *hooks
+	// pending changes of transaction, hooks are called after commit
+	pending *[]int64
+}
+
+// querier is database or transaction
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type hooks struct {
+	sync.RWMutex
+	onChange []func(cid int64)
 }
 
 // Channel entity
@@ -23,6 +43,10 @@ type Channel struct {
 	Cover       string `json:"cover"`
 	Author      string `json:"author,omitempty"`
 	Host        string `json:"host"`
+	// Thumbnail is URL of smaller cover for web interface, it's not stored
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// LastModified is unix time of the last change of channel or its episodes
+	LastModified int64 `json:"last_modified"`
 }
 
 // Podcast entity
@@ -42,25 +66,59 @@ type Podcast struct {
 	Episode     int    `json:"episode,omitempty"`
 }
 
+// Kinds of store errors, they are matched with errors.Is
+var (
+	// ErrConflict is violation of unique value or reference
+	ErrConflict = errors.New("conflict")
+	// ErrFull is database or disk which is full
+	ErrFull = errors.New("database or disk is full")
+)
+
 // Error type
 type Error struct {
+	Op  string
 	Err error
 }
 
 func (err *Error) Error() string {
-	return err.Err.Error()
+	if err.Op == "" {
+		return err.Err.Error()
+	}
+	return err.Op + ": " + err.Err.Error()
+}
+
+// Unwrap underlying error
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Is error of kind
+func (err *Error) Is(target error) bool {
+	var se sqlite3.Error
+	if !errors.As(err.Err, &se) {
+		return false
+	}
+
+	switch target {
+	case ErrConflict:
+		return se.Code == sqlite3.ErrConstraint
+	case ErrFull:
+		return se.Code == sqlite3.ErrFull
+	}
+	return false
 }
 
 // NewStore constructor
 func NewStore(root string) (Store, error) {
-	database, err := sql.Open("sqlite3", filepath.Join(root, storeFile))
+	// PRAGMA foreign_keys is set by driver for every connection of pool
+	database, err := sql.Open("sqlite3", filepath.Join(root, storeFile)+"?_foreign_keys=on")
 	if err != nil {
-		return Store{}, &Error{Err: err}
+		return Store{}, &Error{Op: "NewStore", Err: err}
 	}
 
 	tx, err := database.Begin()
 	if err != nil {
-		return Store{}, &Error{Err: err}
+		return Store{}, &Error{Op: "NewStore", Err: err}
 	}
 
 	_, err = tx.Exec(`
@@ -71,46 +129,336 @@ func NewStore(root string) (Store, error) {
 			description TEXT DEFAULT '',
 			image TEXT DEFAULT '',
 			explicit INTEGER DEFAULT 0,
-			author TEXT DEFAULT ''
+			author TEXT DEFAULT '',
+			last_modified INTEGER DEFAULT 0,
+			deleted INTEGER DEFAULT 0
 		)
 		`)
 	if err != nil {
-		return Store{}, &Error{Err: err}
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	if err := addColumn(tx, "channels", "last_modified", "INTEGER DEFAULT 0"); err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	if err := addColumn(tx, "channels", "deleted", "INTEGER DEFAULT 0"); err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec("CREATE TABLE IF NOT EXISTS podcasts " + podcastsSchema)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	if err := addColumn(tx, "podcasts", "deleted", "INTEGER DEFAULT 0"); err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	if err := cascadePodcasts(tx); err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
 	}
 
 	_, err = tx.Exec(`
-		CREATE TABLE IF NOT EXISTS podcasts (
-			id INTEGER PRIMARY KEY, 
-			channel INTEGER, 
-			filename TEXT, 
-			published INTEGER DEFAULT 0,
-			title TEXT, 
-			length INTEGER,
-			guid TEXT DEFAULT '',
-			pub_date TEXT DEFAULT '', 
-			description TEXT DEFAULT '', 
-			duration INTEGER DEFAULT 0,
-			image TEXT DEFAULT '',
-			explicit INTEGER DEFAULT 0,
-			season INTEGER DEFAULT 0, 
-			episode INTEGER DEFAULT 0
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT
+		)
+		`)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS downloads (
+			id INTEGER PRIMARY KEY,
+			time INTEGER,
+			channel INTEGER,
+			podcast INTEGER,
+			ip_hash TEXT,
+			user_agent TEXT DEFAULT '',
+			range_start INTEGER DEFAULT 0,
+			range_end INTEGER DEFAULT -1,
+			bytes INTEGER DEFAULT 0,
+			counted INTEGER DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS downloads_listener ON downloads (podcast, ip_hash, user_agent, time);
+		CREATE INDEX IF NOT EXISTS downloads_channel ON downloads (channel, time);
+		`)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS feed_polls (
+			id INTEGER PRIMARY KEY,
+			time INTEGER,
+			channel INTEGER,
+			ip_hash TEXT,
+			user_agent TEXT DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS feed_polls_channel ON feed_polls (channel, time);
+		`)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY,
+			name TEXT UNIQUE,
+			role TEXT,
+			password_hash TEXT,
+			created INTEGER DEFAULT 0,
+			issuer TEXT DEFAULT '',
+			subject TEXT DEFAULT ''
 		)
 		`)
 	if err != nil {
-		return Store{}, &Error{Err: err}
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	for _, column := range []string{"issuer", "subject"} {
+		if err := addColumn(tx, "users", column, "TEXT DEFAULT ''"); err != nil {
+			return Store{}, &Error{Op: "NewStore", Err: err}
+		}
+	}
+
+	_, err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS users_subject ON users (issuer, subject) WHERE subject != ''")
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS members (
+			channel INTEGER,
+			user INTEGER,
+			role TEXT,
+			PRIMARY KEY (channel, user)
+		);
+		CREATE INDEX IF NOT EXISTS members_user ON members (user);
+		`)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS tokens (
+			id INTEGER PRIMARY KEY,
+			user INTEGER,
+			name TEXT,
+			hash TEXT UNIQUE,
+			scopes TEXT,
+			channel INTEGER DEFAULT 0,
+			expires INTEGER DEFAULT 0,
+			last_used INTEGER DEFAULT 0,
+			created INTEGER DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS tokens_user ON tokens (user);
+		`)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id INTEGER PRIMARY KEY,
+			user INTEGER,
+			hash TEXT UNIQUE,
+			csrf TEXT,
+			ip TEXT,
+			user_agent TEXT,
+			created INTEGER DEFAULT 0,
+			expires INTEGER DEFAULT 0,
+			last_seen INTEGER DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS sessions_user ON sessions (user);
+		`)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS audit (
+			id INTEGER PRIMARY KEY,
+			time INTEGER,
+			actor INTEGER,
+			actor_name TEXT,
+			action TEXT,
+			target TEXT,
+			channel INTEGER DEFAULT 0,
+			changes TEXT DEFAULT '',
+			ip TEXT DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS audit_time ON audit (time);
+		CREATE INDEX IF NOT EXISTS audit_channel ON audit (channel, time);
+		`)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS trash (
+			id INTEGER PRIMARY KEY,
+			kind TEXT,
+			item INTEGER,
+			channel INTEGER,
+			title TEXT DEFAULT '',
+			name TEXT DEFAULT '',
+			deleted INTEGER,
+			actor TEXT DEFAULT ''
+		)
+		`)
+	if err != nil {
+		return Store{}, &Error{Op: "NewStore", Err: err}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return Store{}, &Error{Err: err}
+		return Store{}, &Error{Op: "NewStore", Err: err}
 	}
 
-	return Store{db: database}, nil
+	return Store{db: database, conn: database, hooks: &hooks{}}, nil
+}
+
+// podcastsSchema of table. Podcasts go along with their channel
+const podcastsSchema = `(
+	id INTEGER PRIMARY KEY,
+	channel INTEGER REFERENCES channels (id) ON DELETE CASCADE,
+	filename TEXT,
+	published INTEGER DEFAULT 0,
+	title TEXT,
+	length INTEGER,
+	guid TEXT DEFAULT '',
+	pub_date TEXT DEFAULT '',
+	description TEXT DEFAULT '',
+	duration INTEGER DEFAULT 0,
+	image TEXT DEFAULT '',
+	explicit INTEGER DEFAULT 0,
+	season INTEGER DEFAULT 0,
+	episode INTEGER DEFAULT 0,
+	deleted INTEGER DEFAULT 0
+)`
+
+// cascadePodcasts rebuilds table of podcasts created by older version
+// without foreign key. Podcasts of channels which are gone are dropped
+func cascadePodcasts(tx *sql.Tx) error {
+	var n int
+	if err := tx.QueryRow("SELECT count(*) FROM pragma_foreign_key_list('podcasts')").Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	const columns = "id, channel, filename, published, title, length, guid, pub_date, description, duration, image, explicit, season, episode, deleted"
+
+	_, err := tx.Exec(`
+		CREATE TABLE podcasts_new ` + podcastsSchema + `;
+		INSERT INTO podcasts_new (` + columns + `) SELECT ` + columns + ` FROM podcasts WHERE channel IN (SELECT id FROM channels);
+		DROP TABLE podcasts;
+		ALTER TABLE podcasts_new RENAME TO podcasts;
+		`)
+	return err
+}
+
+// addColumn to table created by older version
+func addColumn(tx *sql.Tx, table, column, decl string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + decl)
+	return err
+}
+
+// WithTx runs fn as unit of work. Store given to fn makes queries in
+// transaction, which is committed if fn succeeds and rolled back otherwise.
+// Nested call joins outer transaction. Hooks of changes are called after
+// commit
+func (s *Store) WithTx(fn func(tx *Store) error) error {
+	if s.pending != nil {
+		return fn(s)
+	}
+
+	sqlTx, err := s.conn.Begin()
+	if err != nil {
+		return &Error{Op: "WithTx", Err: err}
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			sqlTx.Rollback()
+		}
+	}()
+
+	tx := &Store{db: sqlTx, conn: s.conn, hooks: s.hooks, pending: &[]int64{}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return &Error{Op: "WithTx", Err: err}
+	}
+	committed = true
+
+	for _, cid := range *tx.pending {
+		s.changed(cid)
+	}
+
+	return nil
+}
+
+// OnChange registers fn called after channel or its episodes are changed
+func (s *Store) OnChange(fn func(cid int64)) {
+	s.hooks.Lock()
+	defer s.hooks.Unlock()
+
+	s.hooks.onChange = append(s.hooks.onChange, fn)
+}
+
+// touch channel, so it's last modified now
+func (s *Store) touch(cid int64) error {
+	if _, err := s.db.Exec("UPDATE channels SET last_modified=? WHERE id=?", time.Now().Unix(), cid); err != nil {
+		return err
+	}
+	s.changed(cid)
+	return nil
+}
+
+func (s *Store) changed(cid int64) {
+	if s.pending != nil {
+		*s.pending = append(*s.pending, cid)
+		return
+	}
+
+	s.hooks.RLock()
+	defer s.hooks.RUnlock()
+
+	for _, fn := range s.hooks.onChange {
+		fn(cid)
+	}
 }
 
 // SwapCIDForAlias exchange CID for alias
 func (s *Store) SwapCIDForAlias(cid int64) (short string, err error) {
-	res, err := s.swap("SELECT alias FROM channels WHERE id=?", cid, short)
+	res, err := s.swap("SwapCIDForAlias", "SELECT alias FROM channels WHERE id=? AND deleted=0", cid, short)
 	if err != nil {
 		return "", err
 	}
@@ -119,7 +467,7 @@ func (s *Store) SwapCIDForAlias(cid int64) (short string, err error) {
 
 // SwapAliasForCID exchange alias for CID
 func (s *Store) SwapAliasForCID(alias string) (cid int64, err error) {
-	res, err := s.swap("SELECT id FROM channels WHERE alias=?", alias, cid)
+	res, err := s.swap("SwapAliasForCID", "SELECT id FROM channels WHERE alias=? AND deleted=0", alias, cid)
 	if err != nil {
 		return 0, err
 	}
@@ -128,18 +476,20 @@ func (s *Store) SwapAliasForCID(alias string) (cid int64, err error) {
 
 // SwapPIDForFilename PID for filename
 func (s *Store) SwapPIDForFilename(pid int64) (filename string, err error) {
-	res, err := s.swap("SELECT filename FROM podcasts WHERE id=?", pid, filename)
+	res, err := s.swap("SwapPIDForFilename", "SELECT filename FROM podcasts WHERE id=? AND deleted=0", pid, filename)
 	if err != nil {
 		return "", err
 	}
 	return res.(string), err
 }
 
-func (s *Store) swap(sql string, p, holder interface{}) (interface{}, error) {
+func (s *Store) swap(op, sql string, p, holder interface{}) (interface{}, error) {
+	defer s.observe(op, time.Now())
+
 	row := s.db.QueryRow(sql, p)
 	err := row.Scan(&holder)
 	if err != nil {
-		return nil, &Error{Err: err}
+		return nil, &Error{Op: op, Err: err}
 	}
 	return holder, nil
 }
@@ -148,7 +498,7 @@ func (s *Store) swap(sql string, p, holder interface{}) (interface{}, error) {
 func (s *Store) DropChannels() error {
 	_, err := s.db.Exec("DROP TABLE IF EXISTS channels")
 	if err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "DropChannels", Err: err}
 	}
 	return nil
 }
@@ -157,15 +507,63 @@ func (s *Store) DropChannels() error {
 func (s *Store) DropPodcasts() error {
 	_, err := s.db.Exec("DROP TABLE IF EXISTS podcasts")
 	if err != nil {
-		return &Error{Err: err}
+		return &Error{Op: "DropPodcasts", Err: err}
+	}
+	return nil
+}
+
+// Setting by key
+func (s *Store) Setting(key string) (string, error) {
+	defer s.observe("Setting", time.Now())
+
+	var value string
+	if err := s.db.QueryRow("SELECT value FROM settings WHERE key=?", key).Scan(&value); err != nil {
+		return "", &Error{Op: "Setting", Err: err}
+	}
+	return value, nil
+}
+
+// SetSetting by key
+func (s *Store) SetSetting(key, value string) error {
+	defer s.observe("SetSetting", time.Now())
+
+	_, err := s.db.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value=excluded.value", key, value)
+	if err != nil {
+		return &Error{Op: "SetSetting", Err: err}
 	}
 	return nil
 }
 
+// CountChannels in store
+func (s *Store) CountChannels() (int64, error) {
+	return s.count("CountChannels", "SELECT count(*) FROM channels WHERE deleted=0")
+}
+
+// CountPodcasts in store
+func (s *Store) CountPodcasts() (int64, error) {
+	return s.count("CountPodcasts", "SELECT count(*) FROM podcasts p JOIN channels c ON c.id=p.channel WHERE p.deleted=0 AND c.deleted=0")
+}
+
+func (s *Store) count(op, sql string) (int64, error) {
+	defer s.observe(op, time.Now())
+
+	var n int64
+	if err := s.db.QueryRow(sql).Scan(&n); err != nil {
+		return 0, &Error{Op: op, Err: err}
+	}
+	return n, nil
+}
+
+var queryDuration = metrics.NewHistogramVec("fakecast_store_query_duration_seconds", "Latency of store queries", nil, "method")
+
+func (s *Store) observe(method string, start time.Time) {
+	queryDuration.Observe(time.Since(start).Seconds(), method)
+}
+
 // Close DB connection
 func (s *Store) Close() error {
-	if err := s.db.Close(); err != nil {
-		return &Error{Err: err}
+	if err := s.conn.Close(); err != nil {
+		return &Error{Op: "Close", Err: err}
 	}
 	return nil
 }
@@ -1,8 +1,10 @@
 package store
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -131,7 +133,7 @@ func TestSwapPIDForFilename(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(int64(1), cid)
 
-	podcast, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", "10001")
+	podcast, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", 10001)
 	assert.Nil(err)
 	assert.Equal(int64(1), podcast.ID)
 
@@ -142,3 +144,244 @@ func TestSwapPIDForFilename(t *testing.T) {
 	_, err = store.SwapPIDForFilename(int64(2))
 	assert.NotNil(err)
 }
+
+func TestCount(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cid, err := store.AddChannel()
+	assert.Nil(err)
+
+	for i := 1; i < 3; i++ {
+		_, err := store.AddPodcastToChannel(cid, fmt.Sprintf("podcast%d.mp3", i), fmt.Sprintf("podcast%d", i), 1000)
+		assert.Nil(err)
+	}
+
+	n, err := store.CountChannels()
+	assert.Nil(err)
+	assert.Equal(int64(1), n)
+
+	n, err = store.CountPodcasts()
+	assert.Nil(err)
+	assert.Equal(int64(2), n)
+
+	err = store.DropPodcasts()
+	assert.Nil(err)
+
+	_, err = store.CountPodcasts()
+	assert.NotNil(err)
+}
+
+func TestOnChange(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	var changed []int64
+	store.OnChange(func(cid int64) {
+		changed = append(changed, cid)
+	})
+
+	cid, err := store.AddChannel()
+	assert.Nil(err)
+
+	c, err := store.ChannelInfo(cid)
+	assert.Nil(err)
+	assert.NotZero(c.LastModified)
+
+	// pretend channel wasn't changed for a while
+	_, err = store.db.Exec("UPDATE channels SET last_modified=1 WHERE id=?", cid)
+	assert.Nil(err)
+
+	p, err := store.AddPodcastToChannel(cid, "podcast1.mp3", "podcast1", 1000)
+	assert.Nil(err)
+
+	c, err = store.ChannelInfo(cid)
+	assert.Nil(err)
+	assert.True(c.LastModified > 1)
+
+	p, err = store.PodcastInfo(p.ID)
+	assert.Nil(err)
+	err = store.UpdatePodcast(p)
+	assert.Nil(err)
+
+	err = store.UpdateChannel(c)
+	assert.Nil(err)
+
+	err = store.DeletePodcast(p.ID)
+	assert.Nil(err)
+
+	// podcast is already deleted
+	err = store.DeletePodcast(p.ID)
+	assert.Nil(err)
+
+	err = store.DeleteChannel(cid)
+	assert.Nil(err)
+
+	assert.Equal([]int64{cid, cid, cid, cid, cid}, changed)
+}
+
+func TestAddColumn(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	// channels table of older version
+	db, err := sql.Open("sqlite3", filepath.Join(testDir, storeFile))
+	assert.Nil(err)
+	_, err = db.Exec("CREATE TABLE channels (id INTEGER PRIMARY KEY, alias TEXT UNIQUE DEFAULT '', title TEXT, description TEXT DEFAULT '', image TEXT DEFAULT '', explicit INTEGER DEFAULT 0, author TEXT DEFAULT '')")
+	assert.Nil(err)
+	_, err = db.Exec("INSERT INTO channels (title) VALUES ('old')")
+	assert.Nil(err)
+	db.Close()
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	c, err := store.ChannelInfo(1)
+	assert.Nil(err)
+	assert.Equal("old", c.Title)
+	assert.Zero(c.LastModified)
+}
+
+func TestCascadePodcasts(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	// podcasts table of older version without foreign key, one podcast of
+	// channel which is gone
+	db, err := sql.Open("sqlite3", filepath.Join(testDir, storeFile))
+	assert.Nil(err)
+	_, err = db.Exec("CREATE TABLE channels (id INTEGER PRIMARY KEY, alias TEXT UNIQUE DEFAULT '', title TEXT, description TEXT DEFAULT '', image TEXT DEFAULT '', explicit INTEGER DEFAULT 0, author TEXT DEFAULT '')")
+	assert.Nil(err)
+	_, err = db.Exec("CREATE TABLE podcasts (id INTEGER PRIMARY KEY, channel INTEGER, filename TEXT, published INTEGER DEFAULT 0, title TEXT, length INTEGER, guid TEXT DEFAULT '', pub_date TEXT DEFAULT '', description TEXT DEFAULT '', duration INTEGER DEFAULT 0, image TEXT DEFAULT '', explicit INTEGER DEFAULT 0, season INTEGER DEFAULT 0, episode INTEGER DEFAULT 0)")
+	assert.Nil(err)
+	_, err = db.Exec("INSERT INTO channels (alias, title) VALUES ('news', 'News')")
+	assert.Nil(err)
+	_, err = db.Exec("INSERT INTO podcasts (channel, filename, title, length) VALUES (1, 'kept.mp3', 'Kept', 10), (2, 'orphan.mp3', 'Orphan', 10)")
+	assert.Nil(err)
+	db.Close()
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	ps, err := store.ListPodcastsFrom(1)
+	assert.Nil(err)
+	assert.Len(ps, 1)
+	assert.Equal("kept.mp3", ps[0].Filename)
+
+	var n int
+	err = store.db.QueryRow("SELECT count(*) FROM podcasts").Scan(&n)
+	assert.Nil(err)
+	assert.Equal(1, n)
+
+	_, err = store.AddPodcastToChannel(2, "orphan.mp3", "Orphan", 10)
+	assert.NotNil(err)
+
+	// podcasts go along with channel
+	err = store.DeleteChannel(1)
+	assert.Nil(err)
+	err = store.db.QueryRow("SELECT count(*) FROM podcasts").Scan(&n)
+	assert.Nil(err)
+	assert.Zero(n)
+}
+
+func TestWithTx(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	var changed []int64
+	store.OnChange(func(cid int64) {
+		changed = append(changed, cid)
+	})
+
+	// nothing is left of failed unit of work
+	failure := fmt.Errorf("failure")
+	err = store.WithTx(func(tx *Store) error {
+		cid, err := tx.AddChannel()
+		assert.Nil(err)
+		_, err = tx.AddPodcastToChannel(cid, "podcast.mp3", "Podcast", 10)
+		assert.Nil(err)
+		return failure
+	})
+	assert.Equal(failure, err)
+	assert.Empty(changed)
+
+	n, err := store.CountChannels()
+	assert.Nil(err)
+	assert.Zero(n)
+
+	// hooks are called once it's committed, nested call joins
+	var cid int64
+	err = store.WithTx(func(tx *Store) error {
+		if cid, err = tx.AddChannel(); err != nil {
+			return err
+		}
+		if _, err := tx.AddPodcastToChannel(cid, "podcast.mp3", "Podcast", 10); err != nil {
+			return err
+		}
+		assert.Empty(changed)
+		return tx.WithTx(func(inner *Store) error {
+			assert.Equal(tx, inner)
+			return inner.SetMember(cid, 1, "editor")
+		})
+	})
+	assert.Nil(err)
+	assert.Equal([]int64{cid}, changed)
+
+	n, err = store.CountPodcasts()
+	assert.Nil(err)
+	assert.Equal(int64(1), n)
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// Token of user for scripts. Only hash of token is kept
+type Token struct {
+	ID       int64    `json:"id"`
+	User     int64    `json:"user"`
+	Name     string   `json:"name"`
+	Hash     string   `json:"-"`
+	Scopes   []string `json:"scopes"`
+	Channel  int64    `json:"channel,omitempty"`
+	Expires  int64    `json:"expires,omitempty"`
+	LastUsed int64    `json:"last_used,omitempty"`
+	Created  int64    `json:"created"`
+}
+
+// Expired token at time t
+func (t *Token) Expired(at time.Time) bool {
+	return t.Expires != 0 && at.Unix() >= t.Expires
+}
+
+// scanner of row or rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row scanner) (*Token, error) {
+	var (
+		t      Token
+		scopes string
+	)
+	if err := row.Scan(&t.ID, &t.User, &t.Name, &t.Hash, &scopes, &t.Channel, &t.Expires, &t.LastUsed, &t.Created); err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	return &t, nil
+}
+
+const tokenColumns = "id, user, name, hash, scopes, channel, expires, last_used, created"
+
+//
+// Add
+//
+
+// AddToken with hash of it
+func (s *Store) AddToken(t *Token) error {
+	defer s.observe("AddToken", time.Now())
+
+	t.Created = time.Now().Unix()
+
+	result, err := s.db.Exec("INSERT INTO tokens (user, name, hash, scopes, channel, expires, created) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		t.User, t.Name, t.Hash, strings.Join(t.Scopes, " "), t.Channel, t.Expires, t.Created)
+	if err != nil {
+		return &Error{Op: "AddToken", Err: err}
+	}
+
+	t.ID, err = result.LastInsertId()
+	if err != nil {
+		return &Error{Op: "AddToken", Err: err}
+	}
+
+	return nil
+}
+
+//
+// List
+//
+
+// TokensOf user from the newest
+func (s *Store) TokensOf(uid int64) ([]Token, error) {
+	defer s.observe("TokensOf", time.Now())
+
+	rows, err := s.db.Query("SELECT "+tokenColumns+" FROM tokens WHERE user=? ORDER BY id DESC", uid)
+	if err != nil {
+		return nil, &Error{Op: "TokensOf", Err: err}
+	}
+	defer rows.Close()
+
+	ts := []Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, &Error{Op: "TokensOf", Err: err}
+		}
+		ts = append(ts, *t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "TokensOf", Err: err}
+	}
+
+	return ts, nil
+}
+
+//
+// Info
+//
+
+// TokenByHash of token, sql.ErrNoRows if there is no such token
+func (s *Store) TokenByHash(hash string) (*Token, error) {
+	defer s.observe("TokenByHash", time.Now())
+
+	t, err := scanToken(s.db.QueryRow("SELECT "+tokenColumns+" FROM tokens WHERE hash=?", hash))
+	if err != nil {
+		return nil, &Error{Op: "TokenByHash", Err: err}
+	}
+	return t, nil
+}
+
+//
+// Update
+//
+
+// TouchToken with time of its use
+func (s *Store) TouchToken(id int64, at time.Time) error {
+	defer s.observe("TouchToken", time.Now())
+
+	_, err := s.db.Exec("UPDATE tokens SET last_used=? WHERE id=?", at.Unix(), id)
+	if err != nil {
+		return &Error{Op: "TouchToken", Err: err}
+	}
+	return nil
+}
+
+//
+// Delete
+//
+
+// DeleteToken of user, false if user has no such token
+func (s *Store) DeleteToken(uid, id int64) (bool, error) {
+	defer s.observe("DeleteToken", time.Now())
+
+	result, err := s.db.Exec("DELETE FROM tokens WHERE id=? AND user=?", id, uid)
+	if err != nil {
+		return false, &Error{Op: "DeleteToken", Err: err}
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, &Error{Op: "DeleteToken", Err: err}
+	}
+	return n > 0, nil
+}
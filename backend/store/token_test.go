@@ -0,0 +1,89 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	alice := &User{Name: "alice", Role: "uploader"}
+	err = store.AddUser(alice)
+	assert.Nil(err)
+	bob := &User{Name: "bob", Role: "viewer"}
+	err = store.AddUser(bob)
+	assert.Nil(err)
+
+	ci := &Token{User: alice.ID, Name: "ci", Hash: "h1", Scopes: []string{"episode:write", "channel:read"}, Channel: 3}
+	err = store.AddToken(ci)
+	assert.Nil(err)
+	assert.NotZero(ci.ID)
+	assert.NotZero(ci.Created)
+
+	err = store.AddToken(&Token{User: alice.ID, Name: "dup", Hash: "h1"})
+	assert.NotNil(err)
+
+	err = store.AddToken(&Token{User: bob.ID, Name: "stats", Hash: "h2", Scopes: []string{"channel:read"}, Expires: 100})
+	assert.Nil(err)
+
+	tok, err := store.TokenByHash("h1")
+	assert.Nil(err)
+	assert.Equal(ci, tok)
+
+	_, err = store.TokenByHash("h3")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	now := time.Now()
+	err = store.TouchToken(ci.ID, now)
+	assert.Nil(err)
+
+	ts, err := store.TokensOf(alice.ID)
+	assert.Nil(err)
+	assert.Len(ts, 1)
+	assert.Equal(now.Unix(), ts[0].LastUsed)
+
+	ok, err := store.DeleteToken(bob.ID, ci.ID)
+	assert.Nil(err)
+	assert.False(ok)
+
+	ok, err = store.DeleteToken(alice.ID, ci.ID)
+	assert.Nil(err)
+	assert.True(ok)
+
+	ts, err = store.TokensOf(alice.ID)
+	assert.Nil(err)
+	assert.Empty(ts)
+
+	err = store.DeleteUser(bob.ID)
+	assert.Nil(err)
+	_, err = store.TokenByHash("h2")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+}
+
+func TestTokenExpired(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	assert.False(t, (&Token{}).Expired(now))
+	assert.False(t, (&Token{Expires: 1001}).Expired(now))
+	assert.True(t, (&Token{Expires: 1000}).Expired(now))
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"strconv"
+	"time"
+)
+
+// Kinds of trash items
+const (
+	KindChannel = "channel"
+	KindPodcast = "podcast"
+)
+
+// TrashItem is channel or podcast deleted, but not purged yet. Name is
+// alias of channel or filename of podcast
+type TrashItem struct {
+	ID      int64  `json:"id"`
+	Kind    string `json:"kind"`
+	Item    int64  `json:"item"`
+	Channel int64  `json:"channel"`
+	Title   string `json:"title"`
+	Name    string `json:"name"`
+	Deleted int64  `json:"deleted"`
+	Actor   string `json:"actor"`
+}
+
+// Path of item files in trash
+func (t *TrashItem) Path() string {
+	return t.Kind + "-" + strconv.FormatInt(t.Item, 10)
+}
+
+const trashColumns = "id, kind, item, channel, title, name, deleted, actor"
+
+func scanTrashItem(row scanner) (*TrashItem, error) {
+	var t TrashItem
+	if err := row.Scan(&t.ID, &t.Kind, &t.Item, &t.Channel, &t.Title, &t.Name, &t.Deleted, &t.Actor); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+//
+// Add
+//
+
+// TrashChannel marks channel deleted. Its alias is released, so another
+// channel may take it meanwhile
+func (s *Store) TrashChannel(cid int64, actor string) (*TrashItem, error) {
+	defer s.observe("TrashChannel", time.Now())
+
+	t := &TrashItem{Kind: KindChannel, Item: cid, Channel: cid, Deleted: time.Now().Unix(), Actor: actor}
+
+	err := s.WithTx(func(tx *Store) error {
+		err := tx.db.QueryRow("SELECT title, alias FROM channels WHERE id=? AND deleted=0", cid).Scan(&t.Title, &t.Name)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.db.Exec("UPDATE channels SET alias=NULL, deleted=? WHERE id=?", t.Deleted, cid); err != nil {
+			return err
+		}
+
+		if err = tx.addTrashItem(t); err != nil {
+			return err
+		}
+
+		tx.changed(cid)
+		return nil
+	})
+	if err != nil {
+		return nil, &Error{Op: "TrashChannel", Err: err}
+	}
+
+	return t, nil
+}
+
+// TrashPodcast marks podcast deleted
+func (s *Store) TrashPodcast(pid int64, actor string) (*TrashItem, error) {
+	defer s.observe("TrashPodcast", time.Now())
+
+	t := &TrashItem{Kind: KindPodcast, Item: pid, Deleted: time.Now().Unix(), Actor: actor}
+
+	err := s.WithTx(func(tx *Store) error {
+		err := tx.db.QueryRow("SELECT channel, title, filename FROM podcasts WHERE id=? AND deleted=0", pid).Scan(&t.Channel, &t.Title, &t.Name)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.db.Exec("UPDATE podcasts SET deleted=? WHERE id=?", t.Deleted, pid); err != nil {
+			return err
+		}
+
+		if err = tx.addTrashItem(t); err != nil {
+			return err
+		}
+
+		return tx.touch(t.Channel)
+	})
+	if err != nil {
+		return nil, &Error{Op: "TrashPodcast", Err: err}
+	}
+
+	return t, nil
+}
+
+func (s *Store) addTrashItem(t *TrashItem) error {
+	result, err := s.db.Exec("INSERT INTO trash (kind, item, channel, title, name, deleted, actor) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		t.Kind, t.Item, t.Channel, t.Title, t.Name, t.Deleted, t.Actor)
+	if err != nil {
+		return err
+	}
+
+	t.ID, err = result.LastInsertId()
+	return err
+}
+
+//
+// List
+//
+
+// ListTrash from the latest deleted item
+func (s *Store) ListTrash() ([]TrashItem, error) {
+	defer s.observe("ListTrash", time.Now())
+
+	rows, err := s.db.Query("SELECT " + trashColumns + " FROM trash ORDER BY deleted DESC, id DESC")
+	if err != nil {
+		return nil, &Error{Op: "ListTrash", Err: err}
+	}
+	defer rows.Close()
+
+	ts := []TrashItem{}
+	for rows.Next() {
+		t, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, &Error{Op: "ListTrash", Err: err}
+		}
+		ts = append(ts, *t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "ListTrash", Err: err}
+	}
+
+	return ts, nil
+}
+
+//
+// Info
+//
+
+// TrashInfo of item, sql.ErrNoRows if there is no such item
+func (s *Store) TrashInfo(id int64) (*TrashItem, error) {
+	defer s.observe("TrashInfo", time.Now())
+
+	t, err := scanTrashItem(s.db.QueryRow("SELECT "+trashColumns+" FROM trash WHERE id=?", id))
+	if err != nil {
+		return nil, &Error{Op: "TrashInfo", Err: err}
+	}
+	return t, nil
+}
+
+//
+// Restore
+//
+
+// RestoreTrash item, so channel or podcast is back. Channel gets its
+// alias back, it fails if the alias is taken
+func (s *Store) RestoreTrash(id int64) error {
+	defer s.observe("RestoreTrash", time.Now())
+
+	err := s.WithTx(func(tx *Store) error {
+		t, err := scanTrashItem(tx.db.QueryRow("SELECT "+trashColumns+" FROM trash WHERE id=?", id))
+		if err != nil {
+			return err
+		}
+
+		switch t.Kind {
+		case KindChannel:
+			_, err = tx.db.Exec("UPDATE channels SET alias=?, deleted=0 WHERE id=?", t.Name, t.Item)
+		case KindPodcast:
+			_, err = tx.db.Exec("UPDATE podcasts SET deleted=0 WHERE id=?", t.Item)
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.db.Exec("DELETE FROM trash WHERE id=?", id); err != nil {
+			return err
+		}
+
+		return tx.touch(t.Channel)
+	})
+	if err != nil {
+		return &Error{Op: "RestoreTrash", Err: err}
+	}
+
+	return nil
+}
+
+//
+// Delete
+//
+
+// PurgeTrash item for good. Podcasts trashed from purged channel go along
+// with it, all purged items are returned
+func (s *Store) PurgeTrash(id int64) ([]TrashItem, error) {
+	defer s.observe("PurgeTrash", time.Now())
+
+	var purged []TrashItem
+
+	err := s.WithTx(func(tx *Store) error {
+		t, err := scanTrashItem(tx.db.QueryRow("SELECT "+trashColumns+" FROM trash WHERE id=?", id))
+		if err != nil {
+			return err
+		}
+		purged = append(purged, *t)
+
+		if t.Kind == KindPodcast {
+			if _, err = tx.db.Exec("DELETE FROM podcasts WHERE id=? AND deleted>0", t.Item); err != nil {
+				return err
+			}
+			_, err = tx.db.Exec("DELETE FROM trash WHERE id=?", id)
+			return err
+		}
+
+		rows, err := tx.db.Query("SELECT "+trashColumns+" FROM trash WHERE kind=? AND channel=?", KindPodcast, t.Item)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			p, err := scanTrashItem(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			purged = append(purged, *p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// podcasts go along with channel by foreign key
+		for _, q := range []string{
+			"DELETE FROM members WHERE channel=?",
+			"DELETE FROM trash WHERE channel=?",
+			"DELETE FROM channels WHERE id=? AND deleted>0",
+		} {
+			if _, err := tx.db.Exec(q, t.Item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &Error{Op: "PurgeTrash", Err: err}
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	cid, err := store.AddChannel()
+	assert.Nil(err)
+	err = store.UpdateChannel(&Channel{ID: cid, Alias: "news", Title: "News"})
+	assert.Nil(err)
+
+	one, err := store.AddPodcastToChannel(cid, "one.mp3", "One", 10)
+	assert.Nil(err)
+	two, err := store.AddPodcastToChannel(cid, "two.mp3", "Two", 10)
+	assert.Nil(err)
+
+	// trashed podcast is gone from channel
+	pt, err := store.TrashPodcast(one.ID, "alice")
+	assert.Nil(err)
+	assert.Equal(&TrashItem{ID: pt.ID, Kind: KindPodcast, Item: one.ID, Channel: cid, Title: "One", Name: "one.mp3", Deleted: pt.Deleted, Actor: "alice"}, pt)
+	assert.Equal("podcast-"+fmt.Sprint(one.ID), pt.Path())
+
+	_, err = store.PodcastInfo(one.ID)
+	assert.True(errors.Is(err, sql.ErrNoRows))
+	ps, err := store.ListPodcastsFrom(cid)
+	assert.Nil(err)
+	assert.Len(ps, 1)
+
+	_, err = store.TrashPodcast(one.ID, "alice")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	err = store.RestoreTrash(pt.ID)
+	assert.Nil(err)
+	_, err = store.PodcastInfo(one.ID)
+	assert.Nil(err)
+
+	// trashed channel releases its alias
+	_, err = store.TrashPodcast(two.ID, "alice")
+	assert.Nil(err)
+	ct, err := store.TrashChannel(cid, "bob")
+	assert.Nil(err)
+	assert.Equal("news", ct.Name)
+
+	_, err = store.ChannelInfo(cid)
+	assert.True(errors.Is(err, sql.ErrNoRows))
+	_, err = store.SwapAliasForCID("news")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+	n, err := store.CountPodcasts()
+	assert.Nil(err)
+	assert.Zero(n)
+
+	ts, err := store.ListTrash()
+	assert.Nil(err)
+	assert.Len(ts, 2)
+
+	other, err := store.AddChannel()
+	assert.Nil(err)
+	err = store.UpdateChannel(&Channel{ID: other, Alias: "news"})
+	assert.Nil(err)
+	err = store.RestoreTrash(ct.ID)
+	assert.NotNil(err)
+
+	err = store.UpdateChannel(&Channel{ID: other, Alias: "other"})
+	assert.Nil(err)
+	err = store.RestoreTrash(ct.ID)
+	assert.Nil(err)
+	c, err := store.ChannelInfo(cid)
+	assert.Nil(err)
+	assert.Equal("news", c.Alias)
+
+	// podcasts trashed before go along with purged channel
+	ct, err = store.TrashChannel(cid, "bob")
+	assert.Nil(err)
+	purged, err := store.PurgeTrash(ct.ID)
+	assert.Nil(err)
+	assert.Len(purged, 2)
+	assert.Equal(ct.ID, purged[0].ID)
+	assert.Equal(two.ID, purged[1].Item)
+
+	ts, err = store.ListTrash()
+	assert.Nil(err)
+	assert.Empty(ts)
+
+	_, err = store.TrashInfo(ct.ID)
+	assert.True(errors.Is(err, sql.ErrNoRows))
+	_, err = store.PurgeTrash(ct.ID)
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	n, err = store.CountChannels()
+	assert.Nil(err)
+	assert.Equal(int64(1), n)
+}
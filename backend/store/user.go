@@ -0,0 +1,159 @@
+package store
+
+import "time"
+
+// User of admin area
+type User struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	PasswordHash string `json:"-"`
+	Created      int64  `json:"created"`
+
+	// Issuer and Subject of identity provider the user logs in with
+	Issuer  string `json:"-"`
+	Subject string `json:"-"`
+}
+
+const userColumns = "id, name, role, password_hash, created, issuer, subject"
+
+func scanUser(sc scanner, u *User) error {
+	return sc.Scan(&u.ID, &u.Name, &u.Role, &u.PasswordHash, &u.Created, &u.Issuer, &u.Subject)
+}
+
+//
+// Add
+//
+
+// AddUser with hashed password
+func (s *Store) AddUser(u *User) error {
+	defer s.observe("AddUser", time.Now())
+
+	u.Created = time.Now().Unix()
+
+	result, err := s.db.Exec("INSERT INTO users (name, role, password_hash, created, issuer, subject) VALUES (?, ?, ?, ?, ?, ?)",
+		u.Name, u.Role, u.PasswordHash, u.Created, u.Issuer, u.Subject)
+	if err != nil {
+		return &Error{Op: "AddUser", Err: err}
+	}
+
+	u.ID, err = result.LastInsertId()
+	if err != nil {
+		return &Error{Op: "AddUser", Err: err}
+	}
+
+	return nil
+}
+
+//
+// List
+//
+
+// ListUsers by name
+func (s *Store) ListUsers() ([]User, error) {
+	defer s.observe("ListUsers", time.Now())
+
+	rows, err := s.db.Query("SELECT " + userColumns + " FROM users ORDER BY name")
+	if err != nil {
+		return nil, &Error{Op: "ListUsers", Err: err}
+	}
+	defer rows.Close()
+
+	us := []User{}
+	for rows.Next() {
+		var u User
+		if err := scanUser(rows, &u); err != nil {
+			return nil, &Error{Op: "ListUsers", Err: err}
+		}
+		us = append(us, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Op: "ListUsers", Err: err}
+	}
+
+	return us, nil
+}
+
+//
+// Info
+//
+
+// UserInfo by id
+func (s *Store) UserInfo(id int64) (*User, error) {
+	return s.user("UserInfo", "WHERE id=?", id)
+}
+
+// UserByName of user
+func (s *Store) UserByName(name string) (*User, error) {
+	return s.user("UserByName", "WHERE name=?", name)
+}
+
+// UserBySubject of identity provider
+func (s *Store) UserBySubject(issuer, subject string) (*User, error) {
+	return s.user("UserBySubject", "WHERE issuer=? AND subject=? AND subject!=''", issuer, subject)
+}
+
+func (s *Store) user(op, where string, args ...interface{}) (*User, error) {
+	defer s.observe(op, time.Now())
+
+	var u User
+	if err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users "+where, args...), &u); err != nil {
+		return nil, &Error{Op: op, Err: err}
+	}
+	return &u, nil
+}
+
+// CountUsers with role, all of them if role is empty
+func (s *Store) CountUsers(role string) (int64, error) {
+	defer s.observe("CountUsers", time.Now())
+
+	var n int64
+	if err := s.db.QueryRow("SELECT count(*) FROM users WHERE ?='' OR role=?", role, role).Scan(&n); err != nil {
+		return 0, &Error{Op: "CountUsers", Err: err}
+	}
+	return n, nil
+}
+
+//
+// Update
+//
+
+// UpdateUser name, role, password and identity
+func (s *Store) UpdateUser(u *User) error {
+	defer s.observe("UpdateUser", time.Now())
+
+	_, err := s.db.Exec("UPDATE users SET name=?, role=?, password_hash=?, issuer=?, subject=? WHERE id=?",
+		u.Name, u.Role, u.PasswordHash, u.Issuer, u.Subject, u.ID)
+	if err != nil {
+		return &Error{Op: "UpdateUser", Err: err}
+	}
+	return nil
+}
+
+//
+// Delete
+//
+
+// DeleteUser action
+func (s *Store) DeleteUser(id int64) error {
+	defer s.observe("DeleteUser", time.Now())
+
+	err := s.WithTx(func(tx *Store) error {
+		for _, q := range []string{
+			"DELETE FROM users WHERE id=?",
+			"DELETE FROM members WHERE user=?",
+			"DELETE FROM tokens WHERE user=?",
+			"DELETE FROM sessions WHERE user=?",
+		} {
+			if _, err := tx.db.Exec(q, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &Error{Op: "DeleteUser", Err: err}
+	}
+	return nil
+}
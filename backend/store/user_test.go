@@ -0,0 +1,92 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers(t *testing.T) {
+	assert := assert.New(t)
+	testDir := fmt.Sprintf("test_dir_%x", time.Now().Unix())
+
+	err := os.MkdirAll(testDir, os.ModePerm)
+	assert.Nil(err)
+
+	store, err := NewStore(testDir)
+	assert.Nil(err)
+
+	defer func() {
+		store.Close()
+		err = os.RemoveAll(testDir)
+		assert.Nil(err)
+	}()
+
+	n, err := store.CountUsers("")
+	assert.Nil(err)
+	assert.Zero(n)
+
+	alice := &User{Name: "alice", Role: "owner", PasswordHash: "hash"}
+	err = store.AddUser(alice)
+	assert.Nil(err)
+	assert.NotZero(alice.ID)
+	assert.NotZero(alice.Created)
+
+	bob := &User{Name: "bob", Role: "viewer", PasswordHash: "hash"}
+	err = store.AddUser(bob)
+	assert.Nil(err)
+
+	err = store.AddUser(&User{Name: "bob", Role: "owner"})
+	assert.NotNil(err)
+
+	us, err := store.ListUsers()
+	assert.Nil(err)
+	assert.Equal([]User{*alice, *bob}, us)
+
+	u, err := store.UserByName("bob")
+	assert.Nil(err)
+	assert.Equal(bob, u)
+
+	n, err = store.CountUsers("")
+	assert.Nil(err)
+	assert.Equal(int64(2), n)
+
+	n, err = store.CountUsers("owner")
+	assert.Nil(err)
+	assert.Equal(int64(1), n)
+
+	bob.Role = "editor"
+	bob.PasswordHash = "new"
+	err = store.UpdateUser(bob)
+	assert.Nil(err)
+
+	u, err = store.UserInfo(bob.ID)
+	assert.Nil(err)
+	assert.Equal(bob, u)
+
+	_, err = store.UserBySubject("https://idp", "")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	carol := &User{Name: "carol", Role: "viewer", Issuer: "https://idp", Subject: "42"}
+	err = store.AddUser(carol)
+	assert.Nil(err)
+	err = store.AddUser(&User{Name: "dave", Role: "viewer", Issuer: "https://idp", Subject: "42"})
+	assert.NotNil(err)
+
+	u, err = store.UserBySubject("https://idp", "42")
+	assert.Nil(err)
+	assert.Equal(carol, u)
+	_, err = store.UserBySubject("https://other", "42")
+	assert.True(errors.Is(err, sql.ErrNoRows))
+
+	err = store.DeleteUser(bob.ID)
+	assert.Nil(err)
+
+	_, err = store.UserInfo(bob.ID)
+	assert.True(errors.Is(err, sql.ErrNoRows))
+}
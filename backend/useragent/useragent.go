@@ -0,0 +1,112 @@
+package useragent
+
+import (
+	_ "embed" // rules
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+)
+
+// Unknown value of a field nothing is known about
+const Unknown = "unknown"
+
+//go:embed user-agents.json
+var defaultRules []byte
+
+// Rule in format of the open podcast user-agent list. The first rule with
+// any of UserAgents patterns matching wins
+type Rule struct {
+	UserAgents []string `json:"user_agents"`
+	App        string   `json:"app,omitempty"`
+	Device     string   `json:"device,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	Bot        bool     `json:"bot,omitempty"`
+
+	patterns []*regexp.Regexp
+}
+
+// Client recognized by user agent
+type Client struct {
+	App    string `json:"app"`
+	Device string `json:"device"`
+	OS     string `json:"os"`
+	Bot    bool   `json:"bot"`
+}
+
+// Classifier of user agents
+type Classifier struct {
+	rules []Rule
+}
+
+// New classifier from JSON rules
+func New(data []byte) (*Classifier, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		for _, ua := range rules[i].UserAgents {
+			re, err := regexp.Compile(ua)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+			rules[i].patterns = append(rules[i].patterns, re)
+		}
+	}
+
+	return &Classifier{rules: rules}, nil
+}
+
+// Load classifier with rules from file
+func Load(path string) (*Classifier, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(data)
+}
+
+var builtin *Classifier
+
+func init() {
+	var err error
+	if builtin, err = New(defaultRules); err != nil {
+		panic(err)
+	}
+}
+
+// Default classifier with built-in rules
+func Default() *Classifier {
+	return builtin
+}
+
+// Classify user agent. Empty user agent is treated as a bot
+func (c *Classifier) Classify(ua string) Client {
+	if ua == "" {
+		return Client{App: Unknown, Device: Unknown, OS: Unknown, Bot: true}
+	}
+
+	for _, r := range c.rules {
+		for _, re := range r.patterns {
+			if re.MatchString(ua) {
+				return Client{
+					App:    orUnknown(r.App),
+					Device: orUnknown(r.Device),
+					OS:     orUnknown(r.OS),
+					Bot:    r.Bot,
+				}
+			}
+		}
+	}
+
+	return Client{App: Unknown, Device: Unknown, OS: Unknown}
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return Unknown
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := []struct {
+		ua     string
+		expect Client
+	}{
+		{"AppleCoreMedia/1.0.0.17E262 (iPhone; U; CPU OS 13_4_1 like Mac OS X; en_us)", Client{App: "Apple Podcasts", Device: "phone", OS: "ios"}},
+		{"Podcasts/1.0.0 (Android 10)", Client{App: "Google Podcasts", Device: "phone", OS: "android"}},
+		{"AntennaPod/2.0.1 (Android 10)", Client{App: "AntennaPod", Device: "phone", OS: "android"}},
+		{"Overcast/3.0 (+http://overcast.fm/; iOS podcast app)", Client{App: "Overcast", Device: "phone", OS: "ios"}},
+		{"Spotify/8.5.60 iOS/13.5 (iPhone11,2)", Client{App: "Spotify", Device: "phone", OS: "ios"}},
+		{"Googlebot/2.1 (+http://www.google.com/bot.html)", Client{App: "Bot", Device: Unknown, OS: Unknown, Bot: true}},
+		{"curl/7.68.0", Client{App: "Tool", Device: Unknown, OS: Unknown, Bot: true}},
+		{"", Client{App: Unknown, Device: Unknown, OS: Unknown, Bot: true}},
+		{"SomethingElse/1.0", Client{App: Unknown, Device: Unknown, OS: Unknown}},
+	}
+
+	c := Default()
+	for _, tc := range tt {
+		assert.Equal(tc.expect, c.Classify(tc.ua), tc.ua)
+	}
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New([]byte(`[{"user_agents": ["^MyApp/"], "app": "My App", "os": "linux"}]`))
+	assert.Nil(err)
+	assert.Equal(Client{App: "My App", Device: Unknown, OS: "linux"}, c.Classify("MyApp/1.0"))
+
+	_, err = New([]byte(`[{"user_agents": ["("]}]`))
+	assert.NotNil(err)
+
+	_, err = New([]byte(`{`))
+	assert.NotNil(err)
+}
@@ -8,8 +8,10 @@ import ListItem from '@material-ui/core/ListItem';
 import ListItemText from '@material-ui/core/ListItemText';
 import IconButton from '@material-ui/core/IconButton';
 import AddCircleOutlineIcon from '@material-ui/icons/AddCircleOutline';
+import ExitToAppIcon from '@material-ui/icons/ExitToApp';
 
 import Channel from './Channel';
+import Login from './Login';
 
 var host;
 if (!process.env.NODE_ENV || process.env.NODE_ENV === 'development') {
@@ -63,8 +65,22 @@ export default function PermanentDrawerLeft() {
 
   const [data, setData] = useState([]);
   const [current, setCurrent] = useState({});
+  const [loggedIn, setLoggedIn] = useState(true);
 
   useEffect(() => {
+    const interceptor = axios.interceptors.response.use(res => res, (err) => {
+      if (err.response && err.response.status === 401) {
+        setLoggedIn(false);
+      }
+      return Promise.reject(err);
+    });
+    return () => axios.interceptors.response.eject(interceptor);
+  }, []);
+
+  useEffect(() => {
+    if (!loggedIn) {
+      return;
+    }
     const fetchData = async () => {
       const res = await axios.get(`${host}/api/list`, {});
       if (res.data) {
@@ -72,7 +88,14 @@ export default function PermanentDrawerLeft() {
       }
     };
     fetchData();
-  }, []);
+  }, [loggedIn]);
+
+  const logout = async () => {
+    await axios.post(`${host}/api/logout`);
+    setData([]);
+    setCurrent({});
+    setLoggedIn(false);
+  };
 
   const addChannel = async () => {
     const res = await axios.post(`${host}/api/channel`);
@@ -93,6 +116,10 @@ export default function PermanentDrawerLeft() {
     setData(data.map((item) => item.id === channel.id ? channel : item));
   };
 
+  if (!loggedIn) {
+    return <Login host={host} onLogin={() => setLoggedIn(true)} />;
+  }
+
   return (
     <div className={classes.root}>
       <Drawer
@@ -140,6 +167,13 @@ export default function PermanentDrawerLeft() {
           >
             <AddCircleOutlineIcon fontSize="large" />
           </IconButton>
+          <IconButton
+            className={classes.button}
+            aria-label="log out"
+            onClick={() => logout()}
+          >
+            <ExitToAppIcon />
+          </IconButton>
         </div>
 
       </Drawer>
@@ -103,7 +103,7 @@ export default function Content(props) {
 
     if (alias !== trimInfo.alias) {
       setAlias(trimInfo.alias);
-      setInfo({ ...info, 'cover': res.data.cover });
+      setInfo({ ...info, 'cover': res.data.cover, 'thumbnail': res.data.thumbnail });
     }
 
     setChanged(false);
@@ -135,7 +135,7 @@ export default function Content(props) {
         'Content-Type': 'multipart/form-data'
       }
     });
-    setInfo({ ...info, 'cover': res.data.cover });
+    setInfo({ ...info, 'cover': res.data.cover, 'thumbnail': res.data.thumbnail });
   };
 
   const deleteChannel = async () => {
@@ -150,7 +150,7 @@ export default function Content(props) {
     const fields = info.cover.split('/');
     const [, , cover] = fields.slice(-3);
     await axios.delete(`${host}/api/channel/${info.id}/cover/${cover}`);
-    setInfo({ ...trimmer(info), 'cover': '' });
+    setInfo({ ...trimmer(info), 'cover': '', 'thumbnail': '' });
   };
 
   const errEmpty = {
@@ -193,6 +193,7 @@ export default function Content(props) {
                   <Grid>
                     <Cover
                       cover={info.cover}
+                      thumbnail={info.thumbnail}
                       upload={uploadCover}
                       delete={deleteCover}
                     />
@@ -35,7 +35,7 @@ export default function Cover(props) {
     <Paper className={classes.paper}
       elevation={2}
       style={{
-        backgroundImage: `url(${props.cover})`,
+        backgroundImage: `url(${props.thumbnail || props.cover})`,
       }}>
       <Grid container justify="flex-end" alignItems="flex-end"
         style={{
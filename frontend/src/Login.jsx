@@ -0,0 +1,77 @@
+import React, { useState, useEffect } from 'react';
+import axios from 'axios';
+import { makeStyles } from '@material-ui/core/styles';
+import Box from '@material-ui/core/Box';
+import Button from '@material-ui/core/Button';
+import TextField from '@material-ui/core/TextField';
+
+import { setCSRF } from './Session';
+
+const useStyles = makeStyles(theme => ({
+  form: {
+    width: 300,
+    margin: '15vh auto 0',
+    '& .MuiTextField-root': {
+      width: '100%',
+      marginBottom: theme.spacing(2),
+    },
+  },
+}));
+
+export default function Login(props) {
+  const [name, setName] = useState('');
+  const [password, setPassword] = useState('');
+  const [failed, setFailed] = useState(false);
+  const [sso, setSSO] = useState(false);
+
+  const classes = useStyles();
+
+  useEffect(() => {
+    (async () => {
+      const res = await axios.get(`${props.host}/api/login`);
+      setSSO(res.data.oidc);
+    })();
+  }, [props.host]);
+
+  const login = async (e) => {
+    e.preventDefault();
+    try {
+      const res = await axios.post(`${props.host}/api/login`, { name, password });
+      setCSRF(res.data.csrf);
+      setFailed(false);
+      props.onLogin(res.data.user);
+    } catch (err) {
+      setFailed(true);
+    }
+  };
+
+  return (
+    <form className={classes.form} onSubmit={login}>
+      <TextField
+        label="Name"
+        value={name}
+        autoFocus
+        onChange={(e) => setName(e.target.value)}
+      />
+      <TextField
+        label="Password"
+        type="password"
+        value={password}
+        error={failed}
+        helperText={failed ? 'Wrong name or password' : ''}
+        onChange={(e) => setPassword(e.target.value)}
+      />
+      <Box textAlign="center">
+        <Button type="submit" variant="contained" color="primary">
+          Log in
+        </Button>
+        {sso ?
+          <Box mt={2}>
+            <Button variant="outlined" color="primary" href={`${props.host}/api/oidc/login`}>
+              Log in with SSO
+            </Button>
+          </Box> : ''}
+      </Box>
+    </form>
+  );
+}
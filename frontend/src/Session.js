@@ -0,0 +1,26 @@
+import axios from 'axios';
+
+// session cookie goes along with requests, CSRF token comes back in header
+// of every response and is sent with changes
+let csrf = '';
+
+axios.defaults.withCredentials = true;
+axios.defaults.headers.common['X-Requested-With'] = 'XMLHttpRequest';
+
+axios.interceptors.request.use((config) => {
+  if (csrf && !['get', 'head', 'options'].includes((config.method || 'get').toLowerCase())) {
+    config.headers['X-CSRF-Token'] = csrf;
+  }
+  return config;
+});
+
+axios.interceptors.response.use((res) => {
+  if (res.headers['x-csrf-token']) {
+    csrf = res.headers['x-csrf-token'];
+  }
+  return res;
+});
+
+export const setCSRF = (token) => {
+  csrf = token;
+};